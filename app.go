@@ -1,29 +1,212 @@
 package gsockets
 
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"time"
+)
+
+const (
+	defaultMaxPresenceMembers      = 100
+	defaultMaxPresenceUserInfoSize = 1
+)
+
 // App struct represents the main application instance. If you are familier with
 // pusher apps, gsockets apps serve the exact same purpose. Each App gets an id,
 // key and secret that can be used to authenticate with the gsockets server.
 type App struct {
 	// ID uniquely identifies a single app.
-	ID string
+	ID string `json:"id"`
 
 	// Key is the publishable Key that the client libraries can use
 	// to connect with this app instance.
-	Key string
+	Key string `json:"key"`
 
 	// Secret is used to encrypt and decrypt communications from the server SDKs.
-	Secret string
+	Secret string `json:"secret"`
+
+	// Secrets are accepted along with Secret to verify the signatures made for Key, so a new secret
+	// can be rolled out to the backends one by one. The signatures made by the server still use Secret.
+	Secrets []AppSecret `mapstructure:"secrets" json:"secrets,omitempty"`
+
+	// PreviousKey and PreviousSecret are the credentials replaced by the last rotation, they are
+	// still accepted until PreviousExpiresAt so the clients and backends can move to the new ones.
+	PreviousKey       string    `mapstructure:"previous_key" json:"previous_key,omitempty"`
+	PreviousSecret    string    `mapstructure:"previous_secret" json:"previous_secret,omitempty"`
+	PreviousExpiresAt time.Time `mapstructure:"previous_expires_at" json:"previous_expires_at"`
+
+	// PreviousSecrets are the additional secrets of the previous key, kept by the last rotation so the
+	// backends still signing with them keep working until PreviousExpiresAt.
+	PreviousSecrets []AppSecret `mapstructure:"previous_secrets" json:"previous_secrets,omitempty"`
+
+	// Disabled rejects the new connections and the api requests of the app.
+	Disabled bool `mapstructure:"disabled" json:"disabled"`
 
 	// MaxConnections configures the maximum number of concurrent connections allowed
-	// for this app.
-	MaxConnections int `mapstructure:"max_connections"`
+	// for this app. If the value is zero or negative, there is no connection limit.
+	MaxConnections int `mapstructure:"max_connections" json:"max_connections"`
 
 	// EnableClientMessages configures whether client side messaging is enabled for
 	// this app.
-	EnableClientMessages bool `mapstructure:"enable_client_messages"`
+	EnableClientMessages bool `mapstructure:"enable_client_messages" json:"enable_client_messages"`
+
+	// MaxClientEventsPerSecond limits the client events a single connection can send. If the
+	// value is zero or negative, there is no limit.
+	MaxClientEventsPerSecond int `mapstructure:"max_client_events_per_second" json:"max_client_events_per_second"`
+
+	// MaxAppClientEventsPerSecond limits the client events sent by all the connections of this
+	// app together. If the value is zero or negative, there is no limit.
+	MaxAppClientEventsPerSecond int `mapstructure:"max_app_client_events_per_second" json:"max_app_client_events_per_second"`
+
+	// CloseOnClientEventRateLimit configures whether connections going over the client event
+	// rate limits get disconnected instead of only having the events rejected.
+	CloseOnClientEventRateLimit bool `mapstructure:"close_on_client_event_rate_limit" json:"close_on_client_event_rate_limit"`
+
+	// MaxApiRequestsPerSecond limits the requests made to the http api of this app. If the value
+	// is zero or negative, there is no limit.
+	MaxApiRequestsPerSecond int `mapstructure:"max_api_requests_per_second" json:"max_api_requests_per_second"`
+
+	// MaxBackendEventsPerSecond limits the events triggered through the http api, counting every
+	// channel an event is sent to. If the value is zero or negative, there is no limit.
+	MaxBackendEventsPerSecond int `mapstructure:"max_backend_events_per_second" json:"max_backend_events_per_second"`
 
 	// MaxEventPayload configures the size of the maximum allowed payload size for events in
-	// kilobytes. It applies to both http api and websockets. If the value is negative, there
-	// is no payload size restriction.
-	MaxEventPayload int `mapstructure:"max_event_payload"`
+	// kilobytes. It applies to both http api and websockets. If the value is zero or negative,
+	// there is no payload size restriction.
+	MaxEventPayload int `mapstructure:"max_event_payload" json:"max_event_payload"`
+
+	// EnableSubscriptionCount configures whether the subscribers of the channels, except presence
+	// channels, receive the number of connections subscribed whenever it changes.
+	EnableSubscriptionCount bool `mapstructure:"enable_subscription_count" json:"enable_subscription_count"`
+
+	// MaxPresenceMembers limits the number of users in a presence channel. If the value is zero,
+	// the limit is 100 like pusher, if it's negative there is no limit.
+	MaxPresenceMembers int `mapstructure:"max_presence_members" json:"max_presence_members"`
+
+	// MaxPresenceUserInfoSize limits the size of the user_info of the presence members in kilobytes.
+	// If the value is zero, the limit is 1 KB like pusher, if it's negative there is no limit.
+	MaxPresenceUserInfoSize int `mapstructure:"max_presence_user_info_size" json:"max_presence_user_info_size"`
+
+	// MaxWatchlistSize limits the number of users a signed in user can watch. If the value is zero
+	// or negative, there is no limit.
+	MaxWatchlistSize int `mapstructure:"max_watchlist_size" json:"max_watchlist_size"`
+
+	// History configures the events recorded for the channels of this app.
+	History ChannelHistory `json:"history"`
+
+	// Webhooks configures the endpoints notified about the events happening in this app.
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+// AppSecret is an additional secret of an app, it's no longer accepted after NotAfter when it's set.
+type AppSecret struct {
+	Secret   string    `mapstructure:"secret" json:"secret"`
+	NotAfter time.Time `mapstructure:"not_after" json:"not_after"`
+}
+
+// Active returns true if the secret is still accepted.
+func (s AppSecret) Active() bool {
+	return s.NotAfter.IsZero() || time.Now().Before(s.NotAfter)
+}
+
+// ConnectionQuotaReached returns true if the app can not accept more connections when it already
+// has the given number of connections.
+func (a *App) ConnectionQuotaReached(connections int) bool {
+	return a.MaxConnections > 0 && connections >= a.MaxConnections
+}
+
+// PresenceMembersReached returns true if a presence channel with the given number of users can not
+// accept another user.
+func (a *App) PresenceMembersReached(members int) bool {
+	limit := a.MaxPresenceMembers
+	if limit == 0 {
+		limit = defaultMaxPresenceMembers
+	}
+
+	return limit > 0 && members >= limit
+}
+
+// PresenceUserInfoTooLarge returns true if a user_info of the given size in bytes exceeds the
+// MaxPresenceUserInfoSize limit.
+func (a *App) PresenceUserInfoTooLarge(size int) bool {
+	limit := a.MaxPresenceUserInfoSize
+	if limit == 0 {
+		limit = defaultMaxPresenceUserInfoSize
+	}
+
+	return limit > 0 && size > limit*1024
+}
+
+// WatchlistTooLarge returns true if a watchlist with the given number of users exceeds the
+// MaxWatchlistSize limit.
+func (a *App) WatchlistTooLarge(size int) bool {
+	return a.MaxWatchlistSize > 0 && size > a.MaxWatchlistSize
+}
+
+// EventPayloadTooLarge returns true if an event payload of the given size in bytes exceeds
+// the MaxEventPayload limit.
+func (a *App) EventPayloadTooLarge(size int) bool {
+	return a.MaxEventPayload > 0 && size > a.MaxEventPayload*1024
+}
+
+// HasKey returns true if the key is the app key, or its previous key during the grace period of a
+// rotation.
+func (a *App) HasKey(key string) bool {
+	return key == a.Key || (a.previousValid() && key == a.PreviousKey)
+}
+
+// VerifySignature returns true if the signature is the HMAC SHA256 of the data with any active
+// secret of the given app key.
+func (a *App) VerifySignature(key string, data, signature []byte) bool {
+	for _, secret := range a.secrets(key) {
+		hasher := hmac.New(sha256.New, []byte(secret))
+		hasher.Write(data)
+
+		if hmac.Equal(signature, hasher.Sum(nil)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Rotate replaces the key and secret of the app, keeping the current ones valid until expiresAt.
+// The active additional secrets move to the previous key, they are only valid for the replaced key.
+func (a *App) Rotate(key, secret string, expiresAt time.Time) {
+	var previousSecrets []AppSecret
+	for _, s := range a.Secrets {
+		if s.Active() {
+			previousSecrets = append(previousSecrets, s)
+		}
+	}
+
+	a.PreviousKey, a.PreviousSecret, a.PreviousExpiresAt, a.PreviousSecrets = a.Key, a.Secret, expiresAt, previousSecrets
+	a.Key, a.Secret, a.Secrets = key, secret, nil
+}
+
+// secrets returns the active secrets of the given app key.
+func (a *App) secrets(key string) []string {
+	switch {
+	case key == a.Key:
+		return activeSecrets(a.Secret, a.Secrets)
+	case a.previousValid() && key == a.PreviousKey:
+		return activeSecrets(a.PreviousSecret, a.PreviousSecrets)
+	default:
+		return nil
+	}
+}
+
+func activeSecrets(secret string, additional []AppSecret) []string {
+	secrets := []string{secret}
+	for _, s := range additional {
+		if s.Active() {
+			secrets = append(secrets, s.Secret)
+		}
+	}
+
+	return secrets
+}
+
+func (a *App) previousValid() bool {
+	return a.PreviousKey != "" && time.Now().Before(a.PreviousExpiresAt)
 }
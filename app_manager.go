@@ -13,3 +13,35 @@ type AppManager interface {
 	// GetAppSecret returns an app secret for the given app id.
 	GetAppSecret(ctx context.Context, id string) (string, error)
 }
+
+// AppCache is implemented by the app managers caching the apps, so an app changed in its storage
+// is reloaded on the next lookup instead of when it expires.
+type AppCache interface {
+	// InvalidateApp removes the app with the given id from the cache, along with its key.
+	InvalidateApp(id string)
+
+	// InvalidateKey removes the lookups of the given app key, e.g. when an app is created with a key
+	// which was looked up before.
+	InvalidateKey(key string)
+}
+
+// WritableAppManager is implemented by the app managers which can change the apps at runtime.
+type WritableAppManager interface {
+	AppManager
+
+	// ListApps returns all the apps.
+	ListApps(ctx context.Context) ([]*App, error)
+
+	// CreateApp adds a new app, its id and key must not be used by another app.
+	CreateApp(ctx context.Context, app *App) error
+
+	// UpdateApp replaces the app with the same id.
+	UpdateApp(ctx context.Context, app *App) error
+
+	// ModifyApp changes the app with the given id atomically, modify is given a copy of the current
+	// app and the result is stored unless modify returns an error. It returns the stored app.
+	ModifyApp(ctx context.Context, id string, modify func(app *App) error) (*App, error)
+
+	// DeleteApp removes the app with the given id.
+	DeleteApp(ctx context.Context, id string) error
+}
@@ -1,23 +1,73 @@
 package appmanagers
 
 import (
+	"encoding/json"
 	"errors"
+	"time"
 
 	"github.com/gsockets/gsockets"
 	"github.com/gsockets/gsockets/config"
+	"github.com/mitchellh/mapstructure"
 )
 
 var (
 	ErrInvalidAppManagerDriver = errors.New("invalid driver for app manager")
-	ErrInvalidAppKey = errors.New("invalid appKey, no app exists with the given appKey")
-	ErrInvalidAppId = errors.New("invalid app id, no app exists with the given id")
+	ErrInvalidAppKey           = errors.New("invalid appKey, no app exists with the given appKey")
+	ErrInvalidAppId            = errors.New("invalid app id, no app exists with the given id")
+	ErrAppExists               = errors.New("an app already exists with the given id or key")
+	ErrReadOnlyAppManager      = errors.New("the apps of the app manager can not be changed")
 )
 
 func New(appManagerConfig config.AppManager) (gsockets.AppManager, error) {
+	apps, err := newDriver(appManagerConfig)
+	if err != nil || !appManagerConfig.Cache.Enabled {
+		return apps, err
+	}
+
+	return newCachedAppManager(apps, appManagerConfig.Cache), nil
+}
+
+func newDriver(appManagerConfig config.AppManager) (gsockets.AppManager, error) {
 	switch appManagerConfig.Driver {
 	case "array":
 		return newConfigAppManager(appManagerConfig.Array), nil
+	case "sql":
+		return newSqlAppManager(appManagerConfig.Sql)
+	case "http":
+		return newHttpAppManager(appManagerConfig.Http)
 	default:
 		return nil, ErrInvalidAppManagerDriver
 	}
 }
+
+// DecodeApp decodes an app from json using the same keys as the config file, the durations can be
+// given as strings like "1h".
+func DecodeApp(data []byte) (gsockets.App, error) {
+	var app gsockets.App
+
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return app, err
+	}
+
+	err := decodeConfig(raw, &app)
+
+	return app, err
+}
+
+// decodeConfig decodes the apps read from json into their config structs, using the same keys as
+// the config file.
+func decodeConfig(input, output any) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToTimeHookFunc(time.RFC3339),
+		),
+		Result: output,
+	})
+	if err != nil {
+		return err
+	}
+
+	return decoder.Decode(input)
+}
@@ -0,0 +1,307 @@
+package appmanagers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/config"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultCacheTtl         = time.Minute
+	defaultCacheNegativeTtl = 10 * time.Second
+
+	// cacheSweepInterval is how often the expired entries are removed from the cache.
+	cacheSweepInterval = time.Minute
+
+	// cacheLoadTimeout bounds the lookups shared by the callers, which are not canceled with any of
+	// them. It leaves room for the retries of the http app manager.
+	cacheLoadTimeout = 30 * time.Second
+)
+
+// cacheEntry is the result of a lookup, err is only set for the unknown apps.
+type cacheEntry struct {
+	app     *gsockets.App
+	err     error
+	expires time.Time
+}
+
+// cachedAppManager caches the lookups of the wrapped app manager. Concurrent lookups of the same
+// app missing the cache share a single request to the wrapped app manager. The apps changed through
+// the cache are only removed from the cache of this node, the other nodes keep serving the cached
+// app until it expires, after the ttl.
+type cachedAppManager struct {
+	apps        gsockets.AppManager
+	ttl         time.Duration
+	negativeTtl time.Duration
+
+	entries map[string]cacheEntry
+	sweptAt time.Time
+
+	// generation is incremented on every invalidation, so the lookups started before it don't cache
+	// the apps they loaded.
+	generation uint64
+	lock       sync.Mutex
+
+	loads singleflight.Group
+}
+
+func newCachedAppManager(apps gsockets.AppManager, config config.AppManagerCache) gsockets.AppManager {
+	if config.Ttl <= 0 {
+		config.Ttl = defaultCacheTtl
+	}
+
+	if config.NegativeTtl == 0 {
+		config.NegativeTtl = defaultCacheNegativeTtl
+	}
+
+	return &cachedAppManager{
+		apps:        apps,
+		ttl:         config.Ttl,
+		negativeTtl: config.NegativeTtl,
+		entries:     make(map[string]cacheEntry),
+		sweptAt:     time.Now(),
+	}
+}
+
+func idCacheKey(id string) string {
+	return "id#" + id
+}
+
+func keyCacheKey(key string) string {
+	return "key#" + key
+}
+
+// FindById returns an app instance by the app id.
+func (c *cachedAppManager) FindById(ctx context.Context, id string) (*gsockets.App, error) {
+	return c.lookup(ctx, idCacheKey(id), func(ctx context.Context) (*gsockets.App, error) {
+		return c.apps.FindById(ctx, id)
+	})
+}
+
+// FindByKey returns an app instance by app key.
+func (c *cachedAppManager) FindByKey(ctx context.Context, key string) (*gsockets.App, error) {
+	return c.lookup(ctx, keyCacheKey(key), func(ctx context.Context) (*gsockets.App, error) {
+		return c.apps.FindByKey(ctx, key)
+	})
+}
+
+// GetAppSecret returns an app secret for the given app id.
+func (c *cachedAppManager) GetAppSecret(ctx context.Context, id string) (string, error) {
+	app, err := c.FindById(ctx, id)
+	if errors.Is(err, ErrInvalidAppId) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return app.Secret, nil
+}
+
+// InvalidateApp removes the app with the given id from the cache, along with its key.
+func (c *cachedAppManager) InvalidateApp(id string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.generation++
+	c.forget(idCacheKey(id))
+
+	for cacheKey, entry := range c.entries {
+		if entry.app != nil && entry.app.ID == id {
+			c.forget(cacheKey)
+		}
+	}
+}
+
+// InvalidateKey removes the lookups of the given app key.
+func (c *cachedAppManager) InvalidateKey(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.generation++
+	c.forget(keyCacheKey(key))
+}
+
+// forget removes the entry and lets the next lookup start a new load instead of waiting for the
+// one in flight. It must be called with the lock held.
+func (c *cachedAppManager) forget(cacheKey string) {
+	delete(c.entries, cacheKey)
+	c.loads.Forget(cacheKey)
+}
+
+// ListApps returns all the apps of the wrapped app manager, the list is not cached.
+func (c *cachedAppManager) ListApps(ctx context.Context) ([]*gsockets.App, error) {
+	apps, ok := c.apps.(gsockets.WritableAppManager)
+	if !ok {
+		return nil, ErrReadOnlyAppManager
+	}
+
+	return apps.ListApps(ctx)
+}
+
+// CreateApp adds the app to the wrapped app manager, its key may have been cached as unknown.
+func (c *cachedAppManager) CreateApp(ctx context.Context, app *gsockets.App) error {
+	apps, ok := c.apps.(gsockets.WritableAppManager)
+	if !ok {
+		return ErrReadOnlyAppManager
+	}
+
+	defer c.invalidate(app)
+
+	return apps.CreateApp(ctx, app)
+}
+
+// UpdateApp replaces the app in the wrapped app manager and removes it from the cache.
+func (c *cachedAppManager) UpdateApp(ctx context.Context, app *gsockets.App) error {
+	apps, ok := c.apps.(gsockets.WritableAppManager)
+	if !ok {
+		return ErrReadOnlyAppManager
+	}
+
+	defer c.invalidate(app)
+
+	return apps.UpdateApp(ctx, app)
+}
+
+// ModifyApp changes the app in the wrapped app manager and removes it from the cache, along with
+// the keys it had before the change.
+func (c *cachedAppManager) ModifyApp(ctx context.Context, id string, modify func(app *gsockets.App) error) (*gsockets.App, error) {
+	apps, ok := c.apps.(gsockets.WritableAppManager)
+	if !ok {
+		return nil, ErrReadOnlyAppManager
+	}
+
+	var before *gsockets.App
+	app, err := apps.ModifyApp(ctx, id, func(app *gsockets.App) error {
+		previous := *app
+		before = &previous
+
+		return modify(app)
+	})
+
+	if before != nil {
+		c.invalidate(before)
+	}
+
+	if app != nil {
+		c.invalidate(app)
+	}
+
+	return app, err
+}
+
+// DeleteApp removes the app from the wrapped app manager and from the cache.
+func (c *cachedAppManager) DeleteApp(ctx context.Context, id string) error {
+	apps, ok := c.apps.(gsockets.WritableAppManager)
+	if !ok {
+		return ErrReadOnlyAppManager
+	}
+
+	defer c.InvalidateApp(id)
+
+	return apps.DeleteApp(ctx, id)
+}
+
+// invalidate removes the app and the lookups of its keys from the cache.
+func (c *cachedAppManager) invalidate(app *gsockets.App) {
+	c.InvalidateApp(app.ID)
+	c.InvalidateKey(app.Key)
+
+	if app.PreviousKey != "" {
+		c.InvalidateKey(app.PreviousKey)
+	}
+}
+
+// Close closes the wrapped app manager when it holds a connection to its storage.
+func (c *cachedAppManager) Close() error {
+	if closer, ok := c.apps.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+func (c *cachedAppManager) lookup(ctx context.Context, cacheKey string, load func(context.Context) (*gsockets.App, error)) (*gsockets.App, error) {
+	c.lock.Lock()
+	entry, ok := c.entries[cacheKey]
+	generation := c.generation
+	c.lock.Unlock()
+
+	if ok && time.Now().Before(entry.expires) {
+		return entry.app, entry.err
+	}
+
+	// The load is shared with the concurrent callers, so it runs detached from the context of the
+	// caller starting it, while every caller still stops waiting once its own context is done.
+	loads := c.loads.DoChan(cacheKey, func() (any, error) {
+		ctx, cancel := context.WithTimeout(trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx)), cacheLoadTimeout)
+		defer cancel()
+
+		app, err := load(ctx)
+		c.store(cacheKey, generation, app, err)
+
+		return app, err
+	})
+
+	select {
+	case res := <-loads:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+
+		return res.Val.(*gsockets.App), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// store caches the result of a lookup, the apps found are cached by both their id and key. Only
+// the errors for unknown apps are cached. The apps found by a previous key are not cached past the
+// end of the rotation grace period.
+func (c *cachedAppManager) store(cacheKey string, generation uint64, app *gsockets.App, err error) {
+	now := time.Now()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	switch {
+	case err == nil && app != nil:
+		entry := cacheEntry{app: app, expires: now.Add(c.ttl)}
+		if app.PreviousExpiresAt.After(now) && app.PreviousExpiresAt.Before(entry.expires) {
+			entry.expires = app.PreviousExpiresAt
+		}
+
+		c.entries[cacheKey] = entry
+		c.entries[idCacheKey(app.ID)] = entry
+		c.entries[keyCacheKey(app.Key)] = entry
+	case c.negativeTtl > 0 && (errors.Is(err, ErrInvalidAppId) || errors.Is(err, ErrInvalidAppKey)):
+		c.entries[cacheKey] = cacheEntry{err: err, expires: now.Add(c.negativeTtl)}
+	}
+
+	if now.Sub(c.sweptAt) > cacheSweepInterval {
+		c.sweep(now)
+	}
+}
+
+// sweep removes the expired entries. It must be called with the lock held.
+func (c *cachedAppManager) sweep(now time.Time) {
+	for cacheKey, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, cacheKey)
+		}
+	}
+
+	c.sweptAt = now
+}
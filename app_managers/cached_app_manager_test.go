@@ -0,0 +1,283 @@
+package appmanagers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingAppManager counts the lookups reaching the config app manager, holding them until release
+// is closed when it's set. The held lookups fail if their context is done meanwhile.
+type countingAppManager struct {
+	gsockets.AppManager
+
+	lookups int32
+	release chan struct{}
+	err     error
+}
+
+func newCountingAppManager() *countingAppManager {
+	return &countingAppManager{AppManager: newConfigAppManager(getConfig())}
+}
+
+func (c *countingAppManager) wait(ctx context.Context) error {
+	atomic.AddInt32(&c.lookups, 1)
+	if c.release != nil {
+		<-c.release
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return c.err
+}
+
+func (c *countingAppManager) FindById(ctx context.Context, id string) (*gsockets.App, error) {
+	if err := c.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	return c.AppManager.FindById(ctx, id)
+}
+
+func (c *countingAppManager) FindByKey(ctx context.Context, key string) (*gsockets.App, error) {
+	if err := c.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	return c.AppManager.FindByKey(ctx, key)
+}
+
+func (c *countingAppManager) count() int {
+	return int(atomic.LoadInt32(&c.lookups))
+}
+
+func TestNewReturnsCachedAppManager(t *testing.T) {
+	appManager, err := New(config.AppManager{Driver: "array", Cache: config.AppManagerCache{Enabled: true}})
+
+	assert.Nil(t, err)
+
+	_, ok := appManager.(*cachedAppManager)
+	assert.True(t, ok, "got invalid app manager implementation")
+}
+
+func TestCachedAppManagerCachesApps(t *testing.T) {
+	apps := newCountingAppManager()
+	manager := newCachedAppManager(apps, config.AppManagerCache{Ttl: time.Minute})
+
+	for i := 0; i < 3; i++ {
+		app, err := manager.FindById(context.Background(), "1234")
+		assert.Nil(t, err)
+		assert.Equal(t, "app-key", app.Key)
+	}
+
+	// The app found by id is cached by key as well.
+	app, err := manager.FindByKey(context.Background(), "app-key")
+	assert.Nil(t, err)
+	assert.Equal(t, "1234", app.ID)
+
+	secret, err := manager.GetAppSecret(context.Background(), "1234")
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", secret)
+
+	assert.Equal(t, 1, apps.count())
+}
+
+func TestCachedAppManagerExpiresApps(t *testing.T) {
+	apps := newCountingAppManager()
+	manager := newCachedAppManager(apps, config.AppManagerCache{Ttl: 20 * time.Millisecond})
+
+	_, _ = manager.FindById(context.Background(), "1234")
+	time.Sleep(30 * time.Millisecond)
+	_, _ = manager.FindById(context.Background(), "1234")
+
+	assert.Equal(t, 2, apps.count())
+}
+
+func TestCachedAppManagerCachesUnknownApps(t *testing.T) {
+	apps := newCountingAppManager()
+	manager := newCachedAppManager(apps, config.AppManagerCache{})
+
+	for i := 0; i < 3; i++ {
+		_, err := manager.FindByKey(context.Background(), "unknown")
+		assert.ErrorIs(t, err, ErrInvalidAppKey)
+
+		_, err = manager.FindById(context.Background(), "unknown")
+		assert.ErrorIs(t, err, ErrInvalidAppId)
+	}
+
+	assert.Equal(t, 2, apps.count())
+
+	// Unknown apps are looked up every time when the negative cache is disabled.
+	apps = newCountingAppManager()
+	manager = newCachedAppManager(apps, config.AppManagerCache{NegativeTtl: -1})
+
+	_, _ = manager.FindByKey(context.Background(), "unknown")
+	_, _ = manager.FindByKey(context.Background(), "unknown")
+
+	assert.Equal(t, 2, apps.count())
+}
+
+func TestCachedAppManagerDoesNotCacheErrors(t *testing.T) {
+	apps := newCountingAppManager()
+	apps.err = errors.New("storage unavailable")
+	manager := newCachedAppManager(apps, config.AppManagerCache{})
+
+	_, err := manager.FindById(context.Background(), "1234")
+	assert.ErrorIs(t, err, apps.err)
+
+	apps.err = nil
+
+	app, err := manager.FindById(context.Background(), "1234")
+	assert.Nil(t, err)
+	assert.Equal(t, "1234", app.ID)
+	assert.Equal(t, 2, apps.count())
+}
+
+func TestCachedAppManagerSharesConcurrentLookups(t *testing.T) {
+	apps := newCountingAppManager()
+	apps.release = make(chan struct{})
+	manager := newCachedAppManager(apps, config.AppManagerCache{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			app, err := manager.FindByKey(context.Background(), "app-key")
+			assert.Nil(t, err)
+			assert.Equal(t, "1234", app.ID)
+		}()
+	}
+
+	assert.Eventually(t, func() bool { return apps.count() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	close(apps.release)
+
+	wg.Wait()
+	assert.Equal(t, 1, apps.count())
+}
+
+func TestCachedAppManagerIgnoresCanceledCaller(t *testing.T) {
+	apps := newCountingAppManager()
+	apps.release = make(chan struct{})
+	manager := newCachedAppManager(apps, config.AppManagerCache{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error)
+	go func() {
+		_, err := manager.FindById(ctx, "1234")
+		canceled <- err
+	}()
+
+	assert.Eventually(t, func() bool { return apps.count() == 1 }, time.Second, time.Millisecond)
+
+	shared := make(chan *gsockets.App)
+	go func() {
+		app, _ := manager.FindById(context.Background(), "1234")
+		shared <- app
+	}()
+
+	// The caller that started the lookup leaves, the lookup goes on for the other caller.
+	cancel()
+	select {
+	case err := <-canceled:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("the canceled caller must not wait for the lookup")
+	}
+
+	close(apps.release)
+
+	app := <-shared
+	if assert.NotNil(t, app) {
+		assert.Equal(t, "1234", app.ID)
+	}
+
+	assert.Equal(t, 1, apps.count())
+}
+
+func TestCachedAppManagerInvalidation(t *testing.T) {
+	apps := newCountingAppManager()
+	manager := newCachedAppManager(apps, config.AppManagerCache{})
+	cache := manager.(gsockets.AppCache)
+
+	_, _ = manager.FindByKey(context.Background(), "app-key")
+	cache.InvalidateApp("1234")
+
+	// Both the id and the key of the app are reloaded.
+	_, _ = manager.FindByKey(context.Background(), "app-key")
+	assert.Equal(t, 2, apps.count())
+
+	cache.InvalidateApp("1234")
+	_, _ = manager.FindById(context.Background(), "1234")
+	assert.Equal(t, 3, apps.count())
+
+	_, err := manager.FindByKey(context.Background(), "unknown")
+	assert.ErrorIs(t, err, ErrInvalidAppKey)
+
+	cache.InvalidateKey("unknown")
+	_, _ = manager.FindByKey(context.Background(), "unknown")
+	assert.Equal(t, 5, apps.count())
+}
+
+func TestCachedAppManagerInvalidationDuringLookup(t *testing.T) {
+	apps := newCountingAppManager()
+	apps.release = make(chan struct{})
+	manager := newCachedAppManager(apps, config.AppManagerCache{})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = manager.FindById(context.Background(), "1234")
+	}()
+
+	assert.Eventually(t, func() bool { return apps.count() == 1 }, time.Second, time.Millisecond)
+
+	// The app loaded before the invalidation may be stale, it must not be cached.
+	manager.(gsockets.AppCache).InvalidateApp("1234")
+	close(apps.release)
+	<-done
+
+	_, _ = manager.FindById(context.Background(), "1234")
+	assert.Equal(t, 2, apps.count())
+}
+
+func TestCachedAppManagerWritesInvalidate(t *testing.T) {
+	manager := newCachedAppManager(newConfigAppManager(getConfig()), config.AppManagerCache{}).(gsockets.WritableAppManager)
+	ctx := context.Background()
+
+	_, err := manager.FindByKey(ctx, "new-key")
+	assert.ErrorIs(t, err, ErrInvalidAppKey)
+
+	// The key cached as unknown is found once the app is created.
+	assert.Nil(t, manager.CreateApp(ctx, &gsockets.App{ID: "5678", Key: "new-key"}))
+
+	app, err := manager.FindByKey(ctx, "new-key")
+	assert.Nil(t, err)
+	assert.Equal(t, "5678", app.ID)
+
+	assert.Nil(t, manager.UpdateApp(ctx, &gsockets.App{ID: "5678", Key: "new-key", Disabled: true}))
+
+	app, err = manager.FindById(ctx, "5678")
+	assert.Nil(t, err)
+	assert.True(t, app.Disabled)
+
+	assert.Nil(t, manager.DeleteApp(ctx, "5678"))
+
+	_, err = manager.FindByKey(ctx, "new-key")
+	assert.ErrorIs(t, err, ErrInvalidAppKey)
+
+	// The writes are rejected when the wrapped app manager can't change the apps.
+	readOnly := newCachedAppManager(&countingAppManager{}, config.AppManagerCache{}).(gsockets.WritableAppManager)
+	assert.ErrorIs(t, readOnly.DeleteApp(ctx, "1234"), ErrReadOnlyAppManager)
+}
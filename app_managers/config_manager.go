@@ -2,25 +2,36 @@ package appmanagers
 
 import (
 	"context"
+	"sort"
+	"sync"
 
 	"github.com/gsockets/gsockets"
 )
 
+// configAppManager keeps the apps from the config in memory. The apps changed at runtime are only
+// changed on this node, and until it restarts.
 type configAppManager struct {
 	apps map[string]*gsockets.App
+
+	// keys maps the current and previous keys of the apps to their ids.
+	keys map[string]string
+	lock sync.RWMutex
 }
 
 func newConfigAppManager(appsConfig []gsockets.App) gsockets.AppManager {
-	apps := make(map[string]*gsockets.App)
-	for _, app := range appsConfig {
-		apps[app.ID] = &app
+	manager := &configAppManager{apps: make(map[string]*gsockets.App), keys: make(map[string]string)}
+	for i := range appsConfig {
+		manager.setUnlocked(&appsConfig[i])
 	}
 
-	return &configAppManager{apps: apps}
+	return manager
 }
 
 // FindById returns an app instance by the app id.
 func (config *configAppManager) FindById(ctx context.Context, id string) (*gsockets.App, error) {
+	config.lock.RLock()
+	defer config.lock.RUnlock()
+
 	app, ok := config.apps[id]
 	if !ok {
 		return nil, ErrInvalidAppId
@@ -31,13 +42,15 @@ func (config *configAppManager) FindById(ctx context.Context, id string) (*gsock
 
 // FindByKey returns an app instance by app key.
 func (config *configAppManager) FindByKey(ctx context.Context, key string) (*gsockets.App, error) {
-	for _, app := range config.apps {
-		if app.Key == key {
-			return app, nil
-		}
+	config.lock.RLock()
+	defer config.lock.RUnlock()
+
+	app, ok := config.apps[config.keys[key]]
+	if !ok || !app.HasKey(key) {
+		return nil, ErrInvalidAppKey
 	}
 
-	return nil, ErrInvalidAppKey
+	return app, nil
 }
 
 // FindBySecret returns an app instance by app secret.
@@ -50,3 +63,118 @@ func (config *configAppManager) GetAppSecret(ctx context.Context, id string) (st
 
 	return app.Secret, nil
 }
+
+// ListApps returns all the apps sorted by id.
+func (config *configAppManager) ListApps(ctx context.Context) ([]*gsockets.App, error) {
+	config.lock.RLock()
+	defer config.lock.RUnlock()
+
+	apps := make([]*gsockets.App, 0, len(config.apps))
+	for _, app := range config.apps {
+		apps = append(apps, app)
+	}
+
+	sort.Slice(apps, func(i, j int) bool { return apps[i].ID < apps[j].ID })
+
+	return apps, nil
+}
+
+// CreateApp adds a new app, its id and key must not be used by another app.
+func (config *configAppManager) CreateApp(ctx context.Context, app *gsockets.App) error {
+	config.lock.Lock()
+	defer config.lock.Unlock()
+
+	if _, ok := config.apps[app.ID]; ok || config.keyInUseUnlocked(app) {
+		return ErrAppExists
+	}
+
+	config.setUnlocked(app)
+
+	return nil
+}
+
+// UpdateApp replaces the app with the same id.
+func (config *configAppManager) UpdateApp(ctx context.Context, app *gsockets.App) error {
+	config.lock.Lock()
+	defer config.lock.Unlock()
+
+	if _, ok := config.apps[app.ID]; !ok {
+		return ErrInvalidAppId
+	}
+
+	if config.keyInUseUnlocked(app) {
+		return ErrAppExists
+	}
+
+	config.deleteUnlocked(app.ID)
+	config.setUnlocked(app)
+
+	return nil
+}
+
+// ModifyApp changes the app with the given id while holding the lock, so concurrent changes are not lost.
+func (config *configAppManager) ModifyApp(ctx context.Context, id string, modify func(app *gsockets.App) error) (*gsockets.App, error) {
+	config.lock.Lock()
+	defer config.lock.Unlock()
+
+	existing, ok := config.apps[id]
+	if !ok {
+		return nil, ErrInvalidAppId
+	}
+
+	app := *existing
+	if err := modify(&app); err != nil {
+		return nil, err
+	}
+
+	app.ID = id
+	if config.keyInUseUnlocked(&app) {
+		return nil, ErrAppExists
+	}
+
+	config.deleteUnlocked(id)
+	config.setUnlocked(&app)
+
+	return &app, nil
+}
+
+// DeleteApp removes the app with the given id.
+func (config *configAppManager) DeleteApp(ctx context.Context, id string) error {
+	config.lock.Lock()
+	defer config.lock.Unlock()
+
+	if _, ok := config.apps[id]; !ok {
+		return ErrInvalidAppId
+	}
+
+	config.deleteUnlocked(id)
+
+	return nil
+}
+
+// keyInUseUnlocked returns true if the key of the app is a valid key of another app.
+func (config *configAppManager) keyInUseUnlocked(app *gsockets.App) bool {
+	existing, ok := config.apps[config.keys[app.Key]]
+	return ok && existing.ID != app.ID && existing.HasKey(app.Key)
+}
+
+func (config *configAppManager) setUnlocked(app *gsockets.App) {
+	config.apps[app.ID] = app
+	config.keys[app.Key] = app.ID
+
+	// An expired previous key may have been taken by another app since.
+	if _, ok := config.keys[app.PreviousKey]; app.PreviousKey != "" && !ok {
+		config.keys[app.PreviousKey] = app.ID
+	}
+}
+
+func (config *configAppManager) deleteUnlocked(id string) {
+	app := config.apps[id]
+	delete(config.apps, id)
+
+	for _, key := range []string{app.Key, app.PreviousKey} {
+		if config.keys[key] == id {
+			delete(config.keys, key)
+		}
+	}
+}
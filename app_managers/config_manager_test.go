@@ -2,7 +2,9 @@ package appmanagers
 
 import (
 	"context"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gsockets/gsockets"
 	"github.com/stretchr/testify/assert"
@@ -94,3 +96,88 @@ func TestGetAppSecretForInvalidApp(t *testing.T) {
 	assert.Nil(t, err, "no error should be returned even if value does not exists")
 	assert.Equal(t, "", secret, "secret should return blank string for invalid app")
 }
+
+func TestConfigAppManagerWrites(t *testing.T) {
+	manager := newConfigAppManager(getConfig()).(gsockets.WritableAppManager)
+	ctx := context.Background()
+
+	app := &gsockets.App{ID: "5678", Key: "other-key", Secret: "other-secret"}
+	assert.Nil(t, manager.CreateApp(ctx, app), "a new app should be created")
+	assert.ErrorIs(t, manager.CreateApp(ctx, &gsockets.App{ID: "5678", Key: "unused"}), ErrAppExists, "the id must be unique")
+	assert.ErrorIs(t, manager.CreateApp(ctx, &gsockets.App{ID: "unused", Key: "app-key"}), ErrAppExists, "the key must be unique")
+
+	updated := &gsockets.App{ID: "5678", Key: "changed-key", Secret: "other-secret", Disabled: true}
+	assert.Nil(t, manager.UpdateApp(ctx, updated), "an existing app should be updated")
+	assert.ErrorIs(t, manager.UpdateApp(ctx, &gsockets.App{ID: "unknown"}), ErrInvalidAppId, "an unknown app can not be updated")
+
+	found, err := manager.FindByKey(ctx, "changed-key")
+	assert.Nil(t, err)
+	assert.Equal(t, updated, found, "the app should be found by its new key")
+
+	_, err = manager.FindByKey(ctx, "other-key")
+	assert.ErrorIs(t, err, ErrInvalidAppKey, "the old key should be removed")
+
+	apps, err := manager.ListApps(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, apps, 2)
+
+	assert.Nil(t, manager.DeleteApp(ctx, "5678"), "an existing app should be deleted")
+	assert.ErrorIs(t, manager.DeleteApp(ctx, "5678"), ErrInvalidAppId, "an unknown app can not be deleted")
+}
+
+func TestConfigAppManagerModifyApp(t *testing.T) {
+	manager := newConfigAppManager(getConfig()).(gsockets.WritableAppManager)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := manager.ModifyApp(ctx, "1234", func(app *gsockets.App) error {
+				app.MaxPresenceMembers++
+				return nil
+			})
+			assert.Nil(t, err)
+		}()
+	}
+
+	wg.Wait()
+
+	found, err := manager.FindById(ctx, "1234")
+	assert.Nil(t, err)
+	assert.Equal(t, 20, found.MaxPresenceMembers, "no concurrent change should be lost")
+
+	_, err = manager.ModifyApp(ctx, "unknown", func(app *gsockets.App) error { return nil })
+	assert.ErrorIs(t, err, ErrInvalidAppId)
+
+	assert.Nil(t, manager.CreateApp(ctx, &gsockets.App{ID: "5678", Key: "other-key"}))
+	_, err = manager.ModifyApp(ctx, "5678", func(app *gsockets.App) error {
+		app.Key = "app-key"
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrAppExists, "the key must be unique")
+}
+
+func TestConfigAppManagerFindByPreviousKey(t *testing.T) {
+	manager := newConfigAppManager(getConfig()).(gsockets.WritableAppManager)
+	ctx := context.Background()
+
+	app, _ := manager.FindById(ctx, "1234")
+	rotated := *app
+	rotated.Rotate("rotated-key", "rotated-secret", time.Now().Add(time.Hour))
+	assert.Nil(t, manager.UpdateApp(ctx, &rotated))
+
+	found, err := manager.FindByKey(ctx, "app-key")
+	assert.Nil(t, err, "the previous key should be valid during the grace period")
+	assert.Equal(t, "rotated-key", found.Key)
+
+	rotated.PreviousExpiresAt = time.Now().Add(-time.Second)
+	assert.Nil(t, manager.UpdateApp(ctx, &rotated))
+
+	_, err = manager.FindByKey(ctx, "app-key")
+	assert.ErrorIs(t, err, ErrInvalidAppKey, "the previous key should be rejected after the grace period")
+
+	assert.Nil(t, manager.CreateApp(ctx, &gsockets.App{ID: "5678", Key: "app-key"}), "an expired previous key can be reused")
+}
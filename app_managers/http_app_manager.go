@@ -0,0 +1,173 @@
+package appmanagers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/config"
+)
+
+const (
+	defaultHttpTimeout     = 5 * time.Second
+	defaultHttpMaxAttempts = 3
+	defaultHttpRetryDelay  = 100 * time.Millisecond
+)
+
+var ErrInvalidAppManagerUrl = errors.New("an url is required for the http app manager")
+
+// errAppNotFound is returned by lookup when the endpoint has no app for the query.
+var errAppNotFound = errors.New("app not found")
+
+// httpAppManager requests the apps from an external service on every lookup. The service replies
+// with the app as a json object using the same keys as the config file, or with 404 when no app
+// matches the query.
+type httpAppManager struct {
+	config config.HttpAppManager
+	client *http.Client
+}
+
+func newHttpAppManager(config config.HttpAppManager) (gsockets.AppManager, error) {
+	if config.Url == "" {
+		return nil, ErrInvalidAppManagerUrl
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = defaultHttpTimeout
+	}
+
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaultHttpMaxAttempts
+	}
+
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = defaultHttpRetryDelay
+	}
+
+	return &httpAppManager{config: config, client: &http.Client{}}, nil
+}
+
+// FindById returns an app instance by the app id.
+func (h *httpAppManager) FindById(ctx context.Context, id string) (*gsockets.App, error) {
+	app, err := h.lookup(ctx, url.Values{"id": {id}})
+	if errors.Is(err, errAppNotFound) {
+		return nil, ErrInvalidAppId
+	}
+
+	return app, err
+}
+
+// FindByKey returns an app instance by app key.
+func (h *httpAppManager) FindByKey(ctx context.Context, key string) (*gsockets.App, error) {
+	app, err := h.lookup(ctx, url.Values{"key": {key}})
+	if errors.Is(err, errAppNotFound) {
+		return nil, ErrInvalidAppKey
+	}
+
+	return app, err
+}
+
+// GetAppSecret returns an app secret for the given app id.
+func (h *httpAppManager) GetAppSecret(ctx context.Context, id string) (string, error) {
+	app, err := h.lookup(ctx, url.Values{"id": {id}})
+	if errors.Is(err, errAppNotFound) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return app.Secret, nil
+}
+
+// lookup requests the app matching the query, retrying the failed requests until the attempts run
+// out or the context is done.
+func (h *httpAppManager) lookup(ctx context.Context, query url.Values) (*gsockets.App, error) {
+	delay := h.config.RetryDelay
+
+	for attempt := 1; ; attempt++ {
+		app, retry, err := h.request(ctx, query)
+		if !retry || attempt >= h.config.MaxAttempts {
+			return app, err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		delay *= 2
+	}
+}
+
+// request makes a single request for the app, returning whether the request can be retried when
+// it fails.
+func (h *httpAppManager) request(ctx context.Context, query url.Values) (*gsockets.App, bool, error) {
+	attemptCtx, cancel := context.WithTimeout(ctx, h.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(attemptCtx, http.MethodGet, h.config.Url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	req.URL.RawQuery = query.Encode()
+	h.sign(req)
+
+	res, err := h.client.Do(req)
+	if err != nil {
+		// The lookup is abandoned once the caller is gone, the timeout of a single attempt is retried.
+		return nil, ctx.Err() == nil, err
+	}
+
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return nil, false, errAppNotFound
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500:
+		return nil, true, fmt.Errorf("unexpected status code %d", res.StatusCode)
+	case res.StatusCode != http.StatusOK:
+		return nil, false, fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, true, err
+	}
+
+	app, err := DecodeApp(body)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &app, false, nil
+}
+
+// sign sets the headers the endpoint uses to verify the requests come from gsockets.
+func (h *httpAppManager) sign(req *http.Request) {
+	if h.config.Secret == "" {
+		return
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	hasher := hmac.New(sha256.New, []byte(h.config.Secret))
+	hasher.Write([]byte(timestamp + "\n" + req.Method + "\n" + req.URL.RequestURI()))
+
+	req.Header.Set("X-Gsockets-Timestamp", timestamp)
+	req.Header.Set("X-Gsockets-Signature", hex.EncodeToString(hasher.Sum(nil)))
+}
@@ -0,0 +1,179 @@
+package appmanagers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/config"
+	"github.com/stretchr/testify/assert"
+)
+
+const testRegistryApp = `{
+	"id": "1234",
+	"key": "app-key",
+	"secret": "secret",
+	"max_connections": 10,
+	"enable_client_messages": true,
+	"history": {"enabled": true, "max_age": "1m"},
+	"webhooks": [{"url": "http://localhost/hooks", "event_types": ["channel_occupied"]}]
+}`
+
+// newTestRegistry serves the test app by id and key, verifying the signature of the requests.
+func newTestRegistry(t *testing.T, secret string) *httptest.Server {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hasher := hmac.New(sha256.New, []byte(secret))
+		hasher.Write([]byte(r.Header.Get("X-Gsockets-Timestamp") + "\n" + r.Method + "\n" + r.URL.RequestURI()))
+
+		if r.Header.Get("X-Gsockets-Signature") != hex.EncodeToString(hasher.Sum(nil)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		query := r.URL.Query()
+		if query.Get("id") != "1234" && query.Get("key") != "app-key" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_, _ = w.Write([]byte(testRegistryApp))
+	}))
+
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+func TestHttpAppManagerLookups(t *testing.T) {
+	ts := newTestRegistry(t, "registry-secret")
+
+	manager, err := New(config.AppManager{Driver: "http", Http: config.HttpAppManager{Url: ts.URL, Secret: "registry-secret"}})
+	assert.Nil(t, err)
+
+	expected := gsockets.App{
+		ID:                   "1234",
+		Key:                  "app-key",
+		Secret:               "secret",
+		MaxConnections:       10,
+		EnableClientMessages: true,
+		History:              gsockets.ChannelHistory{Enabled: true, MaxAge: time.Minute},
+		Webhooks:             []gsockets.Webhook{{Url: "http://localhost/hooks", EventTypes: []string{"channel_occupied"}}},
+	}
+
+	app, err := manager.FindById(context.Background(), "1234")
+	assert.Nil(t, err)
+	assert.Equal(t, expected, *app)
+
+	app, err = manager.FindByKey(context.Background(), "app-key")
+	assert.Nil(t, err)
+	assert.Equal(t, expected, *app)
+
+	secret, err := manager.GetAppSecret(context.Background(), "1234")
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", secret)
+
+	_, err = manager.FindById(context.Background(), "unknown")
+	assert.ErrorIs(t, err, ErrInvalidAppId)
+
+	_, err = manager.FindByKey(context.Background(), "unknown")
+	assert.ErrorIs(t, err, ErrInvalidAppKey)
+
+	secret, err = manager.GetAppSecret(context.Background(), "unknown")
+	assert.Nil(t, err)
+	assert.Empty(t, secret)
+}
+
+func TestHttpAppManagerRejectedSignature(t *testing.T) {
+	ts := newTestRegistry(t, "registry-secret")
+
+	manager, err := New(config.AppManager{Driver: "http", Http: config.HttpAppManager{Url: ts.URL, Secret: "wrong-secret"}})
+	assert.Nil(t, err)
+
+	app, err := manager.FindById(context.Background(), "1234")
+	assert.Nil(t, app)
+	assert.NotNil(t, err)
+}
+
+func TestHttpAppManagerRetriesServerErrors(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		_, _ = w.Write([]byte(testRegistryApp))
+	}))
+	defer ts.Close()
+
+	manager, err := New(config.AppManager{Driver: "http", Http: config.HttpAppManager{Url: ts.URL, RetryDelay: time.Millisecond}})
+	assert.Nil(t, err)
+
+	app, err := manager.FindByKey(context.Background(), "app-key")
+	assert.Nil(t, err)
+	assert.Equal(t, "1234", app.ID)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	// The lookup fails once the attempts run out.
+	atomic.StoreInt32(&requests, -10)
+
+	_, err = manager.FindByKey(context.Background(), "app-key")
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(-7), atomic.LoadInt32(&requests))
+}
+
+func TestHttpAppManagerRetriesTimeouts(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			<-r.Context().Done()
+			return
+		}
+
+		_, _ = w.Write([]byte(testRegistryApp))
+	}))
+	defer ts.Close()
+
+	manager, err := New(config.AppManager{Driver: "http", Http: config.HttpAppManager{Url: ts.URL, Timeout: 50 * time.Millisecond, RetryDelay: time.Millisecond}})
+	assert.Nil(t, err)
+
+	app, err := manager.FindById(context.Background(), "1234")
+	assert.Nil(t, err)
+	assert.Equal(t, "1234", app.ID)
+}
+
+func TestHttpAppManagerStopsWhenContextIsCancelled(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	manager, err := New(config.AppManager{Driver: "http", Http: config.HttpAppManager{Url: ts.URL, MaxAttempts: 5}})
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = manager.FindById(ctx, "1234")
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestNewHttpAppManagerRequiresUrl(t *testing.T) {
+	manager, err := New(config.AppManager{Driver: "http"})
+
+	assert.Nil(t, manager)
+	assert.ErrorIs(t, err, ErrInvalidAppManagerUrl)
+}
@@ -0,0 +1,479 @@
+package appmanagers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/config"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// defaultAppsTable is used when no table is configured for the sql app manager.
+const defaultAppsTable = "apps"
+
+// appColumns are the columns of the apps table, in the order they are scanned by scanApp, with
+// their definition used by the migration. The columns are named after the config keys of the apps,
+// history_max_age is in seconds, previous_expires_at is a unix timestamp in seconds, secrets,
+// previous_secrets and webhooks are json arrays of the additional secrets and the webhooks, using
+// the config keys as well.
+var appColumns = []appColumn{
+	{name: "id", definition: "VARCHAR(255) NOT NULL PRIMARY KEY", required: true},
+	{name: "key", definition: "VARCHAR(255) NOT NULL UNIQUE", required: true},
+	{name: "secret", definition: "VARCHAR(255) NOT NULL", required: true},
+	{name: "secrets", definition: "TEXT"},
+	{name: "previous_key", definition: "VARCHAR(255) NOT NULL DEFAULT ''"},
+	{name: "previous_secret", definition: "VARCHAR(255) NOT NULL DEFAULT ''"},
+	{name: "previous_expires_at", definition: "BIGINT NOT NULL DEFAULT 0"},
+	{name: "previous_secrets", definition: "TEXT"},
+	{name: "disabled", definition: "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{name: "max_connections", definition: "INTEGER NOT NULL DEFAULT 0"},
+	{name: "enable_client_messages", definition: "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{name: "max_client_events_per_second", definition: "INTEGER NOT NULL DEFAULT 0"},
+	{name: "max_app_client_events_per_second", definition: "INTEGER NOT NULL DEFAULT 0"},
+	{name: "close_on_client_event_rate_limit", definition: "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{name: "max_api_requests_per_second", definition: "INTEGER NOT NULL DEFAULT 0"},
+	{name: "max_backend_events_per_second", definition: "INTEGER NOT NULL DEFAULT 0"},
+	{name: "max_event_payload", definition: "INTEGER NOT NULL DEFAULT 0"},
+	{name: "enable_subscription_count", definition: "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{name: "max_presence_members", definition: "INTEGER NOT NULL DEFAULT 0"},
+	{name: "max_presence_user_info_size", definition: "INTEGER NOT NULL DEFAULT 0"},
+	{name: "max_watchlist_size", definition: "INTEGER NOT NULL DEFAULT 0"},
+	{name: "history_enabled", definition: "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{name: "history_max_events", definition: "INTEGER NOT NULL DEFAULT 0"},
+	{name: "history_max_age", definition: "BIGINT NOT NULL DEFAULT 0"},
+	{name: "webhooks", definition: "TEXT"},
+}
+
+// sqlAppManager reads the apps from a database table on every lookup, so apps can be added and
+// changed without restarting the server. The key and previous_key columns are expected to be indexed.
+type sqlAppManager struct {
+	db *sql.DB
+
+	findById          string
+	lockById          string
+	findByKey         string
+	findByPreviousKey string
+	getSecret         string
+	listApps          string
+	insertApp         string
+	updateApp         string
+	deleteApp         string
+}
+
+func newSqlAppManager(config config.SqlAppManager) (gsockets.AppManager, error) {
+	db, err := sql.Open(config.Driver, config.Dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	table := config.Table
+	if table == "" {
+		table = defaultAppsTable
+	}
+
+	if err := migrateAppsTable(ctx, db, config.Driver, table, config.Migrate); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	quote := quoteIdentifier(config.Driver)
+	placeholder := placeholders(config.Driver)
+
+	columns := make([]string, len(appColumns))
+	values := make([]string, len(appColumns))
+	assignments := make([]string, len(appColumns))
+	for i, column := range appColumns {
+		columns[i] = quote(column.name)
+		values[i] = placeholder(i + 1)
+		assignments[i] = columns[i] + " = " + values[i]
+	}
+
+	// The row of the app is locked while it is modified, sqlite has no row locks but serializes the
+	// writing transactions.
+	lock := ""
+	if config.Driver == "mysql" || config.Driver == "postgres" {
+		lock = " FOR UPDATE"
+	}
+
+	table = quote(table)
+	selectApps := "SELECT " + strings.Join(columns, ", ") + " FROM " + table
+
+	return &sqlAppManager{
+		db:                db,
+		findById:          selectApps + " WHERE " + quote("id") + " = " + placeholder(1),
+		lockById:          selectApps + " WHERE " + quote("id") + " = " + placeholder(1) + lock,
+		findByKey:         selectApps + " WHERE " + quote("key") + " = " + placeholder(1),
+		findByPreviousKey: selectApps + " WHERE " + quote("previous_key") + " = " + placeholder(1) + " AND " + quote("previous_expires_at") + " > " + placeholder(2),
+		getSecret:         "SELECT " + quote("secret") + " FROM " + table + " WHERE " + quote("id") + " = " + placeholder(1),
+		listApps:          selectApps + " ORDER BY " + quote("id"),
+		insertApp:         "INSERT INTO " + table + " (" + strings.Join(columns, ", ") + ") VALUES (" + strings.Join(values, ", ") + ")",
+		updateApp:         "UPDATE " + table + " SET " + strings.Join(assignments, ", ") + " WHERE " + quote("id") + " = " + placeholder(len(appColumns)+1),
+		deleteApp:         "DELETE FROM " + table + " WHERE " + quote("id") + " = " + placeholder(1),
+	}, nil
+}
+
+// queryer runs the queries on the database or in a transaction.
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// placeholders returns a function formatting the nth query parameter for the driver.
+func placeholders(driver string) func(int) string {
+	if driver == "postgres" {
+		return func(n int) string { return "$" + strconv.Itoa(n) }
+	}
+
+	return func(int) string { return "?" }
+}
+
+// quoteIdentifier returns a function quoting the identifiers for the driver, key is a reserved
+// word in mysql.
+func quoteIdentifier(driver string) func(string) string {
+	if driver == "mysql" {
+		return func(name string) string { return "`" + name + "`" }
+	}
+
+	return func(name string) string { return `"` + name + `"` }
+}
+
+// FindById returns an app instance by the app id.
+func (s *sqlAppManager) FindById(ctx context.Context, id string) (*gsockets.App, error) {
+	app, err := scanApp(s.db.QueryRowContext(ctx, s.findById, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidAppId
+	}
+
+	return app, err
+}
+
+// FindByKey returns an app instance by app key. The apps are looked up by their previous key when
+// no app has the key, an expired previous key may have been given to another app since.
+func (s *sqlAppManager) FindByKey(ctx context.Context, key string) (*gsockets.App, error) {
+	return s.findAppByKey(ctx, s.db, key)
+}
+
+func (s *sqlAppManager) findAppByKey(ctx context.Context, q queryer, key string) (*gsockets.App, error) {
+	app, err := scanApp(q.QueryRowContext(ctx, s.findByKey, key))
+	if errors.Is(err, sql.ErrNoRows) {
+		app, err = scanApp(q.QueryRowContext(ctx, s.findByPreviousKey, key, time.Now().Unix()))
+	}
+
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !app.HasKey(key)) {
+		return nil, ErrInvalidAppKey
+	}
+
+	return app, err
+}
+
+// GetAppSecret returns an app secret for the given app id.
+func (s *sqlAppManager) GetAppSecret(ctx context.Context, id string) (string, error) {
+	var secret string
+
+	err := s.db.QueryRowContext(ctx, s.getSecret, id).Scan(&secret)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+
+	return secret, err
+}
+
+// ListApps returns all the apps sorted by id.
+func (s *sqlAppManager) ListApps(ctx context.Context) ([]*gsockets.App, error) {
+	rows, err := s.db.QueryContext(ctx, s.listApps)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	apps := make([]*gsockets.App, 0)
+	for rows.Next() {
+		app, err := scanApp(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		apps = append(apps, app)
+	}
+
+	return apps, rows.Err()
+}
+
+// CreateApp adds a new app, its id and key must not be used by another app.
+func (s *sqlAppManager) CreateApp(ctx context.Context, app *gsockets.App) error {
+	_, err := s.FindById(ctx, app.ID)
+	if err == nil {
+		return ErrAppExists
+	}
+
+	if !errors.Is(err, ErrInvalidAppId) {
+		return err
+	}
+
+	if err := s.keyInUse(ctx, s.db, app); err != nil {
+		return err
+	}
+
+	values, err := appValues(app)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, s.insertApp, values...)
+
+	return err
+}
+
+// UpdateApp replaces the app with the same id.
+func (s *sqlAppManager) UpdateApp(ctx context.Context, app *gsockets.App) error {
+	if _, err := s.FindById(ctx, app.ID); err != nil {
+		return err
+	}
+
+	if err := s.keyInUse(ctx, s.db, app); err != nil {
+		return err
+	}
+
+	values, err := appValues(app)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, s.updateApp, append(values, app.ID)...)
+
+	return err
+}
+
+// ModifyApp changes the app with the given id in a transaction, its row is locked until the change
+// is committed so concurrent changes are not lost.
+func (s *sqlAppManager) ModifyApp(ctx context.Context, id string, modify func(app *gsockets.App) error) (*gsockets.App, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = tx.Rollback() }()
+
+	app, err := scanApp(tx.QueryRowContext(ctx, s.lockById, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidAppId
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := modify(app); err != nil {
+		return nil, err
+	}
+
+	app.ID = id
+	if err := s.keyInUse(ctx, tx, app); err != nil {
+		return nil, err
+	}
+
+	values, err := appValues(app)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, s.updateApp, append(values, id)...); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return app, nil
+}
+
+// DeleteApp removes the app with the given id.
+func (s *sqlAppManager) DeleteApp(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, s.deleteApp, id)
+	if err != nil {
+		return err
+	}
+
+	if deleted, err := res.RowsAffected(); err == nil && deleted == 0 {
+		return ErrInvalidAppId
+	}
+
+	return err
+}
+
+// keyInUse returns ErrAppExists if the key of the app is a valid key of another app.
+func (s *sqlAppManager) keyInUse(ctx context.Context, q queryer, app *gsockets.App) error {
+	existing, err := s.findAppByKey(ctx, q, app.Key)
+	if errors.Is(err, ErrInvalidAppKey) {
+		return nil
+	}
+
+	if err == nil && existing.ID != app.ID {
+		return ErrAppExists
+	}
+
+	return err
+}
+
+func (s *sqlAppManager) Close() error {
+	return s.db.Close()
+}
+
+// appValues returns the values of the app columns, in the order of appColumns.
+func appValues(app *gsockets.App) ([]any, error) {
+	secrets, err := encodeColumn(len(app.Secrets), app.Secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	previousSecrets, err := encodeColumn(len(app.PreviousSecrets), app.PreviousSecrets)
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks, err := encodeColumn(len(app.Webhooks), app.Webhooks)
+	if err != nil {
+		return nil, err
+	}
+
+	var previousExpiresAt int64
+	if !app.PreviousExpiresAt.IsZero() {
+		previousExpiresAt = app.PreviousExpiresAt.Unix()
+	}
+
+	return []any{
+		app.ID,
+		app.Key,
+		app.Secret,
+		secrets,
+		app.PreviousKey,
+		app.PreviousSecret,
+		previousExpiresAt,
+		previousSecrets,
+		app.Disabled,
+		app.MaxConnections,
+		app.EnableClientMessages,
+		app.MaxClientEventsPerSecond,
+		app.MaxAppClientEventsPerSecond,
+		app.CloseOnClientEventRateLimit,
+		app.MaxApiRequestsPerSecond,
+		app.MaxBackendEventsPerSecond,
+		app.MaxEventPayload,
+		app.EnableSubscriptionCount,
+		app.MaxPresenceMembers,
+		app.MaxPresenceUserInfoSize,
+		app.MaxWatchlistSize,
+		app.History.Enabled,
+		app.History.MaxEvents,
+		int64(app.History.MaxAge / time.Second),
+		webhooks,
+	}, nil
+}
+
+// encodeColumn encodes the n items of a json array column, the column is null when there are none.
+func encodeColumn(n int, items any) (sql.NullString, error) {
+	if n == 0 {
+		return sql.NullString{}, nil
+	}
+
+	data, err := json.Marshal(items)
+
+	return sql.NullString{String: string(data), Valid: err == nil}, err
+}
+
+func scanApp(row interface{ Scan(...any) error }) (*gsockets.App, error) {
+	var (
+		app               gsockets.App
+		secrets           sql.NullString
+		previousSecrets   sql.NullString
+		previousKey       sql.NullString
+		previousSecret    sql.NullString
+		previousExpiresAt int64
+		historyMaxAge     int64
+		webhooks          sql.NullString
+	)
+
+	err := row.Scan(
+		&app.ID,
+		&app.Key,
+		&app.Secret,
+		&secrets,
+		&previousKey,
+		&previousSecret,
+		&previousExpiresAt,
+		&previousSecrets,
+		&app.Disabled,
+		&app.MaxConnections,
+		&app.EnableClientMessages,
+		&app.MaxClientEventsPerSecond,
+		&app.MaxAppClientEventsPerSecond,
+		&app.CloseOnClientEventRateLimit,
+		&app.MaxApiRequestsPerSecond,
+		&app.MaxBackendEventsPerSecond,
+		&app.MaxEventPayload,
+		&app.EnableSubscriptionCount,
+		&app.MaxPresenceMembers,
+		&app.MaxPresenceUserInfoSize,
+		&app.MaxWatchlistSize,
+		&app.History.Enabled,
+		&app.History.MaxEvents,
+		&historyMaxAge,
+		&webhooks,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	app.PreviousKey, app.PreviousSecret = previousKey.String, previousSecret.String
+	if previousExpiresAt > 0 {
+		app.PreviousExpiresAt = time.Unix(previousExpiresAt, 0)
+	}
+
+	app.History.MaxAge = time.Duration(historyMaxAge) * time.Second
+
+	if err := decodeColumn(secrets, &app.Secrets); err != nil {
+		return nil, err
+	}
+
+	if err := decodeColumn(previousSecrets, &app.PreviousSecrets); err != nil {
+		return nil, err
+	}
+
+	if err := decodeColumn(webhooks, &app.Webhooks); err != nil {
+		return nil, err
+	}
+
+	return &app, nil
+}
+
+// decodeColumn decodes a json array column into the config structs, a null or empty column is left
+// as is.
+func decodeColumn(column sql.NullString, output any) error {
+	if !column.Valid || column.String == "" {
+		return nil
+	}
+
+	var raw []map[string]any
+	if err := json.Unmarshal([]byte(column.String), &raw); err != nil {
+		return err
+	}
+
+	return decodeConfig(raw, output)
+}
@@ -0,0 +1,323 @@
+package appmanagers
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/config"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAppsSchema = `
+CREATE TABLE apps (
+	id TEXT PRIMARY KEY,
+	key TEXT NOT NULL UNIQUE,
+	secret TEXT NOT NULL,
+	secrets TEXT,
+	previous_key TEXT,
+	previous_secret TEXT,
+	previous_expires_at INTEGER NOT NULL DEFAULT 0,
+	previous_secrets TEXT,
+	disabled BOOLEAN NOT NULL DEFAULT FALSE,
+	max_connections INTEGER NOT NULL DEFAULT 0,
+	enable_client_messages BOOLEAN NOT NULL DEFAULT FALSE,
+	max_client_events_per_second INTEGER NOT NULL DEFAULT 0,
+	max_app_client_events_per_second INTEGER NOT NULL DEFAULT 0,
+	close_on_client_event_rate_limit BOOLEAN NOT NULL DEFAULT FALSE,
+	max_api_requests_per_second INTEGER NOT NULL DEFAULT 0,
+	max_backend_events_per_second INTEGER NOT NULL DEFAULT 0,
+	max_event_payload INTEGER NOT NULL DEFAULT 0,
+	enable_subscription_count BOOLEAN NOT NULL DEFAULT FALSE,
+	max_presence_members INTEGER NOT NULL DEFAULT 0,
+	max_presence_user_info_size INTEGER NOT NULL DEFAULT 0,
+	max_watchlist_size INTEGER NOT NULL DEFAULT 0,
+	history_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+	history_max_events INTEGER NOT NULL DEFAULT 0,
+	history_max_age INTEGER NOT NULL DEFAULT 0,
+	webhooks TEXT
+);
+
+CREATE INDEX apps_previous_key ON apps (previous_key);
+
+INSERT INTO apps (id, key, secret, max_connections, enable_client_messages, max_event_payload, history_enabled, history_max_age, webhooks)
+VALUES ('1234', 'app-key', 'secret', 10, TRUE, 1024, TRUE, 60, '[{"url":"http://localhost/hooks","event_types":["channel_occupied"],"filter":{"channel_name_starts_with":"private-"}}]');
+
+INSERT INTO apps (id, key, secret) VALUES ('5678', 'other-key', 'other-secret');
+`
+
+func newTestSqlAppManager(t *testing.T) gsockets.AppManager {
+	dsn := filepath.Join(t.TempDir(), "apps.db")
+
+	db, err := sql.Open("sqlite3", dsn)
+	assert.Nil(t, err)
+
+	_, err = db.Exec(testAppsSchema)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+
+	manager, err := New(config.AppManager{Driver: "sql", Sql: config.SqlAppManager{Driver: "sqlite3", Dsn: dsn}})
+	assert.Nil(t, err)
+
+	t.Cleanup(func() { _ = manager.(*sqlAppManager).Close() })
+
+	return manager
+}
+
+func TestSqlAppManagerFindById(t *testing.T) {
+	manager := newTestSqlAppManager(t)
+
+	app, err := manager.FindById(context.Background(), "1234")
+	assert.Nil(t, err)
+
+	expected := gsockets.App{
+		ID:                   "1234",
+		Key:                  "app-key",
+		Secret:               "secret",
+		MaxConnections:       10,
+		EnableClientMessages: true,
+		MaxEventPayload:      1024,
+		History:              gsockets.ChannelHistory{Enabled: true, MaxAge: time.Minute},
+		Webhooks: []gsockets.Webhook{{
+			Url:        "http://localhost/hooks",
+			EventTypes: []string{"channel_occupied"},
+			Filter:     gsockets.WebhookFilter{ChannelNameStartsWith: "private-"},
+		}},
+	}
+	assert.Equal(t, expected, *app)
+
+	app, err = manager.FindById(context.Background(), "unknown")
+	assert.Nil(t, app)
+	assert.ErrorIs(t, err, ErrInvalidAppId)
+}
+
+func TestSqlAppManagerFindByKey(t *testing.T) {
+	manager := newTestSqlAppManager(t)
+
+	app, err := manager.FindByKey(context.Background(), "other-key")
+	assert.Nil(t, err)
+	assert.Equal(t, gsockets.App{ID: "5678", Key: "other-key", Secret: "other-secret"}, *app)
+
+	app, err = manager.FindByKey(context.Background(), "unknown")
+	assert.Nil(t, app)
+	assert.ErrorIs(t, err, ErrInvalidAppKey)
+}
+
+func TestSqlAppManagerGetAppSecret(t *testing.T) {
+	manager := newTestSqlAppManager(t)
+
+	secret, err := manager.GetAppSecret(context.Background(), "5678")
+	assert.Nil(t, err)
+	assert.Equal(t, "other-secret", secret)
+
+	secret, err = manager.GetAppSecret(context.Background(), "unknown")
+	assert.Nil(t, err)
+	assert.Empty(t, secret)
+}
+
+func TestNewSqlAppManagerReturnsErrForUnreachableDatabase(t *testing.T) {
+	manager, err := New(config.AppManager{Driver: "sql", Sql: config.SqlAppManager{Driver: "sqlite3", Dsn: filepath.Join(t.TempDir(), "missing", "apps.db")}})
+
+	assert.Nil(t, manager)
+	assert.NotNil(t, err)
+}
+
+func TestSqlAppManagerWrites(t *testing.T) {
+	manager := newTestSqlAppManager(t).(gsockets.WritableAppManager)
+	ctx := context.Background()
+
+	app := &gsockets.App{
+		ID:               "9999",
+		Key:              "new-key",
+		Secret:           "new-secret",
+		Secrets:          []gsockets.AppSecret{{Secret: "next-secret", NotAfter: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		History:          gsockets.ChannelHistory{Enabled: true, MaxEvents: 10, MaxAge: time.Hour},
+		Webhooks:         []gsockets.Webhook{{Url: "http://localhost/hooks"}},
+		MaxWatchlistSize: 5,
+	}
+	assert.Nil(t, manager.CreateApp(ctx, app))
+
+	found, err := manager.FindByKey(ctx, "new-key")
+	assert.Nil(t, err)
+	assert.Equal(t, app, found)
+
+	assert.ErrorIs(t, manager.CreateApp(ctx, &gsockets.App{ID: "9999", Key: "unused"}), ErrAppExists)
+	assert.ErrorIs(t, manager.CreateApp(ctx, &gsockets.App{ID: "unused", Key: "new-key"}), ErrAppExists)
+
+	app.Disabled = true
+	app.Webhooks = nil
+	assert.Nil(t, manager.UpdateApp(ctx, app))
+
+	found, err = manager.FindById(ctx, "9999")
+	assert.Nil(t, err)
+	assert.Equal(t, app, found)
+
+	assert.ErrorIs(t, manager.UpdateApp(ctx, &gsockets.App{ID: "9999", Key: "app-key"}), ErrAppExists)
+	assert.ErrorIs(t, manager.UpdateApp(ctx, &gsockets.App{ID: "unknown", Key: "unused"}), ErrInvalidAppId)
+
+	apps, err := manager.ListApps(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, apps, 3)
+	assert.Equal(t, "1234", apps[0].ID)
+
+	assert.Nil(t, manager.DeleteApp(ctx, "9999"))
+	assert.ErrorIs(t, manager.DeleteApp(ctx, "9999"), ErrInvalidAppId)
+
+	_, err = manager.FindById(ctx, "9999")
+	assert.ErrorIs(t, err, ErrInvalidAppId)
+}
+
+func TestSqlAppManagerModifyApp(t *testing.T) {
+	manager := newTestSqlAppManager(t).(gsockets.WritableAppManager)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := manager.ModifyApp(ctx, "1234", func(app *gsockets.App) error {
+				app.MaxPresenceMembers++
+				return nil
+			})
+			assert.Nil(t, err)
+		}()
+	}
+
+	wg.Wait()
+
+	found, err := manager.FindById(ctx, "1234")
+	assert.Nil(t, err)
+	assert.Equal(t, 10, found.MaxPresenceMembers, "no concurrent change should be lost")
+
+	_, err = manager.ModifyApp(ctx, "unknown", func(app *gsockets.App) error { return nil })
+	assert.ErrorIs(t, err, ErrInvalidAppId)
+
+	_, err = manager.ModifyApp(ctx, "5678", func(app *gsockets.App) error {
+		app.Key = "app-key"
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrAppExists, "the key must be unique")
+}
+
+func TestSqlAppManagerFindByPreviousKey(t *testing.T) {
+	manager := newTestSqlAppManager(t).(gsockets.WritableAppManager)
+	ctx := context.Background()
+
+	app, err := manager.FindById(ctx, "5678")
+	assert.Nil(t, err)
+
+	next := gsockets.AppSecret{Secret: "next-secret", NotAfter: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	app.Secrets = []gsockets.AppSecret{next}
+	app.Rotate("rotated-key", "rotated-secret", time.Now().Add(time.Hour))
+	assert.Nil(t, manager.UpdateApp(ctx, app))
+
+	for _, key := range []string{"rotated-key", "other-key"} {
+		found, err := manager.FindByKey(ctx, key)
+		assert.Nil(t, err)
+		assert.Equal(t, "rotated-key", found.Key)
+		assert.Equal(t, "other-secret", found.PreviousSecret)
+		assert.Equal(t, []gsockets.AppSecret{next}, found.PreviousSecrets)
+	}
+
+	app.PreviousExpiresAt = time.Now().Add(-time.Second)
+	assert.Nil(t, manager.UpdateApp(ctx, app))
+
+	_, err = manager.FindByKey(ctx, "other-key")
+	assert.ErrorIs(t, err, ErrInvalidAppKey)
+
+	// The expired previous key can be given to another app, which is found by it.
+	assert.Nil(t, manager.CreateApp(ctx, &gsockets.App{ID: "9999", Key: "other-key", Secret: "new-secret"}))
+
+	found, err := manager.FindByKey(ctx, "other-key")
+	assert.Nil(t, err)
+	assert.Equal(t, "9999", found.ID)
+}
+
+// testLegacyAppsSchema is the apps table as created before the credentials rotation and the
+// additional secrets.
+const testLegacyAppsSchema = `
+CREATE TABLE apps (
+	id TEXT PRIMARY KEY,
+	key TEXT NOT NULL UNIQUE,
+	secret TEXT NOT NULL,
+	max_connections INTEGER NOT NULL DEFAULT 0,
+	enable_client_messages BOOLEAN NOT NULL DEFAULT FALSE,
+	max_client_events_per_second INTEGER NOT NULL DEFAULT 0,
+	max_app_client_events_per_second INTEGER NOT NULL DEFAULT 0,
+	close_on_client_event_rate_limit BOOLEAN NOT NULL DEFAULT FALSE,
+	max_api_requests_per_second INTEGER NOT NULL DEFAULT 0,
+	max_backend_events_per_second INTEGER NOT NULL DEFAULT 0,
+	max_event_payload INTEGER NOT NULL DEFAULT 0,
+	enable_subscription_count BOOLEAN NOT NULL DEFAULT FALSE,
+	max_presence_members INTEGER NOT NULL DEFAULT 0,
+	max_presence_user_info_size INTEGER NOT NULL DEFAULT 0,
+	max_watchlist_size INTEGER NOT NULL DEFAULT 0,
+	history_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+	history_max_events INTEGER NOT NULL DEFAULT 0,
+	history_max_age INTEGER NOT NULL DEFAULT 0,
+	webhooks TEXT
+);
+
+INSERT INTO apps (id, key, secret, max_connections) VALUES ('1234', 'app-key', 'secret', 10);
+`
+
+func TestSqlAppManagerMigrateCreatesTable(t *testing.T) {
+	cfg := config.SqlAppManager{Driver: "sqlite3", Dsn: filepath.Join(t.TempDir(), "apps.db"), Migrate: true}
+
+	manager, err := New(config.AppManager{Driver: "sql", Sql: cfg})
+	assert.Nil(t, err)
+
+	t.Cleanup(func() { _ = manager.(*sqlAppManager).Close() })
+
+	app := &gsockets.App{ID: "1234", Key: "app-key", Secret: "secret", MaxConnections: 10}
+	assert.Nil(t, manager.(gsockets.WritableAppManager).CreateApp(context.Background(), app))
+
+	found, err := manager.FindByKey(context.Background(), "app-key")
+	assert.Nil(t, err)
+	assert.Equal(t, app, found)
+
+	// The table is left as is once it's up to date.
+	again, err := New(config.AppManager{Driver: "sql", Sql: cfg})
+	assert.Nil(t, err)
+	assert.Nil(t, again.(*sqlAppManager).Close())
+}
+
+func TestSqlAppManagerMigrateUpgradesTable(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "apps.db")
+
+	db, err := sql.Open("sqlite3", dsn)
+	assert.Nil(t, err)
+
+	_, err = db.Exec(testLegacyAppsSchema)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+
+	cfg := config.SqlAppManager{Driver: "sqlite3", Dsn: dsn}
+
+	_, err = New(config.AppManager{Driver: "sql", Sql: cfg})
+	assert.ErrorContains(t, err, "missing the columns secrets, previous_key, previous_secret, previous_expires_at, previous_secrets, disabled")
+
+	cfg.Migrate = true
+	manager, err := New(config.AppManager{Driver: "sql", Sql: cfg})
+	assert.Nil(t, err)
+
+	t.Cleanup(func() { _ = manager.(*sqlAppManager).Close() })
+
+	app, err := manager.FindById(context.Background(), "1234")
+	assert.Nil(t, err)
+	assert.Equal(t, gsockets.App{ID: "1234", Key: "app-key", Secret: "secret", MaxConnections: 10}, *app)
+
+	// The existing apps can be rotated once the table is upgraded.
+	app.Rotate("rotated-key", "rotated-secret", time.Now().Add(time.Hour))
+	assert.Nil(t, manager.(gsockets.WritableAppManager).UpdateApp(context.Background(), app))
+
+	found, err := manager.FindByKey(context.Background(), "app-key")
+	assert.Nil(t, err)
+	assert.Equal(t, "rotated-key", found.Key)
+}
@@ -0,0 +1,114 @@
+package appmanagers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// appColumn is a column of the apps table. The columns added after the first release of the sql
+// app manager have a default value, so they can be added to the existing tables.
+type appColumn struct {
+	name       string
+	definition string
+
+	// required columns can not be added to an existing table.
+	required bool
+}
+
+// migrateAppsTable checks the apps table has all the columns of appColumns. When migrate is set,
+// the table is created if it doesn't exist and the missing columns are added to it, otherwise the
+// missing columns are reported as an error.
+func migrateAppsTable(ctx context.Context, db *sql.DB, driver, table string, migrate bool) error {
+	quote := quoteIdentifier(driver)
+
+	existing, err := tableColumns(ctx, db, quote(table))
+	if err != nil {
+		if !migrate {
+			return fmt.Errorf("error reading the %s table, set migrate to create it: %w", table, err)
+		}
+
+		return createAppsTable(ctx, db, quote, table)
+	}
+
+	missing := make([]appColumn, 0)
+	for _, column := range appColumns {
+		if !existing[column.name] {
+			missing = append(missing, column)
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	names := make([]string, len(missing))
+	for i, column := range missing {
+		names[i] = column.name
+
+		if column.required {
+			return fmt.Errorf("the %s table has no %s column", table, column.name)
+		}
+	}
+
+	if !migrate {
+		return fmt.Errorf("the %s table is missing the columns %s, set migrate to add them", table, strings.Join(names, ", "))
+	}
+
+	for _, column := range missing {
+		if _, err := db.ExecContext(ctx, "ALTER TABLE "+quote(table)+" ADD COLUMN "+quote(column.name)+" "+column.definition); err != nil {
+			return err
+		}
+
+		if column.name == "previous_key" {
+			if err := createPreviousKeyIndex(ctx, db, quote, table); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// tableColumns returns the names of the columns of the table, it fails if the table doesn't exist.
+func tableColumns(ctx context.Context, db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, "SELECT * FROM "+table+" WHERE 1 = 0")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]bool, len(names))
+	for _, name := range names {
+		columns[strings.ToLower(name)] = true
+	}
+
+	return columns, nil
+}
+
+func createAppsTable(ctx context.Context, db *sql.DB, quote func(string) string, table string) error {
+	definitions := make([]string, len(appColumns))
+	for i, column := range appColumns {
+		definitions[i] = quote(column.name) + " " + column.definition
+	}
+
+	if _, err := db.ExecContext(ctx, "CREATE TABLE "+quote(table)+" ("+strings.Join(definitions, ", ")+")"); err != nil {
+		return err
+	}
+
+	return createPreviousKeyIndex(ctx, db, quote, table)
+}
+
+// createPreviousKeyIndex indexes the previous keys, the apps are looked up by them during the grace
+// period of a rotation.
+func createPreviousKeyIndex(ctx context.Context, db *sql.DB, quote func(string) string, table string) error {
+	_, err := db.ExecContext(ctx, "CREATE INDEX "+quote(table+"_previous_key")+" ON "+quote(table)+" ("+quote("previous_key")+")")
+	return err
+}
@@ -1,5 +1,7 @@
 package gsockets
 
+import "encoding/json"
+
 // ChannelManager interface defines the methods for a channel manager to implement. A channel
 // manager is responsible of keeping track of the active channels and all the connected connections
 // to the channels in the server.
@@ -8,6 +10,9 @@ type ChannelManager interface {
 	// of the channel.
 	GetLocalConnections(appId string) []Connection
 
+	// GetGlobalConnectionCount returns the number of connections to an app accross all instances.
+	GetGlobalConnectionCount(appId string) int
+
 	// GetLocalChannels returns all the channels for a specific app for the current instance.
 	GetLocalChannels(appId string) []string
 
@@ -21,6 +26,14 @@ type ChannelManager interface {
 	// GetChannelMembers returns all the subscribed user info for a presence channel.
 	GetChannelMembers(appId, channelName string) map[string]PresenceMember
 
+	// ReservePresenceMember holds a place for the user in a presence channel until release is called,
+	// so the users joining the channel at the same time count each other against the members limit.
+	ReservePresenceMember(appId, channelName, userId string) (release func())
+
+	// GetPresenceMemberIds returns the users of a presence channel accross all instances, along with
+	// the users holding a place in it.
+	GetPresenceMemberIds(appId, channelName string) []string
+
 	// GetChannelConnectionCount returns the number of connections currently subscribed with the given channel.
 	GetChannelConnectionCount(appId, channelName string) int
 
@@ -31,10 +44,12 @@ type ChannelManager interface {
 	RemoveConnection(appId string, conn Connection)
 
 	// TerminateUserConnections will terminate all the active connections from a particular user
-	TerminateUserConnections(appId, userId string)
+	// accross all instances, returning the number of connections terminated.
+	TerminateUserConnections(appId, userId string) int
 
-	// SetUser associates a connection with an user.
-	SetUser(appId, userId, connId string)
+	// SetUser associates a connection with an user, the connection is notified when the users of the
+	// watchlist connect or disconnect.
+	SetUser(appId, userId, connId string, watchlist []string)
 
 	// RemoveUser removes the link between a connection and user.
 	RemoveUser(appId, userId, connId string)
@@ -42,6 +57,9 @@ type ChannelManager interface {
 	// GetUserConnections returns all the connection associated with a particular user.
 	GetUserConnections(appId, userId string) []Connection
 
+	// BroadcastToUser sends the given data to all the connections signed in as the user.
+	BroadcastToUser(appId, userId string, data any)
+
 	// SubscribeToChannel subscribe a connection to a specific channel.
 	SubscribeToChannel(appId, channelName string, conn Connection, payload any)
 
@@ -60,4 +78,8 @@ type ChannelManager interface {
 
 	// BroadcastExcept sends the given data to all the channels except the given connection id.
 	BroadcastExcept(appId, channel string, data any, connId string)
+
+	// GetCachedEvent returns the last event broadcast to a cache channel, false if there is none
+	// or it expired.
+	GetCachedEvent(appId, channel string) (json.RawMessage, bool)
 }
@@ -5,16 +5,27 @@ import (
 
 	"github.com/gsockets/gsockets"
 	"github.com/gsockets/gsockets/config"
+	"github.com/gsockets/gsockets/log"
 )
 
 var (
 	ErrInvalidChannelManagerDriver = errors.New("invalid channel manager driver")
+	ErrMissingClusterSecret        = errors.New("the cluster channel manager requires a cluster secret")
 )
 
-func New(config config.ChannelManager) (gsockets.ChannelManager, error) {
+// New returns the channel manager for the configured driver. The nodeId identifies this server
+// instance when the driver needs to communicate with other gsockets nodes. The webhooks sender
+// gets notified when channels become occupied or vacated.
+func New(config config.ChannelManager, nodeId string, webhooks gsockets.WebhookSender, metrics gsockets.Metrics, logger log.Logger) (gsockets.ChannelManager, error) {
 	switch config.Driver {
 	case "local":
-		return newLocalChannelManager(), nil
+		return newLocalChannelManager(config.CacheTtl, config.SubscriptionCountInterval, webhooks, metrics), nil
+	case "redis":
+		return newRedisChannelManager(config, nodeId, webhooks, metrics, logger)
+	case "nats":
+		return newNatsChannelManager(config, nodeId, webhooks, metrics, logger)
+	case "cluster":
+		return newClusterChannelManager(config, nodeId, webhooks, metrics, logger)
 	default:
 		return nil, ErrInvalidChannelManagerDriver
 	}
@@ -0,0 +1,134 @@
+package channelmanagers
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/config"
+	"github.com/gsockets/gsockets/log"
+	"github.com/gsockets/gsockets/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+// testConnection is an in memory gsockets.Connection that records everything sent to it.
+type testConnection struct {
+	id       string
+	app      *gsockets.App
+	presence map[string]gsockets.PresenceMember
+	user     *gsockets.PusherSigninUserData
+	closed   bool
+	code     int
+
+	sent [][]byte
+	lock sync.Mutex
+}
+
+func newTestConnection(id string) *testConnection {
+	return &testConnection{
+		id:       id,
+		app:      &gsockets.App{ID: "app-id"},
+		presence: make(map[string]gsockets.PresenceMember),
+	}
+}
+
+func (c *testConnection) Id() string { return c.id }
+
+func (c *testConnection) App() *gsockets.App { return c.app }
+
+func (c *testConnection) Presence() map[string]gsockets.PresenceMember {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.presence
+}
+
+func (c *testConnection) GetPresence(channelName string) (gsockets.PresenceMember, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	member, ok := c.presence[channelName]
+	return member, ok
+}
+
+func (c *testConnection) SetPresence(channelName string, member gsockets.PresenceMember) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.presence[channelName] = member
+}
+
+func (c *testConnection) RemovePresence(channelName string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.presence, channelName)
+}
+
+func (c *testConnection) SetUser(userId, userInfo string) {
+	c.user = &gsockets.PusherSigninUserData{Id: userId, UserInfo: userInfo}
+}
+
+func (c *testConnection) GetUser() *gsockets.PusherSigninUserData { return c.user }
+
+func (c *testConnection) Send(data any) {
+	msg, _ := json.Marshal(data)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.sent = append(c.sent, msg)
+}
+
+func (c *testConnection) Close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.closed = true
+}
+
+func (c *testConnection) CloseWithCode(code int, message string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.closed = true
+	c.code = code
+}
+
+// closeCode returns the code the connection was closed with, zero if it's still open.
+func (c *testConnection) closeCode() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.code
+}
+
+// messages returns the json encoded messages sent to this connection.
+func (c *testConnection) messages() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ret := make([]string, len(c.sent))
+	for i, msg := range c.sent {
+		ret[i] = string(msg)
+	}
+
+	return ret
+}
+
+func TestNewReturnsErrForInvalidDriver(t *testing.T) {
+	cm, err := New(config.ChannelManager{Driver: "invalid"}, "node", nil, metrics.NewNoop(), log.New())
+
+	assert.Nil(t, cm, "no channel manager instance should be returned")
+	assert.ErrorIs(t, err, ErrInvalidChannelManagerDriver, "the error returned must be", ErrInvalidChannelManagerDriver)
+}
+
+func TestNewReturnsLocalChannelManager(t *testing.T) {
+	cm, err := New(config.ChannelManager{Driver: "local"}, "node", nil, metrics.NewNoop(), log.New())
+
+	assert.Nil(t, err, "no error should be returned for valid config")
+
+	_, ok := cm.(*localChannelManager)
+	assert.True(t, ok, "got invalid channel manager implementation")
+}
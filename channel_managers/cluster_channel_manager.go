@@ -0,0 +1,313 @@
+package channelmanagers
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/config"
+	"github.com/gsockets/gsockets/log"
+)
+
+const (
+	// clusterSecretHeader carries the shared cluster secret on the requests between the nodes.
+	clusterSecretHeader = "X-Gsockets-Cluster-Secret"
+
+	// clusterQueueSize is the number of broadcasts buffered for a peer before they are dropped.
+	clusterQueueSize = 1024
+
+	// clusterPeerBackoff is how long a peer is left out of the requests after it failed, so a node
+	// that is down doesn't hold every request until the request timeout.
+	clusterPeerBackoff = 5 * time.Second
+)
+
+// clusterChannelManager is a channel manager where the nodes talk to each other directly over
+// http, without any broker in between. It must be mounted on the server router under /cluster
+// so the other nodes can reach it.
+type clusterChannelManager struct {
+	*horizontalChannelManager
+
+	broker *clusterBroker
+}
+
+// clusterPeer is another node of the cluster. Broadcasts to a peer are queued and sent in order
+// by a dedicated goroutine so a slow peer never blocks the local broadcasts.
+type clusterPeer struct {
+	url   string
+	queue chan brokerMessage
+
+	lock     sync.Mutex
+	failedAt time.Time
+}
+
+// available returns false while the peer is backing off after a failure.
+func (p *clusterPeer) available() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return time.Since(p.failedAt) >= clusterPeerBackoff
+}
+
+// failed records a failure of the peer, it returns true if the peer was available until now.
+func (p *clusterPeer) failed() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	wasAvailable := time.Since(p.failedAt) >= clusterPeerBackoff
+	p.failedAt = time.Now()
+
+	return wasAvailable
+}
+
+func (p *clusterPeer) succeeded() {
+	p.lock.Lock()
+	p.failedAt = time.Time{}
+	p.lock.Unlock()
+}
+
+type clusterBroker struct {
+	nodeId string
+	secret string
+	peers  []*clusterPeer
+
+	client  *http.Client
+	router  chi.Router
+	handler brokerHandler
+
+	done      chan struct{}
+	closeOnce sync.Once
+	timeout   time.Duration
+	logger    log.Logger
+}
+
+func newClusterChannelManager(config config.ChannelManager, nodeId string, webhooks gsockets.WebhookSender, metrics gsockets.Metrics, logger log.Logger) (gsockets.ChannelManager, error) {
+	logger = logger.With("module", "cluster_channel_manager")
+
+	// The cluster endpoints are served on the public router, they can't be left unauthenticated.
+	if config.Cluster.Secret == "" {
+		return nil, ErrMissingClusterSecret
+	}
+
+	timeout := config.RequestTimeout
+	if timeout <= 0 {
+		timeout = defaultRequestTimeout
+	}
+
+	b := &clusterBroker{
+		nodeId:  nodeId,
+		secret:  config.Cluster.Secret,
+		client:  &http.Client{},
+		router:  chi.NewRouter(),
+		done:    make(chan struct{}),
+		timeout: timeout,
+		logger:  logger,
+	}
+
+	for _, url := range config.Cluster.Peers {
+		b.peers = append(b.peers, &clusterPeer{url: strings.TrimSuffix(url, "/"), queue: make(chan brokerMessage, clusterQueueSize)})
+	}
+
+	h, err := newHorizontalChannelManager(nodeId, b, config, timeout, webhooks, metrics, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return &clusterChannelManager{horizontalChannelManager: h, broker: b}, nil
+}
+
+// ServeHTTP handles the requests coming from the other nodes of the cluster.
+func (c *clusterChannelManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.broker.router.ServeHTTP(w, r)
+}
+
+func (b *clusterBroker) listen(handler brokerHandler) error {
+	b.handler = handler
+
+	b.router.Use(b.authenticate)
+	b.router.Post("/broadcast", b.handleBroadcast)
+	b.router.Post("/request", b.handleRequest)
+
+	for _, peer := range b.peers {
+		go b.sendLoop(peer)
+	}
+
+	return nil
+}
+
+// authenticate verifies the request comes from a node sharing the same cluster secret.
+func (b *clusterBroker) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret := r.Header.Get(clusterSecretHeader)
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(b.secret)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (b *clusterBroker) handleBroadcast(w http.ResponseWriter, r *http.Request) {
+	var msg brokerMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	b.handler.onMessage(msg)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (b *clusterBroker) handleRequest(w http.ResponseWriter, r *http.Request) {
+	var req brokerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// A node listed in its own peer list answers itself with an empty response so it is
+	// not counted twice.
+	resp := brokerResponse{RequestId: req.Id, NodeId: b.nodeId}
+	if req.NodeId != b.nodeId {
+		resp = b.handler.onRequest(req)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (b *clusterBroker) sendLoop(peer *clusterPeer) {
+	for {
+		select {
+		case msg := <-peer.queue:
+			ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+			if resp, err := b.post(ctx, peer.url+"/cluster/broadcast", msg); err != nil {
+				b.logger.Error("msg", "error sending broadcast to peer", "peer", peer.url, "error", err.Error())
+				peer.failed()
+			} else {
+				resp.Body.Close()
+				peer.succeeded()
+			}
+
+			cancel()
+		case <-b.done:
+			return
+		}
+	}
+}
+
+func (b *clusterBroker) post(ctx context.Context, url string, body any) (*http.Response, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(clusterSecretHeader, b.secret)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, url)
+	}
+
+	return resp, nil
+}
+
+func (b *clusterBroker) publish(ctx context.Context, msg brokerMessage) error {
+	for _, peer := range b.peers {
+		select {
+		case peer.queue <- msg:
+		default:
+			b.logger.Warn("msg", "broadcast queue full, dropping message for peer", "peer", peer.url, "channel", msg.Channel)
+		}
+	}
+
+	return nil
+}
+
+// request asks the available peers, it returns as soon as all of them answered. The peers that
+// failed recently are skipped until their backoff is over.
+func (b *clusterBroker) request(ctx context.Context, req brokerRequest) ([]brokerResponse, error) {
+	var (
+		wg        sync.WaitGroup
+		lock      sync.Mutex
+		responses = make([]brokerResponse, 0, len(b.peers))
+		lastErr   error
+	)
+
+	for _, peer := range b.peers {
+		if !peer.available() {
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(peer *clusterPeer) {
+			defer wg.Done()
+
+			br, err := b.requestPeer(ctx, peer, req)
+
+			lock.Lock()
+			defer lock.Unlock()
+
+			if err != nil {
+				lastErr = err
+				return
+			}
+
+			responses = append(responses, br)
+		}(peer)
+	}
+
+	wg.Wait()
+
+	return responses, lastErr
+}
+
+func (b *clusterBroker) requestPeer(ctx context.Context, peer *clusterPeer, req brokerRequest) (brokerResponse, error) {
+	var br brokerResponse
+
+	resp, err := b.post(ctx, peer.url+"/cluster/request", req)
+	if err == nil {
+		defer resp.Body.Close()
+		err = json.NewDecoder(resp.Body).Decode(&br)
+	}
+
+	if err != nil {
+		if peer.failed() {
+			b.logger.Warn("msg", "peer failed, skipping it in the requests for a while", "peer", peer.url, "backoff", clusterPeerBackoff.String())
+		}
+
+		return br, err
+	}
+
+	peer.succeeded()
+
+	return br, nil
+}
+
+func (b *clusterBroker) close() error {
+	b.closeOnce.Do(func() {
+		close(b.done)
+	})
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package channelmanagers
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultCacheTtl is how long the last event of a cache channel is kept, the same as pusher.
+const defaultCacheTtl = 30 * time.Minute
+
+type cachedEvent struct {
+	data      json.RawMessage
+	expiresAt time.Time
+}
+
+// eventCache keeps the last event sent to each cache channel until it expires.
+type eventCache struct {
+	ttl    time.Duration
+	events map[string]cachedEvent
+
+	// sweptAt is the last time the expired events were removed.
+	sweptAt time.Time
+	lock    sync.Mutex
+}
+
+func newEventCache(ttl time.Duration) *eventCache {
+	if ttl <= 0 {
+		ttl = defaultCacheTtl
+	}
+
+	return &eventCache{ttl: ttl, events: make(map[string]cachedEvent), sweptAt: time.Now()}
+}
+
+// set caches the message sent to the channel, unless it's an event internal to the pusher protocol.
+func (c *eventCache) set(appId, channel string, data any) {
+	msg, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+
+	var event struct {
+		Event string `json:"event"`
+	}
+
+	if err := json.Unmarshal(msg, &event); err != nil || strings.HasPrefix(event.Event, "pusher") {
+		return
+	}
+
+	now := time.Now()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.events[appId+"#"+channel] = cachedEvent{data: msg, expiresAt: now.Add(c.ttl)}
+
+	// Channels not receiving events anymore would keep their last event forever, so the expired
+	// events are removed once per ttl.
+	if now.Sub(c.sweptAt) > c.ttl {
+		for key, event := range c.events {
+			if now.After(event.expiresAt) {
+				delete(c.events, key)
+			}
+		}
+
+		c.sweptAt = now
+	}
+}
+
+func (c *eventCache) get(appId, channel string) (json.RawMessage, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	key := appId + "#" + channel
+	event, ok := c.events[key]
+	if !ok {
+		return nil, false
+	}
+
+	if time.Now().After(event.expiresAt) {
+		delete(c.events, key)
+		return nil, false
+	}
+
+	return event.data, true
+}
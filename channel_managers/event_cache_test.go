@@ -0,0 +1,32 @@
+package channelmanagers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gsockets/gsockets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventCache(t *testing.T) {
+	cache := newEventCache(50 * time.Millisecond)
+
+	_, ok := cache.get("app-id", "cache-news")
+	assert.False(t, ok)
+
+	cache.set("app-id", "cache-news", gsockets.PusherSentMessage{Event: "headline", Channel: "cache-news", Data: "first"})
+	cache.set("app-id", "cache-news", gsockets.PusherSentMessage{Event: "headline", Channel: "cache-news", Data: "second"})
+	cache.set("app-id", "cache-news", gsockets.PusherSentMessage{Event: "pusher_internal:member_added", Channel: "cache-news"})
+
+	event, ok := cache.get("app-id", "cache-news")
+	assert.True(t, ok)
+	assert.JSONEq(t, `{"event":"headline","channel":"cache-news","data":"second"}`, string(event), "only the last event must be kept, skipping the internal events")
+
+	_, ok = cache.get("other-app", "cache-news")
+	assert.False(t, ok, "events must be cached per app")
+
+	time.Sleep(60 * time.Millisecond)
+
+	_, ok = cache.get("app-id", "cache-news")
+	assert.False(t, ok, "event must expire after the ttl")
+}
@@ -0,0 +1,460 @@
+package channelmanagers
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/config"
+	"github.com/gsockets/gsockets/log"
+	"github.com/oklog/ulid/v2"
+)
+
+// defaultRequestTimeout is used when no request timeout is configured for the channel manager.
+const defaultRequestTimeout = 2 * time.Second
+
+type requestType string
+
+const (
+	requestChannels               requestType = "channels"
+	requestChannelMembers         requestType = "channel_members"
+	requestChannelConnectionCount requestType = "channel_connection_count"
+	requestConnectionCount        requestType = "connection_count"
+	requestCachedEvent            requestType = "cached_event"
+	requestOnlineUsers            requestType = "online_users"
+	requestPresenceMemberIds      requestType = "presence_member_ids"
+	requestTerminateUser          requestType = "terminate_user"
+)
+
+// brokerMessage is a broadcast sent from one node to the others.
+type brokerMessage struct {
+	NodeId     string          `json:"node_id"`
+	AppId      string          `json:"app_id"`
+	Channel    string          `json:"channel"`
+	Data       json.RawMessage `json:"data"`
+	ExceptConn string          `json:"except_conn,omitempty"`
+
+	// UserId is set for the messages sent to the connections of a user instead of a channel.
+	UserId string `json:"user_id,omitempty"`
+
+	// WatchedUserId is set for the messages sent to the connections watching a user.
+	WatchedUserId string `json:"watched_user_id,omitempty"`
+
+	// SubscriptionCount is set for the subscription count events, the nodes record it as the last
+	// count sent for the channel.
+	SubscriptionCount *int `json:"subscription_count,omitempty"`
+
+	// CountOwner is set to ask the node sending the subscription count of the channel to send it,
+	// as the subscribers of the channel changed on another node.
+	CountOwner string `json:"count_owner,omitempty"`
+}
+
+// brokerRequest asks the other nodes for their local view of an app.
+type brokerRequest struct {
+	Id      string      `json:"id"`
+	NodeId  string      `json:"node_id"`
+	Type    requestType `json:"type"`
+	AppId   string      `json:"app_id"`
+	Channel string      `json:"channel,omitempty"`
+	UserIds []string    `json:"user_ids,omitempty"`
+	UserId  string      `json:"user_id,omitempty"`
+}
+
+// brokerResponse is the reply of a single node to a brokerRequest.
+type brokerResponse struct {
+	RequestId string                             `json:"request_id"`
+	NodeId    string                             `json:"node_id"`
+	Channels  map[string]int                     `json:"channels,omitempty"`
+	Members   map[string]gsockets.PresenceMember `json:"members,omitempty"`
+	Count     int                                `json:"count,omitempty"`
+	Event     json.RawMessage                    `json:"event,omitempty"`
+	Users     []string                           `json:"users,omitempty"`
+}
+
+// brokerHandler receives the messages and requests coming from the other nodes.
+type brokerHandler interface {
+	onMessage(msg brokerMessage)
+	onRequest(req brokerRequest) brokerResponse
+}
+
+// broker is the transport used by the horizontalChannelManager to talk with the other
+// gsockets nodes. Implementations must not deliver messages published by a node back to
+// the same node's handler as a broadcast, or filter them using the NodeId.
+type broker interface {
+	// listen starts consuming messages and requests from the other nodes.
+	listen(handler brokerHandler) error
+
+	// publish sends a broadcast message to all the other nodes.
+	publish(ctx context.Context, msg brokerMessage) error
+
+	// request sends the request to all the other nodes and collects their responses until
+	// all of them replied or the context is done.
+	request(ctx context.Context, req brokerRequest) ([]brokerResponse, error)
+
+	// close stops listening and releases the underlying resources.
+	close() error
+}
+
+// channelBroker is implemented by the brokers receiving only the broadcasts of the channels having
+// subscribers on this node, instead of every broadcast of the cluster.
+type channelBroker interface {
+	// syncChannel starts receiving the broadcasts of the channel when occupied reports it has
+	// subscribers on this node, and stops receiving them otherwise.
+	syncChannel(appId, channel string, occupied func() bool) error
+}
+
+// horizontalChannelManager keeps the connections of this node in a localChannelManager and uses
+// a broker to fan out broadcasts to, and aggregate channel information from, the other nodes.
+type horizontalChannelManager struct {
+	*localChannelManager
+
+	nodeId         string
+	broker         broker
+	requestTimeout time.Duration
+	logger         log.Logger
+}
+
+func newHorizontalChannelManager(nodeId string, b broker, config config.ChannelManager, requestTimeout time.Duration, webhooks gsockets.WebhookSender, metrics gsockets.Metrics, logger log.Logger) (*horizontalChannelManager, error) {
+	if requestTimeout <= 0 {
+		requestTimeout = defaultRequestTimeout
+	}
+
+	h := &horizontalChannelManager{
+		localChannelManager: newLocalChannelManager(config.CacheTtl, config.SubscriptionCountInterval, webhooks, metrics).(*localChannelManager),
+		nodeId:              nodeId,
+		broker:              b,
+		requestTimeout:      requestTimeout,
+		logger:              logger,
+	}
+
+	h.localChannelManager.countSubscriptions = h.countSubscriptions
+	h.localChannelManager.remoteChannelCount = h.remoteChannelConnectionCount
+	h.localChannelManager.usersOnlineElsewhere = h.usersOnlineElsewhere
+	h.localChannelManager.notifyWatchers = h.notifyWatchers
+	h.localChannelManager.sendCount = h.sendCount
+
+	if cb, ok := b.(channelBroker); ok {
+		h.localChannelManager.channelsChanged = func(appId string, channels ...string) {
+			h.syncChannels(cb, appId, channels...)
+		}
+	}
+
+	if err := b.listen(h); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// Close stops the broker used by the channel manager.
+func (h *horizontalChannelManager) Close() error {
+	return h.broker.close()
+}
+
+func (h *horizontalChannelManager) GetGlobalConnectionCount(appId string) int {
+	count := h.localChannelManager.GetGlobalConnectionCount(appId)
+
+	for _, resp := range h.request(requestConnectionCount, appId, "") {
+		count += resp.Count
+	}
+
+	return count
+}
+
+func (h *horizontalChannelManager) GetGlobalChannels(appId string) []string {
+	channels := h.GetGlobalChannelsWithConnectionCount(appId)
+
+	ret := make([]string, 0, len(channels))
+	for channel := range channels {
+		ret = append(ret, channel)
+	}
+
+	return ret
+}
+
+func (h *horizontalChannelManager) GetGlobalChannelsWithConnectionCount(appId string) map[string]int {
+	ret := h.localChannelManager.GetGlobalChannelsWithConnectionCount(appId)
+
+	for _, resp := range h.request(requestChannels, appId, "") {
+		for channel, count := range resp.Channels {
+			ret[channel] += count
+		}
+	}
+
+	return ret
+}
+
+func (h *horizontalChannelManager) GetChannelMembers(appId, channelName string) map[string]gsockets.PresenceMember {
+	members := h.localChannelManager.GetChannelMembers(appId, channelName)
+
+	for _, resp := range h.request(requestChannelMembers, appId, channelName) {
+		for userId, member := range resp.Members {
+			members[userId] = member
+		}
+	}
+
+	return members
+}
+
+func (h *horizontalChannelManager) GetPresenceMemberIds(appId, channelName string) []string {
+	ids := make(map[string]bool)
+	for _, userId := range h.localChannelManager.GetPresenceMemberIds(appId, channelName) {
+		ids[userId] = true
+	}
+
+	for _, resp := range h.request(requestPresenceMemberIds, appId, channelName) {
+		for _, userId := range resp.Users {
+			ids[userId] = true
+		}
+	}
+
+	ret := make([]string, 0, len(ids))
+	for userId := range ids {
+		ret = append(ret, userId)
+	}
+
+	return ret
+}
+
+func (h *horizontalChannelManager) GetChannelConnectionCount(appId, channelName string) int {
+	return h.localChannelManager.GetChannelConnectionCount(appId, channelName) + h.remoteChannelConnectionCount(appId, channelName)
+}
+
+// remoteChannelConnectionCount returns the number of connections subscribed to the channel on the
+// other nodes.
+func (h *horizontalChannelManager) remoteChannelConnectionCount(appId, channelName string) int {
+	count := 0
+	for _, resp := range h.request(requestChannelConnectionCount, appId, channelName) {
+		count += resp.Count
+	}
+
+	return count
+}
+
+// TerminateUserConnections asks the other nodes to terminate the connections of the user as well.
+func (h *horizontalChannelManager) TerminateUserConnections(appId, userId string) int {
+	count := h.localChannelManager.TerminateUserConnections(appId, userId)
+
+	for _, resp := range h.send(brokerRequest{Type: requestTerminateUser, AppId: appId, UserId: userId}) {
+		count += resp.Count
+	}
+
+	return count
+}
+
+// GetCachedEvent asks the other nodes for the event when it's not cached on this node, which happens
+// when this node started after the event was broadcast.
+func (h *horizontalChannelManager) GetCachedEvent(appId, channel string) (json.RawMessage, bool) {
+	if event, ok := h.localChannelManager.GetCachedEvent(appId, channel); ok {
+		return event, true
+	}
+
+	for _, resp := range h.request(requestCachedEvent, appId, channel) {
+		if len(resp.Event) > 0 {
+			return resp.Event, true
+		}
+	}
+
+	return nil, false
+}
+
+func (h *horizontalChannelManager) BroadcastToChannel(appId, channel string, data any) {
+	h.localChannelManager.BroadcastToChannel(appId, channel, data)
+	h.publish(appId, channel, data, "")
+}
+
+func (h *horizontalChannelManager) BroadcastExcept(appId, channel string, data any, connId string) {
+	h.localChannelManager.BroadcastExcept(appId, channel, data, connId)
+	h.publish(appId, channel, data, connId)
+}
+
+func (h *horizontalChannelManager) BroadcastToUser(appId, userId string, data any) {
+	h.localChannelManager.BroadcastToUser(appId, userId, data)
+	h.publishMessage(brokerMessage{AppId: appId, UserId: userId}, data)
+}
+
+// usersOnlineElsewhere asks the other nodes which users of the list have a connection to them.
+func (h *horizontalChannelManager) usersOnlineElsewhere(appId string, userIds []string) []string {
+	online := make(map[string]bool)
+	for _, resp := range h.requestUsers(requestOnlineUsers, appId, userIds) {
+		for _, userId := range resp.Users {
+			online[userId] = true
+		}
+	}
+
+	ret := make([]string, 0, len(online))
+	for userId := range online {
+		ret = append(ret, userId)
+	}
+
+	return ret
+}
+
+func (h *horizontalChannelManager) notifyWatchers(appId, userId string, data any) {
+	h.localChannelManager.sendToWatchers(appId, userId, data)
+	h.publishMessage(brokerMessage{AppId: appId, WatchedUserId: userId}, data)
+}
+
+// syncChannels updates the broadcasts the broker receives for the channels, which just got their first
+// subscriber or lost their last one on this node.
+func (h *horizontalChannelManager) syncChannels(cb channelBroker, appId string, channels ...string) {
+	for _, channel := range channels {
+		occupied := func() bool { return h.localChannelManager.GetChannelConnectionCount(appId, channel) > 0 }
+
+		if err := cb.syncChannel(appId, channel, occupied); err != nil {
+			h.logger.Error("msg", "error updating the channel subscription", "error", err.Error(), "app_id", appId, "channel", channel)
+		}
+	}
+}
+
+// countSubscriptions returns the number of connections subscribed to the channel on all the nodes.
+// The count of a channel is sent by the node with the lowest id among the nodes having subscribers,
+// so the other nodes ask that node to send it instead.
+func (h *horizontalChannelManager) countSubscriptions(appId, channel string) (int, bool) {
+	count := h.localChannelManager.GetChannelConnectionCount(appId, channel)
+
+	owner := ""
+	if count > 0 {
+		owner = h.nodeId
+	}
+
+	for _, resp := range h.request(requestChannelConnectionCount, appId, channel) {
+		count += resp.Count
+
+		if resp.Count > 0 && (owner == "" || resp.NodeId < owner) {
+			owner = resp.NodeId
+		}
+	}
+
+	// The node whose last subscriber left sends the count of a channel vacated on all the nodes.
+	if owner == "" || owner == h.nodeId {
+		return count, true
+	}
+
+	h.localChannelManager.counter.forget(appId, channel)
+	h.publishMessage(brokerMessage{AppId: appId, Channel: channel, CountOwner: owner}, nil)
+
+	return count, false
+}
+
+// sendCount sends the subscription count to the subscribers of the channel on all the nodes, which
+// record it as the last count sent.
+func (h *horizontalChannelManager) sendCount(appId, channel string, count int) {
+	event := subscriptionCountEvent(channel, count)
+
+	h.localChannelManager.BroadcastToChannel(appId, channel, event)
+	h.publishMessage(brokerMessage{AppId: appId, Channel: channel, SubscriptionCount: &count}, event)
+}
+
+// countChanged schedules sending the subscription count of the channel, when another node asked
+// this node to send it.
+func (h *horizontalChannelManager) countChanged(appId, channel string) {
+	conns := h.localChannelManager.getNamespace(appId).GetChannelConnections(channel)
+	if len(conns) > 0 {
+		h.localChannelManager.counter.changed(conns[0].App(), channel)
+	}
+}
+
+func (h *horizontalChannelManager) publish(appId, channel string, data any, exceptConn string) {
+	h.publishMessage(brokerMessage{AppId: appId, Channel: channel, ExceptConn: exceptConn}, data)
+}
+
+// publishMessage sends the message to the other nodes with the data as its payload.
+func (h *horizontalChannelManager) publishMessage(msg brokerMessage, data any) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		h.logger.Error("msg", "error encoding broadcast payload", "error", err.Error())
+		return
+	}
+
+	msg.NodeId = h.nodeId
+	msg.Data = payload
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.requestTimeout)
+	defer cancel()
+
+	if err := h.broker.publish(ctx, msg); err != nil {
+		h.logger.Error("msg", "error publishing broadcast to other nodes", "error", err.Error(), "app_id", msg.AppId, "channel", msg.Channel)
+	}
+}
+
+// request asks every other node for its local data. Failures are logged and result in only the
+// local data being used by the caller.
+func (h *horizontalChannelManager) request(typ requestType, appId, channel string) []brokerResponse {
+	return h.send(brokerRequest{Type: typ, AppId: appId, Channel: channel})
+}
+
+// requestUsers asks every other node for its local data about the users.
+func (h *horizontalChannelManager) requestUsers(typ requestType, appId string, userIds []string) []brokerResponse {
+	return h.send(brokerRequest{Type: typ, AppId: appId, UserIds: userIds})
+}
+
+// send sends the request to every other node and collects their responses.
+func (h *horizontalChannelManager) send(req brokerRequest) []brokerResponse {
+	req.Id = ulid.Make().String()
+	req.NodeId = h.nodeId
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.requestTimeout)
+	defer cancel()
+
+	responses, err := h.broker.request(ctx, req)
+	if err != nil {
+		h.logger.Error("msg", "error requesting data from other nodes", "error", err.Error(), "type", string(req.Type), "app_id", req.AppId)
+	}
+
+	return responses
+}
+
+func (h *horizontalChannelManager) onMessage(msg brokerMessage) {
+	if msg.NodeId == h.nodeId {
+		return
+	}
+
+	if msg.CountOwner != "" {
+		if msg.CountOwner == h.nodeId {
+			h.countChanged(msg.AppId, msg.Channel)
+		}
+
+		return
+	}
+
+	if msg.SubscriptionCount != nil {
+		h.localChannelManager.counter.record(msg.AppId, msg.Channel, *msg.SubscriptionCount)
+	}
+
+	if msg.UserId != "" {
+		h.localChannelManager.BroadcastToUser(msg.AppId, msg.UserId, msg.Data)
+	} else if msg.WatchedUserId != "" {
+		h.localChannelManager.sendToWatchers(msg.AppId, msg.WatchedUserId, msg.Data)
+	} else if msg.ExceptConn == "" {
+		h.localChannelManager.BroadcastToChannel(msg.AppId, msg.Channel, msg.Data)
+	} else {
+		h.localChannelManager.BroadcastExcept(msg.AppId, msg.Channel, msg.Data, msg.ExceptConn)
+	}
+}
+
+func (h *horizontalChannelManager) onRequest(req brokerRequest) brokerResponse {
+	resp := brokerResponse{RequestId: req.Id, NodeId: h.nodeId}
+
+	switch req.Type {
+	case requestChannels:
+		resp.Channels = h.localChannelManager.GetGlobalChannelsWithConnectionCount(req.AppId)
+	case requestChannelMembers:
+		resp.Members = h.localChannelManager.GetChannelMembers(req.AppId, req.Channel)
+	case requestChannelConnectionCount:
+		resp.Count = h.localChannelManager.GetChannelConnectionCount(req.AppId, req.Channel)
+	case requestConnectionCount:
+		resp.Count = h.localChannelManager.GetGlobalConnectionCount(req.AppId)
+	case requestCachedEvent:
+		resp.Event, _ = h.localChannelManager.GetCachedEvent(req.AppId, req.Channel)
+	case requestTerminateUser:
+		resp.Count = h.localChannelManager.TerminateUserConnections(req.AppId, req.UserId)
+	case requestPresenceMemberIds:
+		resp.Users = h.localChannelManager.GetPresenceMemberIds(req.AppId, req.Channel)
+	case requestOnlineUsers:
+		resp.Users = h.localChannelManager.getNamespace(req.AppId).GetOnlineUsers(req.UserIds)
+	}
+
+	return resp
+}
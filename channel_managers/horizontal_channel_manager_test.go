@@ -0,0 +1,89 @@
+package channelmanagers
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/config"
+	"github.com/gsockets/gsockets/log"
+	"github.com/gsockets/gsockets/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+// stalledBroker is a broker whose requests only complete once released, like the requests to an
+// unresponsive node.
+type stalledBroker struct {
+	release chan struct{}
+}
+
+func (b *stalledBroker) listen(handler brokerHandler) error                   { return nil }
+func (b *stalledBroker) publish(ctx context.Context, msg brokerMessage) error { return nil }
+func (b *stalledBroker) close() error                                         { return nil }
+
+func (b *stalledBroker) request(ctx context.Context, req brokerRequest) ([]brokerResponse, error) {
+	select {
+	case <-b.release:
+		return nil, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// webhookRecorder records the webhook events sent by the channel manager.
+type webhookRecorder struct {
+	events []gsockets.WebhookEvent
+	lock   sync.Mutex
+}
+
+func (w *webhookRecorder) Send(app *gsockets.App, event gsockets.WebhookEvent) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.events = append(w.events, event)
+}
+
+func (w *webhookRecorder) received() []gsockets.WebhookEvent {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return append([]gsockets.WebhookEvent{}, w.events...)
+}
+
+func TestHorizontalChannelWebhooksDoNotBlockSubscriptions(t *testing.T) {
+	b := &stalledBroker{release: make(chan struct{})}
+	wr := &webhookRecorder{}
+
+	h, err := newHorizontalChannelManager("node-1", b, config.ChannelManager{}, 5*time.Second, wr, metrics.NewNoop(), log.New())
+	assert.Nil(t, err)
+
+	conn := newTestConnection("1.1")
+	h.AddConnection("app-id", conn)
+
+	done := make(chan struct{})
+	go func() {
+		h.SubscribeToChannel("app-id", "my-channel", conn, nil)
+		h.UnsubscribeFromChannel("app-id", "my-channel", conn)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("subscribing must not wait for the other nodes")
+	}
+
+	assert.Empty(t, wr.received(), "the webhooks are sent once the other nodes replied")
+
+	close(b.release)
+
+	expected := []gsockets.WebhookEvent{
+		{Name: gsockets.WEBHOOK_CHANNEL_OCCUPIED, Channel: "my-channel"},
+		{Name: gsockets.WEBHOOK_CHANNEL_VACATED, Channel: "my-channel"},
+	}
+
+	assert.Eventually(t, func() bool { return len(wr.received()) == len(expected) }, time.Second, 10*time.Millisecond)
+	assert.ElementsMatch(t, expected, wr.received())
+}
@@ -1,9 +1,12 @@
 package channelmanagers
 
 import (
+	"encoding/json"
 	"sync"
+	"time"
 
 	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/channels"
 )
 
 type localChannelManager struct {
@@ -12,11 +15,72 @@ type localChannelManager struct {
 	// separate for individual apps.
 	namespaces map[string]*gsockets.Namespace
 
+	// webhooks receives the channel_occupied and channel_vacated events, can be nil.
+	webhooks gsockets.WebhookSender
+
+	// countSubscriptions returns the number of connections subscribed to a channel, and whether this
+	// instance sends the subscription count of the channel. Distributed channel managers replace it
+	// to count the connections on all the nodes, and so a single node sends the count of a channel.
+	countSubscriptions func(appId, channelName string) (int, bool)
+
+	// remoteChannelCount returns the number of connections subscribed to a channel on the other nodes,
+	// it's nil when there are no other nodes. A channel is only reported as occupied or vacated by the
+	// node its first subscriber joined or its last subscriber left, when the other nodes have none, so
+	// it's reported once accross the cluster. The other nodes are asked in a goroutine of its own so
+	// the subscriptions don't wait on them.
+	remoteChannelCount func(appId, channelName string) int
+
+	// usersOnlineElsewhere returns the users of the list connected to the other nodes, and
+	// notifyWatchers sends the data to the connections watching a user. Distributed channel
+	// managers replace them so the watchlist events cover the whole cluster.
+	usersOnlineElsewhere func(appId string, userIds []string) []string
+	notifyWatchers       func(appId, userId string, data any)
+
+	// sendCount sends the subscription count to the subscribers of a channel. Distributed channel
+	// managers replace it to reach the subscribers on all the nodes.
+	sendCount func(appId, channel string, count int)
+
+	// channelsChanged is called once channels got their first subscriber or lost their last one on
+	// this instance. Distributed channel managers use it to only receive the broadcasts of the
+	// channels having local subscribers.
+	channelsChanged func(appId string, channels ...string)
+
+	// counter sends the subscription count of the channels to their subscribers.
+	counter *subscriptionCounter
+
+	// cache keeps the last event of the cache channels. Every node caches the broadcasts it receives,
+	// so the events are cached on all the nodes whichever the driver.
+	cache *eventCache
+
+	// metrics tracks the connections, channels and presence members held by this instance.
+	metrics gsockets.Metrics
+
+	// reservations counts the places held by the users joining the presence channels, keyed by app
+	// and channel, then by user.
+	reservations    map[string]map[string]int
+	reservationLock sync.Mutex
+
+	// membershipLock makes checking whether a presence member joins or leaves a channel atomic
+	// with the subscription change.
+	membershipLock sync.Mutex
+
 	namespaceLock sync.Mutex
 }
 
-func newLocalChannelManager() gsockets.ChannelManager {
-	return &localChannelManager{namespaces: make(map[string]*gsockets.Namespace)}
+func newLocalChannelManager(cacheTtl, countInterval time.Duration, webhooks gsockets.WebhookSender, metrics gsockets.Metrics) gsockets.ChannelManager {
+	l := &localChannelManager{namespaces: make(map[string]*gsockets.Namespace), reservations: make(map[string]map[string]int), webhooks: webhooks, metrics: metrics, cache: newEventCache(cacheTtl)}
+	l.countSubscriptions = func(appId, channelName string) (int, bool) {
+		return l.GetChannelConnectionCount(appId, channelName), true
+	}
+	l.usersOnlineElsewhere = func(appId string, userIds []string) []string { return nil }
+	l.notifyWatchers = l.sendToWatchers
+	l.sendCount = func(appId, channel string, count int) {
+		l.BroadcastToChannel(appId, channel, subscriptionCountEvent(channel, count))
+	}
+	l.channelsChanged = func(appId string, channels ...string) {}
+	l.counter = newSubscriptionCounter(countInterval, l.sendSubscriptionCount)
+
+	return l
 }
 
 // getNamespace returns the namespace associated with the given appId, if no namespace exists
@@ -35,11 +99,22 @@ func (l *localChannelManager) getNamespace(appId string) *gsockets.Namespace {
 }
 
 func (l *localChannelManager) AddConnection(appId string, conn gsockets.Connection) {
-	l.getNamespace(appId).AddConnection(conn)
+	if l.getNamespace(appId).AddConnection(conn) {
+		l.metrics.ConnectionAdded(appId)
+	}
 }
 
 func (l *localChannelManager) RemoveConnection(appId string, conn gsockets.Connection) {
-	l.getNamespace(appId).RemoveConnection(conn.Id())
+	namespace := l.getNamespace(appId)
+	if _, err := namespace.GetConnection(conn.Id()); err != nil {
+		return
+	}
+
+	vacated := l.removeFromChannels(appId, conn, namespace.GetChannels()...)
+	namespace.RemoveConnection(conn.Id())
+
+	l.metrics.ConnectionRemoved(appId)
+	l.channelsVacated(conn.App(), vacated...)
 }
 
 func (l *localChannelManager) GetLocalConnections(appId string) []gsockets.Connection {
@@ -51,6 +126,10 @@ func (l *localChannelManager) GetLocalConnections(appId string) []gsockets.Conne
 	return conns
 }
 
+func (l *localChannelManager) GetGlobalConnectionCount(appId string) int {
+	return l.getNamespace(appId).ConnectionCount()
+}
+
 func (l *localChannelManager) GetLocalChannels(appId string) []string {
 	return l.getNamespace(appId).GetChannels()
 }
@@ -71,6 +150,55 @@ func (l *localChannelManager) GetGlobalChannelsWithConnectionCount(appId string)
 	return ret
 }
 
+func (l *localChannelManager) ReservePresenceMember(appId, channelName, userId string) func() {
+	key := appId + "#" + channelName
+
+	l.reservationLock.Lock()
+	defer l.reservationLock.Unlock()
+
+	if l.reservations[key] == nil {
+		l.reservations[key] = make(map[string]int)
+	}
+
+	l.reservations[key][userId]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.reservationLock.Lock()
+			defer l.reservationLock.Unlock()
+
+			if l.reservations[key][userId]--; l.reservations[key][userId] == 0 {
+				delete(l.reservations[key], userId)
+			}
+
+			if len(l.reservations[key]) == 0 {
+				delete(l.reservations, key)
+			}
+		})
+	}
+}
+
+func (l *localChannelManager) GetPresenceMemberIds(appId, channelName string) []string {
+	members := l.GetChannelMembers(appId, channelName)
+
+	ret := make([]string, 0, len(members))
+	for userId := range members {
+		ret = append(ret, userId)
+	}
+
+	l.reservationLock.Lock()
+	defer l.reservationLock.Unlock()
+
+	for userId := range l.reservations[appId+"#"+channelName] {
+		if _, ok := members[userId]; !ok {
+			ret = append(ret, userId)
+		}
+	}
+
+	return ret
+}
+
 func (l *localChannelManager) GetChannelConnectionCount(appId string, channelName string) int {
 	conns := l.getNamespace(appId).GetChannelConnections(channelName)
 	return len(conns)
@@ -80,40 +208,187 @@ func (l *localChannelManager) GetChannelMembers(appId, channelName string) map[s
 	return l.getNamespace(appId).GetChannelMembers(channelName)
 }
 
-func (l *localChannelManager) SetUser(appId, userId, connId string) {
-	l.getNamespace(appId).AddUser(userId, connId)
+// SetUser sends the watched users already online to the connection, and notifies the watchers of the
+// user when it's the first connection of the user.
+func (l *localChannelManager) SetUser(appId, userId, connId string, watchlist []string) {
+	namespace := l.getNamespace(appId)
+	first := namespace.AddUser(userId, connId, watchlist)
+
+	if conn, err := namespace.GetConnection(connId); err == nil && len(watchlist) > 0 {
+		online := append(namespace.GetOnlineUsers(watchlist), l.usersOnlineElsewhere(appId, watchlist)...)
+		if len(online) > 0 {
+			conn.Send(watchlistEvent(watchlistOnline, online...))
+		}
+	}
+
+	if first && len(l.usersOnlineElsewhere(appId, []string{userId})) == 0 {
+		l.notifyWatchers(appId, userId, watchlistEvent(watchlistOnline, userId))
+	}
 }
 
+// RemoveUser notifies the watchers of the user when it was the last connection of the user.
 func (l *localChannelManager) RemoveUser(appId, userId, connId string) {
-	l.getNamespace(appId).RemoveUser(userId, connId)
+	last := l.getNamespace(appId).RemoveUser(userId, connId)
+
+	if last && len(l.usersOnlineElsewhere(appId, []string{userId})) == 0 {
+		l.notifyWatchers(appId, userId, watchlistEvent(watchlistOffline, userId))
+	}
+}
+
+func (l *localChannelManager) sendToWatchers(appId, userId string, data any) {
+	for _, conn := range l.getNamespace(appId).GetWatchers(userId) {
+		conn.Send(data)
+	}
 }
 
 func (l *localChannelManager) GetUserConnections(appId, userId string) []gsockets.Connection {
 	return l.getNamespace(appId).GetUserConnections(userId)
 }
 
-func (l *localChannelManager) TerminateUserConnections(appId, userId string) {
-	conns := l.getNamespace(appId).GetChannelConnections(userId)
-	for _, conn := range conns {
-		pusherErr := gsockets.NewPusherError("pusher:error", "disconnected by the server", "", gsockets.ERROR_CONNECTION_IS_UNAUTHORIZED)
+func (l *localChannelManager) BroadcastToUser(appId, userId string, data any) {
+	for _, conn := range l.GetUserConnections(appId, userId) {
+		conn.Send(data)
+	}
+}
 
-		go func(conn gsockets.Connection) {
-			conn.Send(pusherErr)
-			conn.Close()
-		}(conn)
+func (l *localChannelManager) TerminateUserConnections(appId, userId string) int {
+	conns := l.GetUserConnections(appId, userId)
+	for _, conn := range conns {
+		go conn.CloseWithCode(gsockets.ERROR_CONNECTION_IS_UNAUTHORIZED, "Connection terminated by the server")
 	}
+
+	return len(conns)
 }
 
 func (l *localChannelManager) SubscribeToChannel(appId string, channelName string, conn gsockets.Connection, payload any) {
-	l.getNamespace(appId).AddConnectionToChannel(channelName, conn)
+	namespace := l.getNamespace(appId)
+
+	l.membershipLock.Lock()
+	newMember := l.isNewMember(namespace, channelName, conn)
+	created := namespace.AddConnectionToChannel(channelName, conn)
+	l.membershipLock.Unlock()
+
+	if created {
+		l.metrics.ChannelAdded(appId)
+		l.channelsChanged(appId, channelName)
+	}
+
+	if newMember {
+		l.metrics.PresenceMemberAdded(appId)
+	}
+
+	if created {
+		l.sendChannelWebhook(conn.App(), gsockets.WEBHOOK_CHANNEL_OCCUPIED, channelName)
+	}
+
+	l.counter.changed(conn.App(), channelName)
 }
 
 func (l *localChannelManager) UnsubscribeFromChannel(appId string, channelName string, conn gsockets.Connection) {
-	l.getNamespace(appId).RemoveConnectionFromChannel(conn.Id(), channelName)
+	vacated := l.removeFromChannels(appId, conn, channelName)
+	l.channelsVacated(conn.App(), vacated...)
 }
 
 func (l *localChannelManager) UnsubscribeFromAllChannels(appId string, conn string) {
-	l.getNamespace(appId).RemoveConnectionFromChannel(conn, l.GetLocalChannels(appId)...)
+	namespace := l.getNamespace(appId)
+
+	c, err := namespace.GetConnection(conn)
+	if err != nil {
+		l.channelsChanged(appId, namespace.RemoveConnectionFromChannel(conn, namespace.GetChannels()...)...)
+		return
+	}
+
+	l.removeFromChannels(appId, c, namespace.GetChannels()...)
+}
+
+// isNewMember returns true if the connection is joining a presence channel as a user not yet present
+// in it on this instance. The presence of the connection must be set before subscribing.
+func (l *localChannelManager) isNewMember(namespace *gsockets.Namespace, channelName string, conn gsockets.Connection) bool {
+	member, ok := conn.GetPresence(channelName)
+	if !ok || namespace.IsInChannel(conn.Id(), channelName) {
+		return false
+	}
+
+	_, exists := namespace.GetChannelMembers(channelName)[member.UserId]
+	return !exists
+}
+
+// removeFromChannels removes the connection from the channels, updating the metrics for the presence
+// members leaving and the channels vacated on this instance. Returns the channels vacated.
+func (l *localChannelManager) removeFromChannels(appId string, conn gsockets.Connection, channels ...string) []string {
+	namespace := l.getNamespace(appId)
+	vacated := make([]string, 0)
+
+	l.membershipLock.Lock()
+
+	for _, channelName := range channels {
+		if !namespace.IsInChannel(conn.Id(), channelName) {
+			continue
+		}
+
+		vacated = append(vacated, namespace.RemoveConnectionFromChannel(conn.Id(), channelName)...)
+		l.counter.changed(conn.App(), channelName)
+
+		if member, ok := conn.GetPresence(channelName); ok {
+			if _, exists := namespace.GetChannelMembers(channelName)[member.UserId]; !exists {
+				l.metrics.PresenceMemberRemoved(appId)
+			}
+		}
+	}
+
+	l.membershipLock.Unlock()
+
+	for range vacated {
+		l.metrics.ChannelRemoved(appId)
+	}
+
+	l.channelsChanged(appId, vacated...)
+
+	return vacated
+}
+
+// sendSubscriptionCount sends the number of connections subscribed to the channel to its subscribers
+// and to the subscription_count webhook.
+func (l *localChannelManager) sendSubscriptionCount(app *gsockets.App, channel string) {
+	count, send := l.countSubscriptions(app.ID, channel)
+	if !send || !l.counter.swap(app.ID, channel, count) {
+		return
+	}
+
+	l.sendCount(app.ID, channel, count)
+
+	if l.webhooks != nil {
+		l.webhooks.Send(app, gsockets.WebhookEvent{Name: gsockets.WEBHOOK_SUBSCRIPTION_COUNT, Channel: channel, SubscriptionCount: &count})
+	}
+}
+
+// channelsVacated sends the channel_vacated webhook for the channels no longer having any
+// connection in this instance, unless other nodes still have connections subscribed to them.
+func (l *localChannelManager) channelsVacated(app *gsockets.App, channels ...string) {
+	l.sendChannelWebhook(app, gsockets.WEBHOOK_CHANNEL_VACATED, channels...)
+}
+
+// sendChannelWebhook sends the webhook event for the channels having no connection subscribed to them
+// on the other nodes.
+func (l *localChannelManager) sendChannelWebhook(app *gsockets.App, name string, channels ...string) {
+	if l.webhooks == nil || len(channels) == 0 {
+		return
+	}
+
+	send := func() {
+		for _, channelName := range channels {
+			if l.remoteChannelCount == nil || l.remoteChannelCount(app.ID, channelName) == 0 {
+				l.webhooks.Send(app, gsockets.WebhookEvent{Name: name, Channel: channelName})
+			}
+		}
+	}
+
+	if l.remoteChannelCount == nil {
+		send()
+		return
+	}
+
+	go send()
 }
 
 func (l *localChannelManager) IsInChannel(appId string, channel string, conn gsockets.Connection) bool {
@@ -121,6 +396,10 @@ func (l *localChannelManager) IsInChannel(appId string, channel string, conn gso
 }
 
 func (l *localChannelManager) BroadcastToChannel(appId string, channel string, data any) {
+	if channels.IsCache(channel) {
+		l.cache.set(appId, channel, data)
+	}
+
 	conns := l.getNamespace(appId).GetChannelConnections(channel)
 
 	for _, conn := range conns {
@@ -129,6 +408,10 @@ func (l *localChannelManager) BroadcastToChannel(appId string, channel string, d
 }
 
 func (l *localChannelManager) BroadcastExcept(appId string, channel string, data any, connId string) {
+	if channels.IsCache(channel) {
+		l.cache.set(appId, channel, data)
+	}
+
 	conns := l.getNamespace(appId).GetChannelConnections(channel)
 
 	for _, conn := range conns {
@@ -139,3 +422,7 @@ func (l *localChannelManager) BroadcastExcept(appId string, channel string, data
 		conn.Send(data)
 	}
 }
+
+func (l *localChannelManager) GetCachedEvent(appId, channel string) (json.RawMessage, bool) {
+	return l.cache.get(appId, channel)
+}
@@ -0,0 +1,151 @@
+package channelmanagers
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+// gaugeMetrics records the gauges updated by the channel manager.
+type gaugeMetrics struct {
+	gsockets.Metrics
+
+	connections int
+	channels    int
+	members     int
+	lock        sync.Mutex
+}
+
+func (g *gaugeMetrics) add(gauge *int, delta int) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	*gauge += delta
+}
+
+func (g *gaugeMetrics) ConnectionAdded(appId string)       { g.add(&g.connections, 1) }
+func (g *gaugeMetrics) ConnectionRemoved(appId string)     { g.add(&g.connections, -1) }
+func (g *gaugeMetrics) ChannelAdded(appId string)          { g.add(&g.channels, 1) }
+func (g *gaugeMetrics) ChannelRemoved(appId string)        { g.add(&g.channels, -1) }
+func (g *gaugeMetrics) PresenceMemberAdded(appId string)   { g.add(&g.members, 1) }
+func (g *gaugeMetrics) PresenceMemberRemoved(appId string) { g.add(&g.members, -1) }
+
+func TestLocalChannelManagerMetrics(t *testing.T) {
+	m := &gaugeMetrics{Metrics: metrics.NewNoop()}
+	cm := newLocalChannelManager(0, 0, nil, m)
+
+	first := newTestConnection("1.1")
+	second := newTestConnection("1.2")
+
+	// Both connections belong to the same user, who must be counted once.
+	for _, conn := range []*testConnection{first, second} {
+		cm.AddConnection("app-id", conn)
+		conn.SetPresence("presence-room", gsockets.PresenceMember{UserId: "alice"})
+		cm.SubscribeToChannel("app-id", "presence-room", conn, nil)
+		cm.SubscribeToChannel("app-id", "public", conn, nil)
+	}
+
+	assert.Equal(t, 2, m.connections)
+	assert.Equal(t, 2, m.channels)
+	assert.Equal(t, 1, m.members)
+
+	cm.UnsubscribeFromChannel("app-id", "presence-room", first)
+	assert.Equal(t, 1, m.members, "user must stay in the channel while connected from another connection")
+
+	cm.RemoveConnection("app-id", second)
+	assert.Equal(t, 1, m.connections)
+	assert.Equal(t, 1, m.channels, "public channel must still be occupied by the first connection")
+	assert.Equal(t, 0, m.members)
+
+	cm.RemoveConnection("app-id", first)
+	cm.RemoveConnection("app-id", first)
+	assert.Equal(t, 0, m.connections, "removing a connection twice must not be counted twice")
+	assert.Equal(t, 0, m.channels)
+}
+
+func TestLocalChannelManagerWatchlistEvents(t *testing.T) {
+	cm := newLocalChannelManager(0, 0, nil, metrics.NewNoop())
+
+	watcher := newTestConnection("1.1")
+	first := newTestConnection("1.2")
+	second := newTestConnection("1.3")
+
+	for _, conn := range []*testConnection{watcher, first, second} {
+		cm.AddConnection("app-id", conn)
+	}
+
+	cm.SetUser("app-id", "bob", first.Id(), nil)
+	cm.SetUser("app-id", "alice", watcher.Id(), []string{"bob", "carol"})
+	assert.Equal(t, []string{`{"event":"pusher:watchlist_events","data":{"events":[{"name":"online","user_ids":["bob"]}]}}`}, watcher.messages(), "online watched users must be sent on signin")
+
+	cm.SetUser("app-id", "carol", second.Id(), nil)
+	cm.SetUser("app-id", "bob", second.Id(), nil)
+	cm.RemoveUser("app-id", "bob", first.Id())
+
+	assert.Len(t, watcher.messages(), 2, "only the first and last connection of a user must be notified")
+	assert.Equal(t, `{"event":"pusher:watchlist_events","data":{"events":[{"name":"online","user_ids":["carol"]}]}}`, watcher.messages()[1])
+
+	cm.RemoveUser("app-id", "bob", second.Id())
+	assert.Equal(t, `{"event":"pusher:watchlist_events","data":{"events":[{"name":"offline","user_ids":["bob"]}]}}`, watcher.messages()[2])
+
+	cm.RemoveUser("app-id", "alice", watcher.Id())
+	cm.SetUser("app-id", "bob", first.Id(), nil)
+	assert.Len(t, watcher.messages(), 3, "watchlist must be dropped with the user")
+}
+
+func TestLocalChannelManagerTerminateUserConnections(t *testing.T) {
+	cm := newLocalChannelManager(0, 0, nil, metrics.NewNoop())
+
+	first := newTestConnection("1.1")
+	second := newTestConnection("1.2")
+	other := newTestConnection("1.3")
+
+	for _, conn := range []*testConnection{first, second, other} {
+		cm.AddConnection("app-id", conn)
+	}
+
+	cm.SetUser("app-id", "alice", first.Id(), nil)
+	cm.SetUser("app-id", "alice", second.Id(), nil)
+	cm.SetUser("app-id", "bob", other.Id(), nil)
+
+	assert.Equal(t, 2, cm.TerminateUserConnections("app-id", "alice"))
+
+	for _, conn := range []*testConnection{first, second} {
+		assert.Eventually(t, func() bool { return conn.closeCode() == gsockets.ERROR_CONNECTION_IS_UNAUTHORIZED }, time.Second, 10*time.Millisecond, "connections of the user must be closed with 4009")
+	}
+
+	assert.Zero(t, other.closeCode(), "connections of other users must stay open")
+	assert.Zero(t, cm.TerminateUserConnections("app-id", "carol"))
+}
+
+func TestLocalChannelManagerSubscriptionCount(t *testing.T) {
+	cm := newLocalChannelManager(0, 20*time.Millisecond, nil, metrics.NewNoop())
+
+	conns := []*testConnection{newTestConnection("1.1"), newTestConnection("1.2"), newTestConnection("1.3")}
+	for _, conn := range conns {
+		conn.app.EnableSubscriptionCount = true
+		cm.AddConnection("app-id", conn)
+		cm.SubscribeToChannel("app-id", "my-channel", conn, nil)
+		cm.SubscribeToChannel("app-id", "presence-room", conn, nil)
+	}
+
+	expected := `{"event":"pusher_internal:subscription_count","channel":"my-channel","data":"{\"subscription_count\":3}"}`
+	for _, conn := range conns {
+		assert.Eventually(t, func() bool { return len(conn.messages()) == 1 }, time.Second, 10*time.Millisecond, "changes must be sent once per interval")
+		assert.Equal(t, []string{expected}, conn.messages(), "presence channels must not receive the count")
+	}
+
+	cm.UnsubscribeFromChannel("app-id", "my-channel", conns[2])
+	assert.Eventually(t, func() bool { return len(conns[0].messages()) == 2 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, `{"event":"pusher_internal:subscription_count","channel":"my-channel","data":"{\"subscription_count\":2}"}`, conns[0].messages()[1])
+
+	// A count back to the last value sent is not sent again.
+	cm.SubscribeToChannel("app-id", "my-channel", conns[2], nil)
+	cm.UnsubscribeFromChannel("app-id", "my-channel", conns[2])
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, conns[0].messages(), 2)
+}
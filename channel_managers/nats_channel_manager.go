@@ -0,0 +1,363 @@
+package channelmanagers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/config"
+	"github.com/gsockets/gsockets/log"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// defaultNatsPrefix is used as the root token for the subjects when no prefix is configured.
+	defaultNatsPrefix = "gsockets"
+
+	// natsHeartbeatInterval is the time between two heartbeats sent by a node to announce itself.
+	natsHeartbeatInterval = 5 * time.Second
+
+	// natsNodeExpiry is the time after which a node that has not sent any heartbeat is considered gone.
+	natsNodeExpiry = 3 * natsHeartbeatInterval
+)
+
+// natsHeartbeat is periodically published by every node so the other nodes know how many
+// replies to wait for when they send a request.
+type natsHeartbeat struct {
+	NodeId string `json:"node_id"`
+
+	// Hello is set when a node joins, asking the other nodes to announce themselves right away.
+	Hello bool `json:"hello,omitempty"`
+
+	// Leaving is set when a node shuts down.
+	Leaving bool `json:"leaving,omitempty"`
+}
+
+// natsBroker uses nats subjects to exchange messages between the nodes. Broadcasts are published
+// on one subject per app and channel, and every node only subscribes to the subjects of the channels
+// having local subscribers. Requests use the nats request/reply mechanism.
+type natsBroker struct {
+	nodeId string
+	prefix string
+
+	conn *nats.Conn
+	subs []*nats.Subscription
+
+	// channels stores the subscriptions to the broadcast subjects of the channels having subscribers
+	// on this node, keyed by subject.
+	channels     map[string]*nats.Subscription
+	channelsLock sync.Mutex
+	onBroadcast  nats.MsgHandler
+
+	// nodes stores the last time a heartbeat was received from each of the other nodes.
+	nodes     map[string]time.Time
+	nodesLock sync.Mutex
+
+	done      chan struct{}
+	closeOnce sync.Once
+	logger    log.Logger
+}
+
+func newNatsChannelManager(config config.ChannelManager, nodeId string, webhooks gsockets.WebhookSender, metrics gsockets.Metrics, logger log.Logger) (gsockets.ChannelManager, error) {
+	url := config.Nats.Url
+	if url == "" {
+		url = nats.DefaultURL
+	}
+
+	prefix := config.Nats.Prefix
+	if prefix == "" {
+		prefix = defaultNatsPrefix
+	}
+
+	conn, err := nats.Connect(url, nats.Name("gsockets-"+nodeId))
+	if err != nil {
+		return nil, err
+	}
+
+	logger = logger.With("module", "nats_channel_manager")
+	b := &natsBroker{
+		nodeId:   nodeId,
+		prefix:   prefix,
+		conn:     conn,
+		channels: make(map[string]*nats.Subscription),
+		nodes:    make(map[string]time.Time),
+		done:     make(chan struct{}),
+		logger:   logger,
+	}
+
+	cm, err := newHorizontalChannelManager(nodeId, b, config, config.RequestTimeout, webhooks, metrics, logger)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return cm, nil
+}
+
+// subjectToken encodes the app ids and channel names used in the subjects, which can contain the
+// characters nats gives a meaning to, like dots and wildcards.
+func subjectToken(name string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(name))
+}
+
+func (n *natsBroker) broadcastSubject(appId, channel string) string {
+	return n.prefix + ".broadcast." + subjectToken(appId) + "." + subjectToken(channel)
+}
+
+// usersSubject carries the messages sent to the connections of a user, or to the connections watching
+// a user, which have no channel to build a broadcast subject from.
+func (n *natsBroker) usersSubject(appId string) string {
+	return n.prefix + ".users." + subjectToken(appId)
+}
+
+// messageSubject returns the subject a broadcast message is published on.
+func (n *natsBroker) messageSubject(msg brokerMessage) string {
+	if msg.UserId != "" || msg.WatchedUserId != "" {
+		return n.usersSubject(msg.AppId)
+	}
+
+	return n.broadcastSubject(msg.AppId, msg.Channel)
+}
+
+func (n *natsBroker) requestSubject(appId string) string {
+	return n.prefix + ".requests." + subjectToken(appId)
+}
+
+func (n *natsBroker) heartbeatSubject() string {
+	return n.prefix + ".nodes"
+}
+
+func (n *natsBroker) listen(handler brokerHandler) error {
+	n.onBroadcast = func(msg *nats.Msg) {
+		var bm brokerMessage
+		if err := json.Unmarshal(msg.Data, &bm); err != nil {
+			n.logger.Error("msg", "error decoding broadcast message", "error", err.Error())
+			return
+		}
+
+		handler.onMessage(bm)
+	}
+
+	users, err := n.conn.Subscribe(n.prefix+".users.*", n.onBroadcast)
+	if err != nil {
+		return err
+	}
+
+	requests, err := n.conn.Subscribe(n.prefix+".requests.>", func(msg *nats.Msg) {
+		var req brokerRequest
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			n.logger.Error("msg", "error decoding request message", "error", err.Error())
+			return
+		}
+
+		if req.NodeId == n.nodeId || msg.Reply == "" {
+			return
+		}
+
+		resp, err := json.Marshal(handler.onRequest(req))
+		if err != nil {
+			n.logger.Error("msg", "error encoding response message", "error", err.Error())
+			return
+		}
+
+		if err := msg.Respond(resp); err != nil {
+			n.logger.Error("msg", "error sending response message", "error", err.Error())
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	heartbeats, err := n.conn.Subscribe(n.heartbeatSubject(), n.handleHeartbeat)
+	if err != nil {
+		return err
+	}
+
+	n.subs = []*nats.Subscription{users, requests, heartbeats}
+
+	if err := n.sendHeartbeat(natsHeartbeat{NodeId: n.nodeId, Hello: true}); err != nil {
+		return err
+	}
+
+	if err := n.conn.Flush(); err != nil {
+		return err
+	}
+
+	go n.heartbeatLoop()
+
+	return nil
+}
+
+// syncChannel subscribes to the broadcast subject of the channel while it has subscribers on this node.
+// The subscription is flushed, so the broadcasts sent once the subscription to the channel succeeded
+// are received.
+func (n *natsBroker) syncChannel(appId, channel string, occupied func() bool) error {
+	subject := n.broadcastSubject(appId, channel)
+
+	n.channelsLock.Lock()
+	defer n.channelsLock.Unlock()
+
+	sub, subscribed := n.channels[subject]
+	if occupied() == subscribed {
+		return nil
+	}
+
+	if subscribed {
+		delete(n.channels, subject)
+		return sub.Unsubscribe()
+	}
+
+	sub, err := n.conn.Subscribe(subject, n.onBroadcast)
+	if err != nil {
+		return err
+	}
+
+	n.channels[subject] = sub
+
+	return n.conn.Flush()
+}
+
+func (n *natsBroker) handleHeartbeat(msg *nats.Msg) {
+	var hb natsHeartbeat
+	if err := json.Unmarshal(msg.Data, &hb); err != nil {
+		n.logger.Error("msg", "error decoding heartbeat message", "error", err.Error())
+		return
+	}
+
+	if hb.NodeId == n.nodeId {
+		return
+	}
+
+	n.nodesLock.Lock()
+	if hb.Leaving {
+		delete(n.nodes, hb.NodeId)
+	} else {
+		n.nodes[hb.NodeId] = time.Now()
+	}
+	n.nodesLock.Unlock()
+
+	if hb.Hello {
+		if err := n.sendHeartbeat(natsHeartbeat{NodeId: n.nodeId}); err != nil {
+			n.logger.Error("msg", "error sending heartbeat", "error", err.Error())
+		}
+	}
+}
+
+func (n *natsBroker) heartbeatLoop() {
+	ticker := time.NewTicker(natsHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := n.sendHeartbeat(natsHeartbeat{NodeId: n.nodeId}); err != nil {
+				n.logger.Error("msg", "error sending heartbeat", "error", err.Error())
+			}
+		case <-n.done:
+			return
+		}
+	}
+}
+
+func (n *natsBroker) sendHeartbeat(hb natsHeartbeat) error {
+	payload, err := json.Marshal(hb)
+	if err != nil {
+		return err
+	}
+
+	return n.conn.Publish(n.heartbeatSubject(), payload)
+}
+
+// nodeCount returns the number of other nodes that are currently alive.
+func (n *natsBroker) nodeCount() int {
+	n.nodesLock.Lock()
+	defer n.nodesLock.Unlock()
+
+	for nodeId, lastSeen := range n.nodes {
+		if time.Since(lastSeen) > natsNodeExpiry {
+			delete(n.nodes, nodeId)
+		}
+	}
+
+	return len(n.nodes)
+}
+
+func (n *natsBroker) publish(ctx context.Context, msg brokerMessage) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	return n.conn.Publish(n.messageSubject(msg), payload)
+}
+
+func (n *natsBroker) request(ctx context.Context, req brokerRequest) ([]brokerResponse, error) {
+	expected := n.nodeCount()
+	if expected == 0 {
+		return nil, nil
+	}
+
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	inbox := nats.NewInbox()
+	sub, err := n.conn.SubscribeSync(inbox)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = sub.Unsubscribe() }()
+
+	if err := n.conn.PublishRequest(n.requestSubject(req.AppId), inbox, payload); err != nil {
+		return nil, err
+	}
+
+	responses := make([]brokerResponse, 0, expected)
+	for len(responses) < expected {
+		msg, err := sub.NextMsgWithContext(ctx)
+		if err != nil {
+			return responses, err
+		}
+
+		var resp brokerResponse
+		if err := json.Unmarshal(msg.Data, &resp); err != nil {
+			n.logger.Error("msg", "error decoding response message", "error", err.Error())
+			continue
+		}
+
+		responses = append(responses, resp)
+	}
+
+	return responses, nil
+}
+
+func (n *natsBroker) close() error {
+	var err error
+	n.closeOnce.Do(func() {
+		close(n.done)
+
+		if err := n.sendHeartbeat(natsHeartbeat{NodeId: n.nodeId, Leaving: true}); err != nil {
+			n.logger.Error("msg", "error sending leave heartbeat", "error", err.Error())
+		}
+
+		for _, sub := range n.subs {
+			_ = sub.Unsubscribe()
+		}
+
+		n.channelsLock.Lock()
+		for subject, sub := range n.channels {
+			_ = sub.Unsubscribe()
+			delete(n.channels, subject)
+		}
+		n.channelsLock.Unlock()
+
+		err = n.conn.Drain()
+	})
+
+	return err
+}
@@ -0,0 +1,231 @@
+package channelmanagers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/config"
+	"github.com/gsockets/gsockets/log"
+	"github.com/gsockets/gsockets/metrics"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestNatsNodes(t *testing.T, nodeIds ...string) []gsockets.ChannelManager {
+	ns, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go ns.Start()
+	t.Cleanup(ns.Shutdown)
+
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server did not start")
+	}
+
+	cfg := config.ChannelManager{
+		Driver:         "nats",
+		RequestTimeout: time.Second,
+		Nats:           config.NatsChannelManager{Url: ns.ClientURL()},
+	}
+
+	nodes := make([]gsockets.ChannelManager, len(nodeIds))
+	for i, nodeId := range nodeIds {
+		cm, err := New(cfg, nodeId, nil, metrics.NewNoop(), log.New())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() { _ = cm.(*horizontalChannelManager).Close() })
+		nodes[i] = cm
+	}
+
+	// Wait until every node discovered all the other nodes.
+	for _, cm := range nodes {
+		b := cm.(*horizontalChannelManager).broker.(*natsBroker)
+		assert.Eventually(t, func() bool { return b.nodeCount() == len(nodeIds)-1 }, time.Second, 10*time.Millisecond, "nodes must discover each other")
+	}
+
+	return nodes
+}
+
+func TestNatsBroadcastReachesOtherNodes(t *testing.T) {
+	nodes := newTestNatsNodes(t, "node-1", "node-2")
+
+	local := newTestConnection("1.1")
+	remote := newTestConnection("2.1")
+
+	nodes[0].AddConnection("app-id", local)
+	nodes[0].SubscribeToChannel("app-id", "my-channel", local, nil)
+	nodes[1].AddConnection("app-id", remote)
+	nodes[1].SubscribeToChannel("app-id", "my-channel", remote, nil)
+
+	nodes[0].BroadcastToChannel("app-id", "my-channel", map[string]string{"event": "hello"})
+
+	expected := []string{`{"event":"hello"}`}
+	assert.Equal(t, expected, local.messages(), "local connection must receive the broadcast once")
+	assert.Eventually(t, func() bool { return len(remote.messages()) == 1 }, time.Second, 10*time.Millisecond, "remote connection must receive the broadcast")
+	assert.Equal(t, expected, remote.messages(), "remote connection must receive the same payload")
+}
+
+func TestNatsBroadcastExceptSkipsConnectionOnOtherNode(t *testing.T) {
+	nodes := newTestNatsNodes(t, "node-1", "node-2")
+
+	excluded := newTestConnection("2.1")
+	other := newTestConnection("2.2")
+
+	for _, conn := range []*testConnection{excluded, other} {
+		nodes[1].AddConnection("app-id", conn)
+		nodes[1].SubscribeToChannel("app-id", "private-channel", conn, nil)
+	}
+
+	nodes[0].BroadcastExcept("app-id", "private-channel", "data", excluded.Id())
+
+	assert.Eventually(t, func() bool { return len(other.messages()) == 1 }, time.Second, 10*time.Millisecond, "other connection must receive the broadcast")
+	assert.Empty(t, excluded.messages(), "excluded connection must not receive the broadcast")
+}
+
+func TestNatsGlobalQueriesAggregateAcrossNodes(t *testing.T) {
+	nodes := newTestNatsNodes(t, "node-1", "node-2", "node-3")
+
+	first := newTestConnection("1.1")
+	second := newTestConnection("2.1")
+	third := newTestConnection("3.1")
+
+	first.SetPresence("presence-room", gsockets.PresenceMember{UserId: "alice"})
+	second.SetPresence("presence-room", gsockets.PresenceMember{UserId: "bob"})
+
+	nodes[0].AddConnection("app-id", first)
+	nodes[0].SubscribeToChannel("app-id", "presence-room", first, nil)
+	nodes[1].AddConnection("app-id", second)
+	nodes[1].SubscribeToChannel("app-id", "presence-room", second, nil)
+	nodes[2].AddConnection("app-id", third)
+	nodes[2].SubscribeToChannel("app-id", "public", third, nil)
+
+	assert.ElementsMatch(t, []string{"presence-room", "public"}, nodes[0].GetGlobalChannels("app-id"))
+	assert.Equal(t, map[string]int{"presence-room": 2, "public": 1}, nodes[2].GetGlobalChannelsWithConnectionCount("app-id"))
+	assert.Equal(t, 2, nodes[2].GetChannelConnectionCount("app-id", "presence-room"))
+
+	members := nodes[2].GetChannelMembers("app-id", "presence-room")
+	assert.Len(t, members, 2, "members from all the nodes must be returned")
+	assert.Contains(t, members, "alice")
+	assert.Contains(t, members, "bob")
+}
+
+func TestNatsLeavingNodeIsForgotten(t *testing.T) {
+	nodes := newTestNatsNodes(t, "node-1", "node-2")
+
+	leaving := nodes[1].(*horizontalChannelManager)
+	_ = leaving.broker.close()
+
+	b := nodes[0].(*horizontalChannelManager).broker.(*natsBroker)
+	assert.Eventually(t, func() bool { return b.nodeCount() == 0 }, time.Second, 10*time.Millisecond, "leaving node must be removed")
+}
+
+func TestNatsBroadcastToUserReachesOtherNodes(t *testing.T) {
+	nodes := newTestNatsNodes(t, "node-1", "node-2")
+
+	local := newTestConnection("1.1")
+	remote := newTestConnection("2.1")
+	other := newTestConnection("2.2")
+
+	nodes[0].AddConnection("app-id", local)
+	nodes[0].SetUser("app-id", "alice", local.Id(), nil)
+	nodes[1].AddConnection("app-id", remote)
+	nodes[1].SetUser("app-id", "alice", remote.Id(), nil)
+	nodes[1].AddConnection("app-id", other)
+	nodes[1].SetUser("app-id", "bob", other.Id(), nil)
+
+	nodes[0].BroadcastToUser("app-id", "alice", map[string]string{"event": "hello"})
+
+	expected := []string{`{"event":"hello"}`}
+	assert.Equal(t, expected, local.messages())
+	assert.Eventually(t, func() bool { return len(remote.messages()) == 1 }, time.Second, 10*time.Millisecond, "user connection on the other node must receive the event")
+	assert.Equal(t, expected, remote.messages())
+	assert.Empty(t, other.messages(), "connections of other users must not receive the event")
+}
+
+func TestNatsWatchlistAcrossNodes(t *testing.T) {
+	nodes := newTestNatsNodes(t, "node-1", "node-2")
+
+	watcher := newTestConnection("1.1")
+	late := newTestConnection("1.2")
+	first := newTestConnection("2.1")
+	second := newTestConnection("1.3")
+
+	nodes[0].AddConnection("app-id", watcher)
+	nodes[0].AddConnection("app-id", late)
+	nodes[1].AddConnection("app-id", first)
+	nodes[0].AddConnection("app-id", second)
+
+	nodes[0].SetUser("app-id", "alice", watcher.Id(), []string{"bob"})
+	assert.Empty(t, watcher.messages(), "nothing is sent when no watched user is online")
+
+	online := `{"event":"pusher:watchlist_events","data":{"events":[{"name":"online","user_ids":["bob"]}]}}`
+
+	nodes[1].SetUser("app-id", "bob", first.Id(), nil)
+	assert.Eventually(t, func() bool { return len(watcher.messages()) == 1 }, time.Second, 10*time.Millisecond, "watchers on other nodes must be notified")
+	assert.Equal(t, online, watcher.messages()[0])
+
+	nodes[0].SetUser("app-id", "carol", late.Id(), []string{"bob"})
+	assert.Equal(t, []string{online}, late.messages(), "users online on other nodes must be sent on signin")
+
+	// bob is already online on the other node, so the second connection is not notified.
+	nodes[0].SetUser("app-id", "bob", second.Id(), nil)
+	nodes[0].RemoveUser("app-id", "bob", second.Id())
+	assert.Len(t, watcher.messages(), 1)
+
+	nodes[1].RemoveUser("app-id", "bob", first.Id())
+	assert.Eventually(t, func() bool { return len(watcher.messages()) == 2 }, time.Second, 10*time.Millisecond, "watchers on other nodes must be notified")
+	assert.Equal(t, `{"event":"pusher:watchlist_events","data":{"events":[{"name":"offline","user_ids":["bob"]}]}}`, watcher.messages()[1])
+}
+
+func TestNatsBroadcastWithDottedChannelName(t *testing.T) {
+	nodes := newTestNatsNodes(t, "node-1", "node-2")
+
+	dotted := newTestConnection("2.1")
+	prefixed := newTestConnection("2.2")
+
+	nodes[1].AddConnection("app-id", dotted)
+	nodes[1].SubscribeToChannel("app-id", "room.a.b", dotted, nil)
+	nodes[1].AddConnection("app-id", prefixed)
+	nodes[1].SubscribeToChannel("app-id", "room.a", prefixed, nil)
+
+	nodes[0].BroadcastToChannel("app-id", "room.a.b", map[string]string{"event": "dotted"})
+	nodes[0].BroadcastToChannel("app-id", "room.*", map[string]string{"event": "wildcard"})
+	nodes[0].BroadcastToChannel("app-id", "room.>", map[string]string{"event": "wildcard"})
+
+	assert.Eventually(t, func() bool { return len(dotted.messages()) == 1 }, time.Second, 10*time.Millisecond, "dotted channel must receive the broadcast")
+	assert.Equal(t, []string{`{"event":"dotted"}`}, dotted.messages())
+	assert.Empty(t, prefixed.messages(), "channels sharing a prefix or matched by wildcards must not receive the broadcasts")
+}
+
+func TestNatsSubscribesOnlyToOccupiedChannels(t *testing.T) {
+	nodes := newTestNatsNodes(t, "node-1")
+	b := nodes[0].(*horizontalChannelManager).broker.(*natsBroker)
+
+	subscribed := func() int {
+		b.channelsLock.Lock()
+		defer b.channelsLock.Unlock()
+
+		return len(b.channels)
+	}
+
+	first := newTestConnection("1.1")
+	second := newTestConnection("1.2")
+
+	for _, conn := range []*testConnection{first, second} {
+		nodes[0].AddConnection("app-id", conn)
+		nodes[0].SubscribeToChannel("app-id", "my-channel", conn, nil)
+	}
+
+	assert.Equal(t, 1, subscribed(), "the node must subscribe to the channel once")
+
+	nodes[0].UnsubscribeFromChannel("app-id", "my-channel", first)
+	assert.Equal(t, 1, subscribed(), "the channel still has a subscriber")
+
+	nodes[0].RemoveConnection("app-id", second)
+	assert.Equal(t, 0, subscribed(), "the vacated channel must be unsubscribed")
+}
@@ -0,0 +1,235 @@
+package channelmanagers
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/config"
+	"github.com/gsockets/gsockets/log"
+)
+
+// defaultRedisPrefix is used for the pub/sub channel names when no prefix is configured.
+const defaultRedisPrefix = "gsockets"
+
+// redisBroker uses redis pub/sub to exchange messages between the nodes. Every node listens on
+// three channels: one for broadcasts, one for requests, and one for the responses addressed to it.
+// The broadcasts are received on their own subscription, so the requests and responses never wait
+// behind the delivery of a broadcast to the local connections.
+type redisBroker struct {
+	nodeId string
+	prefix string
+
+	client     *redis.Client
+	broadcasts *redis.PubSub
+	requests   *redis.PubSub
+
+	// pending stores the response channels for the requests this node is waiting on,
+	// keyed by the request id.
+	pending     map[string]chan brokerResponse
+	pendingLock sync.Mutex
+
+	logger log.Logger
+}
+
+func newRedisChannelManager(config config.ChannelManager, nodeId string, webhooks gsockets.WebhookSender, metrics gsockets.Metrics, logger log.Logger) (gsockets.ChannelManager, error) {
+	url := config.Redis.Url
+	if url == "" {
+		url = "redis://localhost:6379/0"
+	}
+
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := config.Redis.Prefix
+	if prefix == "" {
+		prefix = defaultRedisPrefix
+	}
+
+	logger = logger.With("module", "redis_channel_manager")
+	b := &redisBroker{
+		nodeId:  nodeId,
+		prefix:  prefix,
+		client:  redis.NewClient(opts),
+		pending: make(map[string]chan brokerResponse),
+		logger:  logger,
+	}
+
+	return newHorizontalChannelManager(nodeId, b, config, config.RequestTimeout, webhooks, metrics, logger)
+}
+
+func (r *redisBroker) broadcastChannel() string {
+	return r.prefix + "#broadcast"
+}
+
+func (r *redisBroker) requestChannel() string {
+	return r.prefix + "#requests"
+}
+
+func (r *redisBroker) responseChannel(nodeId string) string {
+	return r.prefix + "#responses#" + nodeId
+}
+
+func (r *redisBroker) listen(handler brokerHandler) error {
+	ctx := context.Background()
+
+	var err error
+	if r.broadcasts, err = r.subscribe(ctx, r.broadcastChannel()); err != nil {
+		return err
+	}
+
+	if r.requests, err = r.subscribe(ctx, r.requestChannel(), r.responseChannel(r.nodeId)); err != nil {
+		_ = r.broadcasts.Close()
+		return err
+	}
+
+	go func() {
+		for msg := range r.broadcasts.Channel() {
+			r.handleBroadcast(handler, msg)
+		}
+	}()
+
+	go func() {
+		for msg := range r.requests.Channel() {
+			if msg.Channel == r.requestChannel() {
+				r.handleRequest(handler, msg)
+			} else {
+				r.handleResponse(msg)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// subscribe subscribes to the channels, waiting for the subscription to be confirmed so that
+// messages published right after the channel manager is created are not lost.
+func (r *redisBroker) subscribe(ctx context.Context, channels ...string) (*redis.PubSub, error) {
+	pubsub := r.client.Subscribe(ctx, channels...)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return nil, err
+	}
+
+	return pubsub, nil
+}
+
+func (r *redisBroker) handleBroadcast(handler brokerHandler, msg *redis.Message) {
+	var bm brokerMessage
+	if err := json.Unmarshal([]byte(msg.Payload), &bm); err != nil {
+		r.logger.Error("msg", "error decoding broadcast message", "error", err.Error())
+		return
+	}
+
+	handler.onMessage(bm)
+}
+
+func (r *redisBroker) handleRequest(handler brokerHandler, msg *redis.Message) {
+	var req brokerRequest
+	if err := json.Unmarshal([]byte(msg.Payload), &req); err != nil {
+		r.logger.Error("msg", "error decoding request message", "error", err.Error())
+		return
+	}
+
+	if req.NodeId == r.nodeId {
+		return
+	}
+
+	resp, err := json.Marshal(handler.onRequest(req))
+	if err != nil {
+		r.logger.Error("msg", "error encoding response message", "error", err.Error())
+		return
+	}
+
+	if err := r.client.Publish(context.Background(), r.responseChannel(req.NodeId), resp).Err(); err != nil {
+		r.logger.Error("msg", "error publishing response message", "error", err.Error())
+	}
+}
+
+func (r *redisBroker) handleResponse(msg *redis.Message) {
+	var resp brokerResponse
+	if err := json.Unmarshal([]byte(msg.Payload), &resp); err != nil {
+		r.logger.Error("msg", "error decoding response message", "error", err.Error())
+		return
+	}
+
+	r.pendingLock.Lock()
+	ch, ok := r.pending[resp.RequestId]
+	r.pendingLock.Unlock()
+
+	if ok {
+		select {
+		case ch <- resp:
+		default:
+		}
+	}
+}
+
+func (r *redisBroker) publish(ctx context.Context, msg brokerMessage) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	return r.client.Publish(ctx, r.broadcastChannel(), payload).Err()
+}
+
+func (r *redisBroker) request(ctx context.Context, req brokerRequest) ([]brokerResponse, error) {
+	subscribers, err := r.client.PubSubNumSub(ctx, r.requestChannel()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	// Every node, including this one, is subscribed to the request channel.
+	expected := int(subscribers[r.requestChannel()]) - 1
+	if expected <= 0 {
+		return nil, nil
+	}
+
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan brokerResponse, expected)
+
+	r.pendingLock.Lock()
+	r.pending[req.Id] = ch
+	r.pendingLock.Unlock()
+
+	defer func() {
+		r.pendingLock.Lock()
+		delete(r.pending, req.Id)
+		r.pendingLock.Unlock()
+	}()
+
+	if err := r.client.Publish(ctx, r.requestChannel(), payload).Err(); err != nil {
+		return nil, err
+	}
+
+	responses := make([]brokerResponse, 0, expected)
+	for len(responses) < expected {
+		select {
+		case resp := <-ch:
+			responses = append(responses, resp)
+		case <-ctx.Done():
+			return responses, ctx.Err()
+		}
+	}
+
+	return responses, nil
+}
+
+func (r *redisBroker) close() error {
+	for _, pubsub := range []*redis.PubSub{r.broadcasts, r.requests} {
+		if pubsub != nil {
+			_ = pubsub.Close()
+		}
+	}
+
+	return r.client.Close()
+}
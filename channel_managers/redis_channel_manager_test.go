@@ -0,0 +1,257 @@
+package channelmanagers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/config"
+	"github.com/gsockets/gsockets/log"
+	"github.com/gsockets/gsockets/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRedisNodes(t *testing.T, nodeIds ...string) []gsockets.ChannelManager {
+	server := miniredis.RunT(t)
+	cfg := config.ChannelManager{
+		Driver:                    "redis",
+		RequestTimeout:            time.Second,
+		SubscriptionCountInterval: 20 * time.Millisecond,
+		Redis:                     config.RedisChannelManager{Url: "redis://" + server.Addr()},
+	}
+
+	nodes := make([]gsockets.ChannelManager, len(nodeIds))
+	for i, nodeId := range nodeIds {
+		cm, err := New(cfg, nodeId, nil, metrics.NewNoop(), log.New())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() { _ = cm.(*horizontalChannelManager).Close() })
+		nodes[i] = cm
+	}
+
+	return nodes
+}
+
+func TestRedisNewReturnsHorizontalChannelManager(t *testing.T) {
+	nodes := newTestRedisNodes(t, "node-1")
+
+	_, ok := nodes[0].(*horizontalChannelManager)
+	assert.True(t, ok, "got invalid channel manager implementation")
+}
+
+func TestRedisBroadcastReachesOtherNodes(t *testing.T) {
+	nodes := newTestRedisNodes(t, "node-1", "node-2")
+
+	local := newTestConnection("1.1")
+	remote := newTestConnection("2.1")
+
+	nodes[0].AddConnection("app-id", local)
+	nodes[0].SubscribeToChannel("app-id", "my-channel", local, nil)
+	nodes[1].AddConnection("app-id", remote)
+	nodes[1].SubscribeToChannel("app-id", "my-channel", remote, nil)
+
+	nodes[0].BroadcastToChannel("app-id", "my-channel", map[string]string{"event": "hello"})
+
+	expected := []string{`{"event":"hello"}`}
+	assert.Equal(t, expected, local.messages(), "local connection must receive the broadcast once")
+	assert.Eventually(t, func() bool { return len(remote.messages()) == 1 }, time.Second, 10*time.Millisecond, "remote connection must receive the broadcast")
+	assert.Equal(t, expected, remote.messages(), "remote connection must receive the same payload")
+}
+
+func TestRedisBroadcastExceptSkipsConnectionOnOtherNode(t *testing.T) {
+	nodes := newTestRedisNodes(t, "node-1", "node-2")
+
+	excluded := newTestConnection("2.1")
+	other := newTestConnection("2.2")
+
+	for _, conn := range []*testConnection{excluded, other} {
+		nodes[1].AddConnection("app-id", conn)
+		nodes[1].SubscribeToChannel("app-id", "private-channel", conn, nil)
+	}
+
+	nodes[0].BroadcastExcept("app-id", "private-channel", "data", excluded.Id())
+
+	assert.Eventually(t, func() bool { return len(other.messages()) == 1 }, time.Second, 10*time.Millisecond, "other connection must receive the broadcast")
+	assert.Empty(t, excluded.messages(), "excluded connection must not receive the broadcast")
+}
+
+func TestRedisGlobalQueriesAggregateAcrossNodes(t *testing.T) {
+	nodes := newTestRedisNodes(t, "node-1", "node-2", "node-3")
+
+	first := newTestConnection("1.1")
+	second := newTestConnection("2.1")
+	third := newTestConnection("3.1")
+
+	first.SetPresence("presence-room", gsockets.PresenceMember{UserId: "alice"})
+	second.SetPresence("presence-room", gsockets.PresenceMember{UserId: "bob"})
+
+	nodes[0].AddConnection("app-id", first)
+	nodes[0].SubscribeToChannel("app-id", "presence-room", first, nil)
+	nodes[1].AddConnection("app-id", second)
+	nodes[1].SubscribeToChannel("app-id", "presence-room", second, nil)
+	nodes[2].AddConnection("app-id", third)
+	nodes[2].SubscribeToChannel("app-id", "public", third, nil)
+
+	assert.ElementsMatch(t, []string{"presence-room", "public"}, nodes[0].GetGlobalChannels("app-id"))
+	assert.Equal(t, map[string]int{"presence-room": 2, "public": 1}, nodes[2].GetGlobalChannelsWithConnectionCount("app-id"))
+	assert.Equal(t, 2, nodes[2].GetChannelConnectionCount("app-id", "presence-room"))
+	assert.Equal(t, 3, nodes[1].GetGlobalConnectionCount("app-id"))
+
+	members := nodes[2].GetChannelMembers("app-id", "presence-room")
+	assert.Len(t, members, 2, "members from all the nodes must be returned")
+	assert.Contains(t, members, "alice")
+	assert.Contains(t, members, "bob")
+
+	assert.Empty(t, nodes[0].GetGlobalChannels("other-app"), "channels must be separated per app")
+}
+
+func TestRedisCachedEventFromOtherNode(t *testing.T) {
+	nodes := newTestRedisNodes(t, "node-1", "node-2")
+
+	nodes[0].BroadcastToChannel("app-id", "cache-news", map[string]string{"event": "headline"})
+
+	// The second node caches the broadcast as well, it is dropped to act as a node started later.
+	second := nodes[1].(*horizontalChannelManager)
+	assert.Eventually(t, func() bool {
+		_, ok := second.localChannelManager.GetCachedEvent("app-id", "cache-news")
+		return ok
+	}, time.Second, 10*time.Millisecond, "broadcast must be cached by the other node")
+
+	second.localChannelManager.cache = newEventCache(0)
+
+	event, ok := nodes[1].GetCachedEvent("app-id", "cache-news")
+	assert.True(t, ok, "event must be fetched from the node which cached it")
+	assert.JSONEq(t, `{"event":"headline"}`, string(event))
+
+	_, ok = nodes[1].GetCachedEvent("app-id", "cache-other")
+	assert.False(t, ok)
+}
+
+func TestRedisBroadcastToUserReachesOtherNodes(t *testing.T) {
+	nodes := newTestRedisNodes(t, "node-1", "node-2")
+
+	local := newTestConnection("1.1")
+	remote := newTestConnection("2.1")
+	other := newTestConnection("2.2")
+
+	nodes[0].AddConnection("app-id", local)
+	nodes[0].SetUser("app-id", "alice", local.Id(), nil)
+	nodes[1].AddConnection("app-id", remote)
+	nodes[1].SetUser("app-id", "alice", remote.Id(), nil)
+	nodes[1].AddConnection("app-id", other)
+	nodes[1].SetUser("app-id", "bob", other.Id(), nil)
+
+	nodes[0].BroadcastToUser("app-id", "alice", map[string]string{"event": "hello"})
+
+	expected := []string{`{"event":"hello"}`}
+	assert.Equal(t, expected, local.messages())
+	assert.Eventually(t, func() bool { return len(remote.messages()) == 1 }, time.Second, 10*time.Millisecond, "user connection on the other node must receive the event")
+	assert.Equal(t, expected, remote.messages())
+	assert.Empty(t, other.messages(), "connections of other users must not receive the event")
+}
+
+func TestRedisWatchlistAcrossNodes(t *testing.T) {
+	nodes := newTestRedisNodes(t, "node-1", "node-2")
+
+	watcher := newTestConnection("1.1")
+	late := newTestConnection("1.2")
+	first := newTestConnection("2.1")
+	second := newTestConnection("1.3")
+
+	nodes[0].AddConnection("app-id", watcher)
+	nodes[0].AddConnection("app-id", late)
+	nodes[1].AddConnection("app-id", first)
+	nodes[0].AddConnection("app-id", second)
+
+	nodes[0].SetUser("app-id", "alice", watcher.Id(), []string{"bob"})
+	assert.Empty(t, watcher.messages(), "nothing is sent when no watched user is online")
+
+	online := `{"event":"pusher:watchlist_events","data":{"events":[{"name":"online","user_ids":["bob"]}]}}`
+
+	nodes[1].SetUser("app-id", "bob", first.Id(), nil)
+	assert.Eventually(t, func() bool { return len(watcher.messages()) == 1 }, time.Second, 10*time.Millisecond, "watchers on other nodes must be notified")
+	assert.Equal(t, online, watcher.messages()[0])
+
+	nodes[0].SetUser("app-id", "carol", late.Id(), []string{"bob"})
+	assert.Equal(t, []string{online}, late.messages(), "users online on other nodes must be sent on signin")
+
+	// bob is already online on the other node, so the second connection is not notified.
+	nodes[0].SetUser("app-id", "bob", second.Id(), nil)
+	nodes[0].RemoveUser("app-id", "bob", second.Id())
+	assert.Len(t, watcher.messages(), 1)
+
+	nodes[1].RemoveUser("app-id", "bob", first.Id())
+	assert.Eventually(t, func() bool { return len(watcher.messages()) == 2 }, time.Second, 10*time.Millisecond, "watchers on other nodes must be notified")
+	assert.Equal(t, `{"event":"pusher:watchlist_events","data":{"events":[{"name":"offline","user_ids":["bob"]}]}}`, watcher.messages()[1])
+}
+
+func TestRedisTerminateUserConnectionsOnAllNodes(t *testing.T) {
+	nodes := newTestRedisNodes(t, "node-1", "node-2")
+
+	local := newTestConnection("1.1")
+	remote := newTestConnection("2.1")
+
+	nodes[0].AddConnection("app-id", local)
+	nodes[0].SetUser("app-id", "alice", local.Id(), nil)
+	nodes[1].AddConnection("app-id", remote)
+	nodes[1].SetUser("app-id", "alice", remote.Id(), nil)
+
+	assert.Equal(t, 2, nodes[0].TerminateUserConnections("app-id", "alice"), "connections on all the nodes must be counted")
+	assert.Eventually(t, func() bool { return remote.closeCode() == gsockets.ERROR_CONNECTION_IS_UNAUTHORIZED }, time.Second, 10*time.Millisecond, "connection on the other node must be closed")
+	assert.Eventually(t, func() bool { return local.closeCode() == gsockets.ERROR_CONNECTION_IS_UNAUTHORIZED }, time.Second, 10*time.Millisecond)
+}
+
+func TestRedisSubscriptionCountAcrossNodes(t *testing.T) {
+	nodes := newTestRedisNodes(t, "node-1", "node-2")
+
+	local := newTestConnection("1.1")
+	remote := newTestConnection("2.1")
+
+	for i, conn := range []*testConnection{local, remote} {
+		conn.app.EnableSubscriptionCount = true
+		nodes[i].AddConnection("app-id", conn)
+	}
+
+	nodes[0].SubscribeToChannel("app-id", "my-channel", local, nil)
+	assert.Eventually(t, func() bool { return len(local.messages()) == 1 }, time.Second, 10*time.Millisecond)
+
+	nodes[1].SubscribeToChannel("app-id", "my-channel", remote, nil)
+
+	expected := `{"event":"pusher_internal:subscription_count","channel":"my-channel","data":"{\"subscription_count\":2}"}`
+	assert.Eventually(t, func() bool { return len(local.messages()) == 2 }, time.Second, 10*time.Millisecond, "count must reach the subscribers on other nodes")
+	assert.Equal(t, expected, local.messages()[1], "count must include the connections of all the nodes")
+	assert.Equal(t, []string{expected}, remote.messages())
+}
+
+// blockingConnection holds the messages sent to it until release is closed, like a slow socket.
+type blockingConnection struct {
+	*testConnection
+
+	release chan struct{}
+}
+
+func (c *blockingConnection) Send(data any) {
+	<-c.release
+	c.testConnection.Send(data)
+}
+
+func TestRedisRequestsDoNotWaitForBroadcasts(t *testing.T) {
+	nodes := newTestRedisNodes(t, "node-1", "node-2")
+
+	slow := &blockingConnection{testConnection: newTestConnection("2.1"), release: make(chan struct{})}
+	t.Cleanup(func() { close(slow.release) })
+
+	nodes[1].AddConnection("app-id", slow)
+	nodes[1].SubscribeToChannel("app-id", "busy", slow, nil)
+
+	// The broadcast is stuck delivering to the slow connection on the other node.
+	nodes[0].BroadcastToChannel("app-id", "busy", "data")
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	assert.Equal(t, 1, nodes[0].GetChannelConnectionCount("app-id", "busy"))
+	assert.Less(t, time.Since(start), 500*time.Millisecond, "the request must not wait for the broadcast")
+}
@@ -0,0 +1,116 @@
+package channelmanagers
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gsockets/gsockets"
+)
+
+// defaultSubscriptionCountInterval is how long the subscription count changes of a channel are
+// collected before the count is sent.
+const defaultSubscriptionCountInterval = time.Second
+
+// subscriptionCounter debounces the subscription count changes, so a channel with many clients
+// joining and leaving sends the count at most once per interval.
+type subscriptionCounter struct {
+	interval time.Duration
+
+	// pending holds the channels with a count waiting to be sent.
+	pending map[string]bool
+
+	// sent is the last count sent for each channel, by this node or by the other nodes, a count
+	// unchanged since is not sent again.
+	sent map[string]int
+
+	// emit is called with the channels whose count changed once the interval elapsed.
+	emit func(app *gsockets.App, channel string)
+
+	lock sync.Mutex
+}
+
+func newSubscriptionCounter(interval time.Duration, emit func(app *gsockets.App, channel string)) *subscriptionCounter {
+	if interval <= 0 {
+		interval = defaultSubscriptionCountInterval
+	}
+
+	return &subscriptionCounter{interval: interval, pending: make(map[string]bool), sent: make(map[string]int), emit: emit}
+}
+
+// changed schedules sending the count of the channel when the app enabled it. Presence channels
+// are skipped, their subscribers get the member events instead.
+func (s *subscriptionCounter) changed(app *gsockets.App, channel string) {
+	if !app.EnableSubscriptionCount || strings.HasPrefix(channel, "presence-") {
+		return
+	}
+
+	key := app.ID + "#" + channel
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.pending[key] {
+		return
+	}
+
+	s.pending[key] = true
+	time.AfterFunc(s.interval, func() {
+		s.lock.Lock()
+		delete(s.pending, key)
+		s.lock.Unlock()
+
+		s.emit(app, channel)
+	})
+}
+
+// swap records the count sent for the channel, returning false if it was already sent.
+func (s *subscriptionCounter) swap(appId, channel string, count int) bool {
+	key := appId + "#" + channel
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if last, ok := s.sent[key]; ok && last == count {
+		return false
+	}
+
+	if count == 0 {
+		delete(s.sent, key)
+	} else {
+		s.sent[key] = count
+	}
+
+	return true
+}
+
+// record stores the count sent for the channel by another node.
+func (s *subscriptionCounter) record(appId, channel string, count int) {
+	key := appId + "#" + channel
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if count == 0 {
+		delete(s.sent, key)
+	} else {
+		s.sent[key] = count
+	}
+}
+
+// forget drops the last count sent for the channel, when another node sends its count.
+func (s *subscriptionCounter) forget(appId, channel string) {
+	s.record(appId, channel, 0)
+}
+
+// subscriptionCountEvent returns the pusher_internal:subscription_count message for the channel.
+func subscriptionCountEvent(channel string, count int) gsockets.PusherSentMessage {
+	data, _ := json.Marshal(map[string]int{"subscription_count": count})
+
+	return gsockets.PusherSentMessage{
+		Event:   "pusher_internal:subscription_count",
+		Channel: channel,
+		Data:    string(data),
+	}
+}
@@ -0,0 +1,20 @@
+package channelmanagers
+
+import "github.com/gsockets/gsockets"
+
+const (
+	watchlistOnline  = "online"
+	watchlistOffline = "offline"
+)
+
+// watchlistEvent returns the pusher:watchlist_events message for the users going online or offline.
+func watchlistEvent(name string, userIds ...string) gsockets.PusherSentMessage {
+	if userIds == nil {
+		userIds = []string{}
+	}
+
+	return gsockets.PusherSentMessage{
+		Event: "pusher:watchlist_events",
+		Data:  gsockets.WatchlistEvents{Events: []gsockets.WatchlistEvent{{Name: name, UserIds: userIds}}},
+	}
+}
@@ -0,0 +1,32 @@
+package channels
+
+import "github.com/gsockets/gsockets"
+
+// cacheChannel sends the last event of the channel to the connections right after they subscribe,
+// or a pusher:cache_miss when there is none.
+type cacheChannel struct {
+	gsockets.Channel
+
+	channelManager gsockets.ChannelManager
+	webhooks       gsockets.WebhookSender
+}
+
+func newCacheChannel(ch gsockets.Channel, cm gsockets.ChannelManager, webhooks gsockets.WebhookSender) gsockets.Channel {
+	return &cacheChannel{Channel: ch, channelManager: cm, webhooks: webhooks}
+}
+
+func (c *cacheChannel) Subscribe(appId string, conn gsockets.Connection, payload gsockets.MessageData) error {
+	if err := c.Channel.Subscribe(appId, conn, payload); err != nil {
+		return err
+	}
+
+	if event, ok := c.channelManager.GetCachedEvent(appId, payload.Channel); ok {
+		conn.Send(event)
+		return nil
+	}
+
+	conn.Send(gsockets.PusherSentMessage{Event: "pusher:cache_miss", Channel: payload.Channel, Data: "{}"})
+	c.webhooks.Send(conn.App(), gsockets.WebhookEvent{Name: gsockets.WEBHOOK_CACHE_MISS, Channel: payload.Channel})
+
+	return nil
+}
@@ -6,12 +6,47 @@ import (
 	"github.com/gsockets/gsockets"
 )
 
-func New(name string, cm gsockets.ChannelManager) gsockets.Channel {
-	if strings.HasPrefix(name, "private-") {
+// encryptedPrefix marks the end-to-end encrypted channels, which are private channels as well.
+const encryptedPrefix = "private-encrypted-"
+
+// cachePrefixes mark the channels replaying their last event to the new subscribers.
+var cachePrefixes = []string{"cache-", "private-cache-", "private-encrypted-cache-", "presence-cache-"}
+
+func New(name string, cm gsockets.ChannelManager, webhooks gsockets.WebhookSender) gsockets.Channel {
+	ch := newChannel(name, cm, webhooks)
+	if IsCache(name) {
+		return newCacheChannel(ch, cm, webhooks)
+	}
+
+	return ch
+}
+
+func newChannel(name string, cm gsockets.ChannelManager, webhooks gsockets.WebhookSender) gsockets.Channel {
+	if _, ok := ServerToUserId(name); ok {
+		return newServerToUserChannel(cm)
+	} else if IsEncrypted(name) {
+		return newEncryptedChannel(cm)
+	} else if strings.HasPrefix(name, "private-") {
 		return newPrivateChannel(cm)
 	} else if strings.HasPrefix(name, "presence-") {
-		return newPresenceChannel(cm)
+		return newPresenceChannel(cm, webhooks)
 	}
 
 	return newPublicChannel(cm)
 }
+
+// IsEncrypted returns true if the channel is an end-to-end encrypted channel.
+func IsEncrypted(name string) bool {
+	return strings.HasPrefix(name, encryptedPrefix)
+}
+
+// IsCache returns true if the channel replays its last event to the new subscribers.
+func IsCache(name string) bool {
+	for _, prefix := range cachePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
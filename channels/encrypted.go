@@ -0,0 +1,24 @@
+package channels
+
+import "github.com/gsockets/gsockets"
+
+// encryptedChannel is a private channel whose event payloads are encrypted by the app backend with a
+// key derived for the channel from its master key. The key is sent to the client as the shared_secret
+// of the auth response, so the server never sees it and relays the payloads as they are.
+type encryptedChannel struct {
+	*privateChannel
+}
+
+func newEncryptedChannel(cm gsockets.ChannelManager) gsockets.Channel {
+	return &encryptedChannel{&privateChannel{&publicChannel{channelManager: cm}}}
+}
+
+// Subscribe only accepts the signature of the private channel auth flow, the auth response holding the
+// shared_secret must not carry channel data.
+func (c *encryptedChannel) Subscribe(appId string, conn gsockets.Connection, payload gsockets.MessageData) error {
+	if payload.ChannelData != "" {
+		return gsockets.PusherError{Code: gsockets.ERROR_CONNECTION_IS_UNAUTHORIZED, Message: "channel data is not allowed for encrypted channels"}
+	}
+
+	return c.privateChannel.Subscribe(appId, conn, payload)
+}
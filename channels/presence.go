@@ -8,10 +8,12 @@ import (
 
 type presenceChannel struct {
 	*privateChannel
+
+	webhooks gsockets.WebhookSender
 }
 
-func newPresenceChannel(cm gsockets.ChannelManager) gsockets.Channel {
-	return &presenceChannel{&privateChannel{&publicChannel{channelManager: cm}}}
+func newPresenceChannel(cm gsockets.ChannelManager, webhooks gsockets.WebhookSender) gsockets.Channel {
+	return &presenceChannel{&privateChannel{&publicChannel{channelManager: cm}}, webhooks}
 }
 
 func (pc *presenceChannel) Subscribe(appId string, conn gsockets.Connection, payload gsockets.MessageData) error {
@@ -31,12 +33,42 @@ func (pc *presenceChannel) Subscribe(appId string, conn gsockets.Connection, pay
 		return gsockets.PusherError{Code: gsockets.ERROR_CONNECTION_IS_UNAUTHORIZED, Message: "user_id must be present in presence channel"}
 	}
 
-	pc.channelManager.SubscribeToChannel(appId, payload.Channel, conn, payload)
+	userInfo, _ := json.Marshal(presenceMember.UserInfo)
+	if conn.App().PresenceUserInfoTooLarge(len(userInfo)) {
+		return gsockets.PusherError{Code: gsockets.ERROR_PRESENCE_USER_INFO_TOO_LARGE, Message: "user_info is over the maximum allowed size"}
+	}
+
 	members := pc.channelManager.GetChannelMembers(appId, payload.Channel)
+	_, joined := members[presenceMember.UserId]
+
+	// Other connections of the users already in the channel are accepted over the limit. The place of
+	// the user is held before counting the members, so the users joining at the same time, on this
+	// node or on another one, can't go over the limit together. Nothing is subscribed until the limit
+	// is checked, racing users may all be refused, they can try again.
+	if !joined {
+		release := pc.channelManager.ReservePresenceMember(appId, payload.Channel, presenceMember.UserId)
+		defer release()
+
+		others := 0
+		for _, userId := range pc.channelManager.GetPresenceMemberIds(appId, payload.Channel) {
+			if userId != presenceMember.UserId {
+				others++
+			}
+		}
+
+		if conn.App().PresenceMembersReached(others) {
+			return gsockets.PusherError{Code: gsockets.ERROR_PRESENCE_MEMBER_LIMIT, Message: "The presence channel is over the maximum number of members"}
+		}
+	}
+
+	// The presence is set for every connection of the user, so the user stays in the channel
+	// until all of them leave.
+	conn.SetPresence(payload.Channel, presenceMember)
+	pc.channelManager.SubscribeToChannel(appId, payload.Channel, conn, payload)
 
 	// If this user has not previously joined this presence channel, we'll trigger the
-	// member_added event and set the presence channel details for the connection.
-	if _, ok := members[presenceMember.UserId]; !ok {
+	// member_added event.
+	if !joined {
 		resp := gsockets.PusherSentMessage{
 			Event:   "pusher_internal:member_added",
 			Channel: payload.Channel,
@@ -44,9 +76,14 @@ func (pc *presenceChannel) Subscribe(appId string, conn gsockets.Connection, pay
 		}
 
 		pc.channelManager.BroadcastExcept(appId, payload.Channel, resp, conn.Id())
-		conn.SetPresence(payload.Channel, presenceMember)
 
 		members[presenceMember.UserId] = presenceMember
+
+		pc.webhooks.Send(conn.App(), gsockets.WebhookEvent{
+			Name:    gsockets.WEBHOOK_MEMBER_ADDED,
+			Channel: payload.Channel,
+			UserId:  presenceMember.UserId,
+		})
 	}
 
 	userIds := make([]string, 0)
@@ -90,6 +127,14 @@ func (pc *presenceChannel) Unsubscribe(appId, channel string, conn gsockets.Conn
 		}
 
 		pc.channelManager.BroadcastExcept(appId, channel, resp, conn.Id())
+
+		if member.UserId != "" {
+			pc.webhooks.Send(conn.App(), gsockets.WebhookEvent{
+				Name:    gsockets.WEBHOOK_MEMBER_REMOVED,
+				Channel: channel,
+				UserId:  member.UserId,
+			})
+		}
 	}
 
 	return nil
@@ -0,0 +1,167 @@
+package channels_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/gsockets/gsockets"
+	channelmanagers "github.com/gsockets/gsockets/channel_managers"
+	"github.com/gsockets/gsockets/channels"
+	"github.com/gsockets/gsockets/config"
+	"github.com/gsockets/gsockets/log"
+	"github.com/gsockets/gsockets/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+type testConnection struct {
+	gsockets.Connection
+
+	id       string
+	app      *gsockets.App
+	lock     sync.Mutex
+	presence map[string]gsockets.PresenceMember
+}
+
+func newTestConnection(id string, app *gsockets.App) *testConnection {
+	return &testConnection{id: id, app: app, presence: make(map[string]gsockets.PresenceMember)}
+}
+
+func (c *testConnection) Id() string         { return c.id }
+func (c *testConnection) App() *gsockets.App { return c.app }
+func (c *testConnection) Send(data any)      {}
+
+func (c *testConnection) GetPresence(channel string) (gsockets.PresenceMember, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	member, ok := c.presence[channel]
+	return member, ok
+}
+
+func (c *testConnection) SetPresence(channel string, member gsockets.PresenceMember) {
+	c.lock.Lock()
+	c.presence[channel] = member
+	c.lock.Unlock()
+}
+
+func (c *testConnection) RemovePresence(channel string) {
+	c.lock.Lock()
+	delete(c.presence, channel)
+	c.lock.Unlock()
+}
+
+// recordingWebhooks records the webhook events sent.
+type recordingWebhooks struct {
+	events []gsockets.WebhookEvent
+	lock   sync.Mutex
+}
+
+func (w *recordingWebhooks) Send(app *gsockets.App, event gsockets.WebhookEvent) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.events = append(w.events, event)
+}
+
+func (w *recordingWebhooks) received() []gsockets.WebhookEvent {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return append([]gsockets.WebhookEvent{}, w.events...)
+}
+
+// racingChannelManager adds the members of another node to the members of this node, and lets a user
+// join the channel on the other node right after the members are read for the first time, like a
+// subscription running concurrently on another node would.
+type racingChannelManager struct {
+	gsockets.ChannelManager
+
+	other gsockets.ChannelManager
+	join  func()
+	once  sync.Once
+}
+
+func (r *racingChannelManager) GetChannelMembers(appId, channel string) map[string]gsockets.PresenceMember {
+	members := r.ChannelManager.GetChannelMembers(appId, channel)
+	for userId, member := range r.other.GetChannelMembers(appId, channel) {
+		members[userId] = member
+	}
+
+	r.once.Do(r.join)
+
+	return members
+}
+
+func (r *racingChannelManager) GetPresenceMemberIds(appId, channel string) []string {
+	return append(r.ChannelManager.GetPresenceMemberIds(appId, channel), r.other.GetPresenceMemberIds(appId, channel)...)
+}
+
+func presencePayload(app *gsockets.App, conn gsockets.Connection, channel, channelData string) gsockets.MessageData {
+	hasher := hmac.New(sha256.New, []byte(app.Secret))
+	hasher.Write([]byte(conn.Id() + ":" + channel + ":" + channelData))
+
+	return gsockets.MessageData{Channel: channel, ChannelData: channelData, Auth: app.Key + ":" + hex.EncodeToString(hasher.Sum(nil))}
+}
+
+func TestPresenceMemberLimitWithConcurrentJoin(t *testing.T) {
+	app := &gsockets.App{ID: "1234", Key: "app-key", Secret: "secret", MaxPresenceMembers: 1}
+	webhooks := &recordingWebhooks{}
+
+	local, err := channelmanagers.New(config.ChannelManager{Driver: "local"}, "node-1", webhooks, metrics.NewNoop(), log.New())
+	assert.Nil(t, err)
+
+	other, err := channelmanagers.New(config.ChannelManager{Driver: "local"}, "node-2", nil, metrics.NewNoop(), log.New())
+	assert.Nil(t, err)
+
+	alice := newTestConnection("2.1", app)
+	bob := newTestConnection("1.1", app)
+
+	cm := &racingChannelManager{ChannelManager: local, other: other, join: func() {
+		other.AddConnection(app.ID, alice)
+		alice.SetPresence("presence-room", gsockets.PresenceMember{UserId: "alice"})
+		other.SubscribeToChannel(app.ID, "presence-room", alice, nil)
+	}}
+
+	cm.AddConnection(app.ID, bob)
+
+	channel := channels.New("presence-room", cm, webhooks)
+	err = channel.Subscribe(app.ID, bob, presencePayload(app, bob, "presence-room", `{"user_id":"bob"}`))
+
+	var pusherErr gsockets.PusherError
+	assert.True(t, errors.As(err, &pusherErr))
+	assert.Equal(t, gsockets.ERROR_PRESENCE_MEMBER_LIMIT, pusherErr.Code)
+
+	_, ok := bob.GetPresence("presence-room")
+	assert.False(t, ok, "the refused user must not be in the channel")
+	assert.Empty(t, local.GetPresenceMemberIds(app.ID, "presence-room"), "the place of the refused user must be released")
+	assert.Empty(t, webhooks.received(), "the refused join must not be observable")
+}
+
+func TestPresenceReservationsCountAgainstTheLimit(t *testing.T) {
+	app := &gsockets.App{ID: "1234", Key: "app-key", Secret: "secret", MaxPresenceMembers: 1}
+
+	cm, err := channelmanagers.New(config.ChannelManager{Driver: "local"}, "node-1", nil, metrics.NewNoop(), log.New())
+	assert.Nil(t, err)
+
+	release := cm.ReservePresenceMember(app.ID, "presence-room", "alice")
+
+	bob := newTestConnection("1.1", app)
+	cm.AddConnection(app.ID, bob)
+
+	channel := channels.New("presence-room", cm, &recordingWebhooks{})
+	err = channel.Subscribe(app.ID, bob, presencePayload(app, bob, "presence-room", `{"user_id":"bob"}`))
+
+	var pusherErr gsockets.PusherError
+	assert.True(t, errors.As(err, &pusherErr), "a user holding a place counts as a member")
+	assert.Equal(t, gsockets.ERROR_PRESENCE_MEMBER_LIMIT, pusherErr.Code)
+
+	release()
+	release()
+
+	assert.Nil(t, channel.Subscribe(app.ID, bob, presencePayload(app, bob, "presence-room", `{"user_id":"bob"}`)))
+	assert.Equal(t, []string{"bob"}, cm.GetPresenceMemberIds(app.ID, "presence-room"))
+}
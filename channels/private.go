@@ -1,8 +1,6 @@
 package channels
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
 	"encoding/hex"
 	"strings"
 
@@ -32,20 +30,16 @@ func (c *privateChannel) Subscribe(appId string, conn gsockets.Connection, paylo
 }
 
 func (c *privateChannel) verifySignature(conn gsockets.Connection, payload gsockets.MessageData) error {
-	// The pusher auth signature is in the following format: "<pusher-key>:<signature>", we are interested in the
-	// signature part. We'll verify this signature against the one we generated to verify it's not an unauthorized
-	// request.
-	sigSlice := strings.SplitAfter(payload.Auth, ":")
-	sig, err := hex.DecodeString(strings.Join(sigSlice[1:], ""))
+	// The pusher auth signature is in the following format: "<pusher-key>:<signature>", the key selects the
+	// secret the signature is verified with, so the backends can keep signing with a key being rotated.
+	key, sigString, _ := strings.Cut(payload.Auth, ":")
+	sig, err := hex.DecodeString(sigString)
 
 	if err != nil {
 		return gsockets.PusherError{Code: gsockets.ERROR_CONNECTION_IS_UNAUTHORIZED, Message: "invalid signature string provided"}
 	}
 
-	hasher := hmac.New(sha256.New, []byte(conn.App().Secret))
-	hasher.Write([]byte(c.getDataToSign(conn, payload)))
-
-	if valid := hmac.Equal(sig, hasher.Sum(nil)); !valid {
+	if valid := conn.App().VerifySignature(key, []byte(c.getDataToSign(conn, payload)), sig); !valid {
 		return gsockets.PusherError{Code: gsockets.ERROR_CONNECTION_IS_UNAUTHORIZED, Message: "signature does not match"}
 	}
 
@@ -0,0 +1,67 @@
+package channels
+
+import (
+	"strings"
+
+	"github.com/gsockets/gsockets"
+)
+
+// serverToUserPrefix marks the channel the events sent to a signed in user are delivered on. Clients
+// don't subscribe to it, they receive the events of the user they signed in as.
+const serverToUserPrefix = "#server-to-user-"
+
+type serverToUserChannel struct {
+	channelManager gsockets.ChannelManager
+}
+
+func newServerToUserChannel(cm gsockets.ChannelManager) gsockets.Channel {
+	return &serverToUserChannel{channelManager: cm}
+}
+
+// Subscribe is accepted for the connections signed in as the user of the channel, as the pusher
+// libraries subscribe to it after the signin. The connection is not added to the channel, the events
+// of the user are sent to all its signed in connections.
+func (c *serverToUserChannel) Subscribe(appId string, conn gsockets.Connection, payload gsockets.MessageData) error {
+	userId, _ := ServerToUserId(payload.Channel)
+	if user := conn.GetUser(); user == nil || user.Id != userId {
+		return gsockets.PusherError{Code: gsockets.ERROR_CONNECTION_IS_UNAUTHORIZED, Message: "The server-to-user channel can only be subscribed to by its signed in user"}
+	}
+
+	conn.Send(gsockets.PusherSentMessage{
+		Event:   "pusher_internal:subscription_succeeded",
+		Channel: payload.Channel,
+		Data:    "{}",
+	})
+
+	return nil
+}
+
+func (c *serverToUserChannel) Unsubscribe(appId, channel string, conn gsockets.Connection) error {
+	return nil
+}
+
+// Broadcast sends the data to all the connections signed in as the user of the channel.
+func (c *serverToUserChannel) Broadcast(appId, channel string, data any) {
+	userId, _ := ServerToUserId(channel)
+	c.channelManager.BroadcastToUser(appId, userId, data)
+}
+
+// BroadcastExcept sends the data to the user like Broadcast, the connection of the sender is a
+// connection of the user as well.
+func (c *serverToUserChannel) BroadcastExcept(appId, channel string, data any, connToExclude string) {
+	c.Broadcast(appId, channel, data)
+}
+
+// ServerToUser returns the name of the channel the events sent to the user are delivered on.
+func ServerToUser(userId string) string {
+	return serverToUserPrefix + userId
+}
+
+// ServerToUserId returns the user of a server-to-user channel, false for the other channels.
+func ServerToUserId(name string) (string, bool) {
+	if !strings.HasPrefix(name, serverToUserPrefix) {
+		return "", false
+	}
+
+	return strings.TrimPrefix(name, serverToUserPrefix), true
+}
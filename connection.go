@@ -36,4 +36,8 @@ type Connection interface {
 
 	// Close closes the current connection
 	Close()
+
+	// CloseWithCode closes the connection sending a close frame with the given code and reason to
+	// the client.
+	CloseWithCode(code int, message string)
 }
@@ -25,6 +25,26 @@ const (
 
 	// 4300-4399 any kind of other errors.
 	ERROR_CLIENT_EVENT_RATE_LIMIT = 4301
+
+	// ERROR_EVENT_PAYLOAD_TOO_LARGE is specific to gsockets, sent when a client event is
+	// over the MaxEventPayload of the app.
+	ERROR_EVENT_PAYLOAD_TOO_LARGE = 4302
+
+	// ERROR_CLIENT_EVENTS_DISABLED is specific to gsockets, sent when a client event is
+	// received for an app without client messages enabled.
+	ERROR_CLIENT_EVENTS_DISABLED = 4303
+
+	// ERROR_PRESENCE_MEMBER_LIMIT is specific to gsockets, sent when a subscription would take a
+	// presence channel over the MaxPresenceMembers of the app.
+	ERROR_PRESENCE_MEMBER_LIMIT = 4304
+
+	// ERROR_PRESENCE_USER_INFO_TOO_LARGE is specific to gsockets, sent when the user_info of a
+	// presence subscription is over the MaxPresenceUserInfoSize of the app.
+	ERROR_PRESENCE_USER_INFO_TOO_LARGE = 4305
+
+	// ERROR_CLIENT_EVENTS_ENCRYPTED is specific to gsockets, sent when a client event is received
+	// for an encrypted channel, as the server can not check the payload encrypted by the client.
+	ERROR_CLIENT_EVENTS_ENCRYPTED = 4306
 )
 
 type PusherError struct {
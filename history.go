@@ -0,0 +1,81 @@
+package gsockets
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const (
+	defaultHistoryMaxEvents = 100
+	defaultHistoryMaxAge    = time.Hour
+)
+
+// ChannelHistory configures the events recorded for each channel of an app.
+type ChannelHistory struct {
+	// Enabled turns on the recording of the events sent to the channels of the app.
+	Enabled bool `json:"enabled"`
+
+	// MaxEvents is the number of events kept for each channel, defaults to 100.
+	MaxEvents int `mapstructure:"max_events" json:"max_events"`
+
+	// MaxAge is how long the events are kept, defaults to one hour.
+	MaxAge time.Duration `mapstructure:"max_age" json:"max_age"`
+}
+
+// EventLimit returns the number of events kept for each channel.
+func (h ChannelHistory) EventLimit() int {
+	if h.MaxEvents <= 0 {
+		return defaultHistoryMaxEvents
+	}
+
+	return h.MaxEvents
+}
+
+// AgeLimit returns how long the events are kept.
+func (h ChannelHistory) AgeLimit() time.Duration {
+	if h.MaxAge <= 0 {
+		return defaultHistoryMaxAge
+	}
+
+	return h.MaxAge
+}
+
+// HistoryEvent is an event recorded in the history of a channel. Ids are assigned by the history store
+// and increase monotonically for each channel.
+type HistoryEvent struct {
+	Id      uint64          `json:"id"`
+	TimeMs  int64           `json:"time_ms"`
+	Event   string          `json:"event"`
+	Channel string          `json:"channel"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Message returns the event as sent to the clients.
+func (e HistoryEvent) Message() PusherSentMessage {
+	return PusherSentMessage{Id: e.Id, Event: e.Event, Channel: e.Channel, Data: e.Data}
+}
+
+// HistoryQuery selects the events returned from the history of a channel.
+type HistoryQuery struct {
+	// AfterId returns only the events recorded after the event with this id.
+	AfterId uint64
+
+	// Since and Until return only the events recorded in this time range, bounds included. Zero
+	// values leave the range open.
+	Since time.Time
+	Until time.Time
+
+	// Limit is the maximum number of events returned, all of them when zero.
+	Limit int
+}
+
+// HistoryStore records the events sent to the channels so they can be replayed.
+type HistoryStore interface {
+	// Append records the event in the history of its channel, dropping the events over the limits.
+	// Returns the event with the id and time assigned to it.
+	Append(ctx context.Context, appId string, event HistoryEvent, limits ChannelHistory) (HistoryEvent, error)
+
+	// Events returns the events of the channel matching the query, oldest first.
+	Events(ctx context.Context, appId, channel string, query HistoryQuery, limits ChannelHistory) ([]HistoryEvent, error)
+}
@@ -0,0 +1,51 @@
+package historystores
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/config"
+	"github.com/gsockets/gsockets/log"
+)
+
+var (
+	ErrInvalidHistoryStoreDriver = errors.New("invalid history store driver")
+)
+
+// New returns the history store for the configured driver, defaulting to the memory store.
+func New(config config.History, logger log.Logger) (gsockets.HistoryStore, error) {
+	switch config.Driver {
+	case "", "memory":
+		return newMemoryHistoryStore(), nil
+	case "redis":
+		return newRedisHistoryStore(config.Redis, logger)
+	default:
+		return nil, ErrInvalidHistoryStoreDriver
+	}
+}
+
+// nextId returns the id of an event recorded after the event with the last id. Ids are derived from
+// the clock, so they keep increasing after the history of a channel expired or the store restarted.
+func nextId(last uint64, now time.Time) uint64 {
+	id := uint64(now.UnixMicro())
+	if id <= last {
+		id = last + 1
+	}
+
+	return id
+}
+
+// matches reports whether the event is returned for the query, oldest being the time of the oldest
+// event not expired.
+func matches(event gsockets.HistoryEvent, query gsockets.HistoryQuery, oldest int64) bool {
+	if !query.Since.IsZero() && event.TimeMs < query.Since.UnixMilli() {
+		return false
+	}
+
+	if !query.Until.IsZero() && event.TimeMs > query.Until.UnixMilli() {
+		return false
+	}
+
+	return event.Id > query.AfterId && event.TimeMs >= oldest
+}
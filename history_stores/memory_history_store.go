@@ -0,0 +1,142 @@
+package historystores
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gsockets/gsockets"
+)
+
+// sweepInterval is how often the channels without recent events are removed.
+const sweepInterval = time.Minute
+
+// ring keeps the last events of a channel, overwriting the oldest one when full.
+type ring struct {
+	events []gsockets.HistoryEvent
+	start  int
+	size   int
+	lastId uint64
+	maxAge time.Duration
+}
+
+func (r *ring) push(event gsockets.HistoryEvent, max int) {
+	if len(r.events) != max {
+		r.resize(max)
+	}
+
+	if r.size < max {
+		r.events[(r.start+r.size)%max] = event
+		r.size++
+		return
+	}
+
+	r.events[r.start] = event
+	r.start = (r.start + 1) % max
+}
+
+// resize keeps the newest events when the limit of the app changed.
+func (r *ring) resize(max int) {
+	events := r.all()
+	if len(events) > max {
+		events = events[len(events)-max:]
+	}
+
+	r.events = make([]gsockets.HistoryEvent, max)
+	r.start = 0
+	r.size = copy(r.events, events)
+}
+
+// all returns the events oldest first.
+func (r *ring) all() []gsockets.HistoryEvent {
+	ret := make([]gsockets.HistoryEvent, r.size)
+	for i := range ret {
+		ret[i] = r.events[(r.start+i)%len(r.events)]
+	}
+
+	return ret
+}
+
+// newest returns the time of the last event pushed.
+func (r *ring) newest() int64 {
+	if r.size == 0 {
+		return 0
+	}
+
+	return r.events[(r.start+r.size-1)%len(r.events)].TimeMs
+}
+
+// memoryHistoryStore keeps the history of the channels in memory. Each node records its own ids, so
+// it should only be used with the local channel manager.
+type memoryHistoryStore struct {
+	channels map[string]*ring
+	sweptAt  time.Time
+	lock     sync.Mutex
+}
+
+func newMemoryHistoryStore() gsockets.HistoryStore {
+	return &memoryHistoryStore{channels: make(map[string]*ring), sweptAt: time.Now()}
+}
+
+func (m *memoryHistoryStore) Append(ctx context.Context, appId string, event gsockets.HistoryEvent, limits gsockets.ChannelHistory) (gsockets.HistoryEvent, error) {
+	now := time.Now()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	key := appId + "#" + event.Channel
+	r, ok := m.channels[key]
+	if !ok {
+		r = &ring{}
+		m.channels[key] = r
+	}
+
+	event.Id = nextId(r.lastId, now)
+	event.TimeMs = now.UnixMilli()
+
+	r.lastId = event.Id
+	r.maxAge = limits.AgeLimit()
+	r.push(event, limits.EventLimit())
+
+	if now.Sub(m.sweptAt) > sweepInterval {
+		m.sweep(now)
+	}
+
+	return event, nil
+}
+
+// sweep removes the channels whose events all expired.
+func (m *memoryHistoryStore) sweep(now time.Time) {
+	for key, r := range m.channels {
+		if r.newest() < now.Add(-r.maxAge).UnixMilli() {
+			delete(m.channels, key)
+		}
+	}
+
+	m.sweptAt = now
+}
+
+func (m *memoryHistoryStore) Events(ctx context.Context, appId, channel string, query gsockets.HistoryQuery, limits gsockets.ChannelHistory) ([]gsockets.HistoryEvent, error) {
+	oldest := time.Now().Add(-limits.AgeLimit()).UnixMilli()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	r, ok := m.channels[appId+"#"+channel]
+	if !ok {
+		return []gsockets.HistoryEvent{}, nil
+	}
+
+	ret := make([]gsockets.HistoryEvent, 0, r.size)
+	for _, event := range r.all() {
+		if query.Limit > 0 && len(ret) == query.Limit {
+			break
+		}
+
+		if matches(event, query, oldest) {
+			ret = append(ret, event)
+		}
+	}
+
+	return ret, nil
+}
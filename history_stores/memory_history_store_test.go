@@ -0,0 +1,121 @@
+package historystores
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/config"
+	"github.com/gsockets/gsockets/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func newEvent(channel, data string) gsockets.HistoryEvent {
+	return gsockets.HistoryEvent{Event: "my-event", Channel: channel, Data: json.RawMessage(`"` + data + `"`)}
+}
+
+// appendEvents records an event for each of the data in the channel and returns the recorded events.
+func appendEvents(t *testing.T, store gsockets.HistoryStore, channel string, limits gsockets.ChannelHistory, data ...string) []gsockets.HistoryEvent {
+	ret := make([]gsockets.HistoryEvent, len(data))
+	for i, d := range data {
+		event, err := store.Append(context.Background(), "app-id", newEvent(channel, d), limits)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ret[i] = event
+	}
+
+	return ret
+}
+
+func eventsData(events []gsockets.HistoryEvent) []string {
+	ret := make([]string, len(events))
+	for i, event := range events {
+		ret[i] = string(event.Data)
+	}
+
+	return ret
+}
+
+func TestNewReturnsErrForInvalidDriver(t *testing.T) {
+	store, err := New(config.History{Driver: "invalid"}, log.New())
+
+	assert.Nil(t, store)
+	assert.ErrorIs(t, err, ErrInvalidHistoryStoreDriver)
+}
+
+func TestMemoryHistoryStoreAssignsIncreasingIds(t *testing.T) {
+	store := newMemoryHistoryStore()
+	events := appendEvents(t, store, "my-channel", gsockets.ChannelHistory{}, "a", "b", "c")
+
+	for i := 1; i < len(events); i++ {
+		assert.Greater(t, events[i].Id, events[i-1].Id, "ids must increase for each event")
+	}
+
+	other := appendEvents(t, store, "other-channel", gsockets.ChannelHistory{}, "d")
+	assert.NotZero(t, other[0].Id)
+	assert.NotZero(t, other[0].TimeMs)
+}
+
+func TestMemoryHistoryStoreEventsAfterId(t *testing.T) {
+	store := newMemoryHistoryStore()
+	events := appendEvents(t, store, "my-channel", gsockets.ChannelHistory{}, "a", "b", "c")
+
+	ret, err := store.Events(context.Background(), "app-id", "my-channel", gsockets.HistoryQuery{AfterId: events[0].Id}, gsockets.ChannelHistory{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{`"b"`, `"c"`}, eventsData(ret))
+
+	ret, _ = store.Events(context.Background(), "app-id", "my-channel", gsockets.HistoryQuery{Limit: 2}, gsockets.ChannelHistory{})
+	assert.Equal(t, []string{`"a"`, `"b"`}, eventsData(ret), "oldest events must be returned first")
+
+	ret, _ = store.Events(context.Background(), "app-id", "unknown", gsockets.HistoryQuery{}, gsockets.ChannelHistory{})
+	assert.Empty(t, ret)
+}
+
+func TestMemoryHistoryStoreKeepsNewestEvents(t *testing.T) {
+	store := newMemoryHistoryStore()
+	limits := gsockets.ChannelHistory{MaxEvents: 2}
+
+	appendEvents(t, store, "my-channel", limits, "a", "b", "c")
+
+	ret, _ := store.Events(context.Background(), "app-id", "my-channel", gsockets.HistoryQuery{}, limits)
+	assert.Equal(t, []string{`"b"`, `"c"`}, eventsData(ret))
+
+	// Raising the limit keeps the events recorded so far.
+	limits.MaxEvents = 3
+	appendEvents(t, store, "my-channel", limits, "d", "e")
+
+	ret, _ = store.Events(context.Background(), "app-id", "my-channel", gsockets.HistoryQuery{}, limits)
+	assert.Equal(t, []string{`"c"`, `"d"`, `"e"`}, eventsData(ret))
+}
+
+func TestMemoryHistoryStoreDropsExpiredEvents(t *testing.T) {
+	store := newMemoryHistoryStore()
+	limits := gsockets.ChannelHistory{MaxAge: 50 * time.Millisecond}
+
+	appendEvents(t, store, "my-channel", limits, "a")
+	time.Sleep(100 * time.Millisecond)
+	appendEvents(t, store, "my-channel", limits, "b")
+
+	ret, _ := store.Events(context.Background(), "app-id", "my-channel", gsockets.HistoryQuery{}, limits)
+	assert.Equal(t, []string{`"b"`}, eventsData(ret))
+}
+
+func TestMemoryHistoryStoreEventsInTimeRange(t *testing.T) {
+	store := newMemoryHistoryStore()
+	events := appendEvents(t, store, "my-channel", gsockets.ChannelHistory{}, "a")
+
+	time.Sleep(20 * time.Millisecond)
+	events = append(events, appendEvents(t, store, "my-channel", gsockets.ChannelHistory{}, "b")...)
+
+	query := gsockets.HistoryQuery{Since: time.UnixMilli(events[1].TimeMs)}
+	ret, _ := store.Events(context.Background(), "app-id", "my-channel", query, gsockets.ChannelHistory{})
+	assert.Equal(t, []string{`"b"`}, eventsData(ret))
+
+	query = gsockets.HistoryQuery{Until: time.UnixMilli(events[0].TimeMs)}
+	ret, _ = store.Events(context.Background(), "app-id", "my-channel", query, gsockets.ChannelHistory{})
+	assert.Equal(t, []string{`"a"`}, eventsData(ret))
+}
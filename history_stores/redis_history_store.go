@@ -0,0 +1,134 @@
+package historystores
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/config"
+	"github.com/gsockets/gsockets/log"
+)
+
+// defaultRedisPrefix is used for the history keys when no prefix is configured.
+const defaultRedisPrefix = "gsockets"
+
+// appendScript assigns the next id of the channel to the event and adds it to the sorted set of
+// events, keeping only the newest ones. The id is formatted by the script since the lua numbers
+// would otherwise be printed in exponent notation.
+var appendScript = redis.NewScript(`
+local last = tonumber(redis.call("GET", KEYS[2]) or "0")
+local id = math.max(last + 1, tonumber(ARGV[1]))
+local max = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+
+redis.call("SET", KEYS[2], string.format("%d", id), "PX", ttl)
+redis.call("ZADD", KEYS[1], id, string.format("%d", id) .. ":" .. ARGV[2])
+redis.call("ZREMRANGEBYRANK", KEYS[1], 0, -(max + 1))
+redis.call("PEXPIRE", KEYS[1], ttl)
+
+return string.format("%d", id)
+`)
+
+// redisHistoryStore keeps the history of the channels in redis, so the ids of the events are the
+// same on all the nodes and any of them can replay the events.
+type redisHistoryStore struct {
+	client *redis.Client
+	prefix string
+
+	logger log.Logger
+}
+
+func newRedisHistoryStore(config config.RedisHistory, logger log.Logger) (gsockets.HistoryStore, error) {
+	url := config.Url
+	if url == "" {
+		url = "redis://localhost:6379/0"
+	}
+
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := config.Prefix
+	if prefix == "" {
+		prefix = defaultRedisPrefix
+	}
+
+	return &redisHistoryStore{
+		client: redis.NewClient(opts),
+		prefix: prefix,
+		logger: logger.With("module", "redis_history_store"),
+	}, nil
+}
+
+func (r *redisHistoryStore) key(appId, channel string) string {
+	return r.prefix + "#history#" + appId + "#" + channel
+}
+
+func (r *redisHistoryStore) Append(ctx context.Context, appId string, event gsockets.HistoryEvent, limits gsockets.ChannelHistory) (gsockets.HistoryEvent, error) {
+	now := time.Now()
+	event.TimeMs = now.UnixMilli()
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return event, err
+	}
+
+	key := r.key(appId, event.Channel)
+	args := []any{nextId(0, now), payload, limits.EventLimit(), limits.AgeLimit().Milliseconds()}
+
+	id, err := appendScript.Run(ctx, r.client, []string{key, key + "#id"}, args...).Text()
+	if err != nil {
+		return event, err
+	}
+
+	event.Id, err = strconv.ParseUint(id, 10, 64)
+
+	return event, err
+}
+
+func (r *redisHistoryStore) Events(ctx context.Context, appId, channel string, query gsockets.HistoryQuery, limits gsockets.ChannelHistory) ([]gsockets.HistoryEvent, error) {
+	oldest := time.Now().Add(-limits.AgeLimit()).UnixMilli()
+
+	members, err := r.client.ZRangeByScore(ctx, r.key(appId, channel), &redis.ZRangeBy{
+		Min: "(" + strconv.FormatUint(query.AfterId, 10),
+		Max: "+inf",
+	}).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]gsockets.HistoryEvent, 0, len(members))
+	for _, member := range members {
+		if query.Limit > 0 && len(ret) == query.Limit {
+			break
+		}
+
+		id, payload, _ := strings.Cut(member, ":")
+
+		var event gsockets.HistoryEvent
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			r.logger.Error("msg", "error decoding history event", "app_id", appId, "channel", channel, "error", err.Error())
+			continue
+		}
+
+		if event.Id, err = strconv.ParseUint(id, 10, 64); err != nil {
+			continue
+		}
+
+		if matches(event, query, oldest) {
+			ret = append(ret, event)
+		}
+	}
+
+	return ret, nil
+}
+
+func (r *redisHistoryStore) Close() error {
+	return r.client.Close()
+}
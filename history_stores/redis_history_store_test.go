@@ -0,0 +1,51 @@
+package historystores
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/config"
+	"github.com/gsockets/gsockets/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRedisHistoryStore(t *testing.T, url string) *redisHistoryStore {
+	store, err := New(config.History{Driver: "redis", Redis: config.RedisHistory{Url: url}}, log.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs := store.(*redisHistoryStore)
+	t.Cleanup(func() { _ = rs.Close() })
+
+	return rs
+}
+
+func TestRedisHistoryStoreSharesHistory(t *testing.T) {
+	mr := miniredis.RunT(t)
+	url := "redis://" + mr.Addr()
+
+	first := newTestRedisHistoryStore(t, url)
+	second := newTestRedisHistoryStore(t, url)
+
+	limits := gsockets.ChannelHistory{MaxEvents: 3}
+	events := appendEvents(t, first, "my-channel", limits, "a", "b")
+	events = append(events, appendEvents(t, second, "my-channel", limits, "c", "d")...)
+
+	for i := 1; i < len(events); i++ {
+		assert.Greater(t, events[i].Id, events[i-1].Id, "ids must increase across the nodes")
+	}
+
+	ret, err := first.Events(context.Background(), "app-id", "my-channel", gsockets.HistoryQuery{}, limits)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{`"b"`, `"c"`, `"d"`}, eventsData(ret), "only the newest events must be kept")
+	assert.Equal(t, events[1:], ret, "events must be returned as recorded")
+
+	ret, _ = second.Events(context.Background(), "app-id", "my-channel", gsockets.HistoryQuery{AfterId: events[2].Id, Limit: 5}, limits)
+	assert.Equal(t, []string{`"d"`}, eventsData(ret))
+
+	ret, _ = second.Events(context.Background(), "other-app", "my-channel", gsockets.HistoryQuery{}, limits)
+	assert.Empty(t, ret, "history must be separated per app")
+}
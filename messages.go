@@ -1,6 +1,7 @@
 package gsockets
 
 import (
+	"context"
 	"encoding/json"
 	"strings"
 )
@@ -10,6 +11,10 @@ type MessageData struct {
 	Auth        string `json:"auth,omitempty"`
 	ChannelData string `json:"channel_data,omitempty"`
 	UserData    string `json:"user_data,omitempty"`
+
+	// LastEventId is the id of the last event received by a client subscribing again, the events
+	// recorded after it are replayed.
+	LastEventId *uint64 `json:"last_event_id,omitempty"`
 }
 
 type PusherMessage struct {
@@ -26,6 +31,20 @@ func (p PusherMessage) IsClientEvent() bool {
 type PusherSigninUserData struct {
 	Id       string `json:"id"`
 	UserInfo string `json:"user_info"`
+
+	// Watchlist lists the users whose connections and disconnections are sent to this user.
+	Watchlist []string `json:"watchlist,omitempty"`
+}
+
+// WatchlistEvents is the data of the pusher:watchlist_events sent to the users watching other users.
+type WatchlistEvents struct {
+	Events []WatchlistEvent `json:"events"`
+}
+
+type WatchlistEvent struct {
+	// Name is either online or offline.
+	Name    string   `json:"name"`
+	UserIds []string `json:"user_ids"`
 }
 
 type PresenceMember struct {
@@ -40,6 +59,9 @@ type PusherAPIMessage struct {
 	Channels []string `json:"channels"`
 	Data     string   `json:"data"`
 	SocketId string   `json:"socket_id"`
+
+	// Info lists the channel attributes returned in the response, e.g. user_count,subscription_count
+	Info string `json:"info,omitempty"`
 }
 
 type PusherBatchApiMessage struct {
@@ -57,14 +79,27 @@ type ChannelListResponse struct {
 }
 
 type ChannelMember struct {
-	Id string `json:"id"`
+	Id       string         `json:"id"`
+	UserInfo map[string]any `json:"user_info,omitempty"`
 }
 
 type ChannelMemberResponse struct {
 	Users []ChannelMember `json:"users"`
+
+	// NextCursor is passed as the cursor to fetch the next page, empty on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type ChannelEventsResponse struct {
+	Events []HistoryEvent `json:"events"`
+
+	// NextCursor is passed as the cursor to fetch the next page, empty on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 type PusherSentMessage struct {
+	// Id is assigned to the events recorded in the channel history.
+	Id      uint64 `json:"id,omitempty"`
 	Event   string `json:"event"`
 	Channel string `json:"channel,omitempty"`
 	Data    any    `json:"data"`
@@ -91,3 +126,14 @@ func NewPusherError(errorEvent, message, channel string, code int) PusherSentMes
 
 	return PusherSentMessage{Event: errorEvent, Channel: channel, Data: data}
 }
+
+// TracedMessage carries the trace context of a message broadcast to the connections, so the write
+// to each connection can be traced. It is encoded as the message itself.
+type TracedMessage struct {
+	Ctx     context.Context
+	Message any
+}
+
+func (m TracedMessage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.Message)
+}
@@ -0,0 +1,37 @@
+package gsockets
+
+const (
+	WEBHOOK_DELIVERY_SUCCESS     = "success"
+	WEBHOOK_DELIVERY_FAILURE     = "failure"
+	WEBHOOK_DELIVERY_DEAD_LETTER = "dead_letter"
+)
+
+// Metrics records the measurements of a running node. Gauges only count what is held by this node,
+// the values for the whole cluster are obtained by summing the values of every node.
+type Metrics interface {
+	ConnectionAdded(appId string)
+	ConnectionRemoved(appId string)
+
+	// ConnectionClosed records the websocket close code a connection was closed with.
+	ConnectionClosed(appId string, code int)
+
+	ChannelAdded(appId string)
+	ChannelRemoved(appId string)
+
+	PresenceMemberAdded(appId string)
+	PresenceMemberRemoved(appId string)
+
+	// MessageReceived records a websocket message of the given size in bytes received from a client.
+	MessageReceived(appId string, size int)
+
+	// MessageSent records a websocket message of the given size in bytes sent to a client.
+	MessageSent(appId string, size int)
+
+	// ApiRequest records a http api call, route is the route pattern, e.g. /apps/{appId}/events.
+	ApiRequest(appId, route string, status int)
+
+	SubscriptionError(appId string, code int)
+
+	// WebhookDelivery records the result of a webhook request, one of the WEBHOOK_DELIVERY_* values.
+	WebhookDelivery(appId, result string)
+}
@@ -0,0 +1,24 @@
+package metrics
+
+import (
+	"errors"
+
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/config"
+)
+
+var (
+	ErrInvalidMetricsDriver = errors.New("invalid metrics driver")
+)
+
+// New returns the metrics for the configured driver, metrics are disabled when no driver is configured.
+func New(config config.Metrics) (gsockets.Metrics, error) {
+	switch config.Driver {
+	case "", "none":
+		return NewNoop(), nil
+	case "prometheus":
+		return newPrometheusMetrics(), nil
+	default:
+		return nil, ErrInvalidMetricsDriver
+	}
+}
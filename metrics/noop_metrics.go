@@ -0,0 +1,24 @@
+package metrics
+
+import "github.com/gsockets/gsockets"
+
+// noopMetrics discards all the measurements.
+type noopMetrics struct{}
+
+// NewNoop returns metrics discarding all the measurements, for when metrics are disabled.
+func NewNoop() gsockets.Metrics {
+	return noopMetrics{}
+}
+
+func (noopMetrics) ConnectionAdded(appId string)               {}
+func (noopMetrics) ConnectionRemoved(appId string)             {}
+func (noopMetrics) ConnectionClosed(appId string, code int)    {}
+func (noopMetrics) ChannelAdded(appId string)                  {}
+func (noopMetrics) ChannelRemoved(appId string)                {}
+func (noopMetrics) PresenceMemberAdded(appId string)           {}
+func (noopMetrics) PresenceMemberRemoved(appId string)         {}
+func (noopMetrics) MessageReceived(appId string, size int)     {}
+func (noopMetrics) MessageSent(appId string, size int)         {}
+func (noopMetrics) ApiRequest(appId, route string, status int) {}
+func (noopMetrics) SubscriptionError(appId string, code int)   {}
+func (noopMetrics) WebhookDelivery(appId, result string)       {}
@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gsockets/gsockets"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gsockets"
+
+// prometheusMetrics keeps the measurements in its own registry and serves them in the prometheus
+// exposition format.
+type prometheusMetrics struct {
+	connections     *prometheus.GaugeVec
+	channels        *prometheus.GaugeVec
+	presenceMembers *prometheus.GaugeVec
+
+	closeCodes         *prometheus.CounterVec
+	messagesReceived   *prometheus.CounterVec
+	messagesSent       *prometheus.CounterVec
+	bytesReceived      *prometheus.CounterVec
+	bytesSent          *prometheus.CounterVec
+	apiRequests        *prometheus.CounterVec
+	subscriptionErrors *prometheus.CounterVec
+	webhookDeliveries  *prometheus.CounterVec
+
+	handler http.Handler
+}
+
+func newPrometheusMetrics() gsockets.Metrics {
+	registry := prometheus.NewRegistry()
+	counter := func(name, help string, labels ...string) *prometheus.CounterVec {
+		c := prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: namespace, Name: name, Help: help}, labels)
+		registry.MustRegister(c)
+
+		return c
+	}
+
+	gauge := func(name, help string) *prometheus.GaugeVec {
+		g := prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: namespace, Name: name, Help: help}, []string{"app_id"})
+		registry.MustRegister(g)
+
+		return g
+	}
+
+	p := &prometheusMetrics{
+		connections:        gauge("connected_sockets", "Number of websocket connections currently open."),
+		channels:           gauge("channels", "Number of channels with at least one subscribed connection."),
+		presenceMembers:    gauge("presence_members", "Number of members in the presence channels."),
+		closeCodes:         counter("websocket_close_total", "Number of websocket connections closed, by close code.", "app_id", "code"),
+		messagesReceived:   counter("ws_messages_received_total", "Number of websocket messages received from the clients.", "app_id"),
+		messagesSent:       counter("ws_messages_sent_total", "Number of websocket messages sent to the clients.", "app_id"),
+		bytesReceived:      counter("ws_bytes_received_total", "Number of bytes received from the clients over websocket.", "app_id"),
+		bytesSent:          counter("ws_bytes_sent_total", "Number of bytes sent to the clients over websocket.", "app_id"),
+		apiRequests:        counter("http_api_requests_total", "Number of http api calls, by route and status code.", "app_id", "route", "status"),
+		subscriptionErrors: counter("subscription_errors_total", "Number of rejected channel subscriptions, by error code.", "app_id", "code"),
+		webhookDeliveries:  counter("webhook_deliveries_total", "Number of webhook requests, by result.", "app_id", "result"),
+	}
+
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	p.handler = promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+
+	return p
+}
+
+// ServeHTTP serves the metrics to the prometheus scrapers.
+func (p *prometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.handler.ServeHTTP(w, r)
+}
+
+func (p *prometheusMetrics) ConnectionAdded(appId string) {
+	p.connections.WithLabelValues(appId).Inc()
+}
+
+func (p *prometheusMetrics) ConnectionRemoved(appId string) {
+	p.connections.WithLabelValues(appId).Dec()
+}
+
+func (p *prometheusMetrics) ConnectionClosed(appId string, code int) {
+	p.closeCodes.WithLabelValues(appId, strconv.Itoa(code)).Inc()
+}
+
+func (p *prometheusMetrics) ChannelAdded(appId string) {
+	p.channels.WithLabelValues(appId).Inc()
+}
+
+func (p *prometheusMetrics) ChannelRemoved(appId string) {
+	p.channels.WithLabelValues(appId).Dec()
+}
+
+func (p *prometheusMetrics) PresenceMemberAdded(appId string) {
+	p.presenceMembers.WithLabelValues(appId).Inc()
+}
+
+func (p *prometheusMetrics) PresenceMemberRemoved(appId string) {
+	p.presenceMembers.WithLabelValues(appId).Dec()
+}
+
+func (p *prometheusMetrics) MessageReceived(appId string, size int) {
+	p.messagesReceived.WithLabelValues(appId).Inc()
+	p.bytesReceived.WithLabelValues(appId).Add(float64(size))
+}
+
+func (p *prometheusMetrics) MessageSent(appId string, size int) {
+	p.messagesSent.WithLabelValues(appId).Inc()
+	p.bytesSent.WithLabelValues(appId).Add(float64(size))
+}
+
+func (p *prometheusMetrics) ApiRequest(appId, route string, status int) {
+	p.apiRequests.WithLabelValues(appId, route, strconv.Itoa(status)).Inc()
+}
+
+func (p *prometheusMetrics) SubscriptionError(appId string, code int) {
+	p.subscriptionErrors.WithLabelValues(appId, strconv.Itoa(code)).Inc()
+}
+
+func (p *prometheusMetrics) WebhookDelivery(appId, result string) {
+	p.webhookDeliveries.WithLabelValues(appId, result).Inc()
+}
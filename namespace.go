@@ -21,6 +21,11 @@ type Namespace struct {
 	// terminate all the connections from a specific user.
 	users map[string]map[string]bool
 
+	// watchlists stores the users watched by each connection, and watchers is the reverse index with
+	// the connections watching each user.
+	watchlists map[string][]string
+	watchers   map[string]map[string]bool
+
 	channelLock sync.Mutex
 	connLock    sync.Mutex
 	userLock    sync.Mutex
@@ -31,6 +36,9 @@ func NewNamespace() *Namespace {
 		channels: make(map[string]map[string]bool),
 		conns:    make(map[string]Connection),
 		users:    make(map[string]map[string]bool),
+
+		watchlists: make(map[string][]string),
+		watchers:   make(map[string]map[string]bool),
 	}
 }
 
@@ -58,68 +66,92 @@ func (n *Namespace) GetConnections() map[string]Connection {
 	return n.conns
 }
 
+// ConnectionCount returns the number of connections maintained in this instance.
+func (n *Namespace) ConnectionCount() int {
+	n.connLock.Lock()
+	defer n.connLock.Unlock()
+
+	return len(n.conns)
+}
+
 // AddConnection adds a connections to this instance. Generally should be called when
-// the websocket connection is first established.
-func (n *Namespace) AddConnection(conn Connection) {
+// the websocket connection is first established. Returns false if the connection was
+// already added.
+func (n *Namespace) AddConnection(conn Connection) bool {
 	n.connLock.Lock()
 	defer n.connLock.Unlock()
 
 	if _, ok := n.conns[conn.Id()]; ok {
-		return
+		return false
 	}
 
 	n.conns[conn.Id()] = conn
+	return true
 }
 
 // RemoveConnection will remove a connection from this instance. Removing a connection will
 // cause it to be removed from all the channels. Should be called when the websocket connection
-// is closed.
-func (n *Namespace) RemoveConnection(connId string) {
-	n.RemoveConnectionFromChannel(connId, n.GetChannels()...)
+// is closed. Returns the channels left without any connection.
+func (n *Namespace) RemoveConnection(connId string) []string {
+	vacated := n.RemoveConnectionFromChannel(connId, n.GetChannels()...)
 
 	n.connLock.Lock()
 	defer n.connLock.Unlock()
 
 	delete(n.conns, connId)
+
+	return vacated
 }
 
 // AddConnectionToChannel will add a connection to a channel. If the channel is not present in this
 // instance, the channel will be created and then the connection will be added to it. This only adds
 // the connection id to the channel connection map, the actual connection should already be present
-// on the conns map.
-func (n *Namespace) AddConnectionToChannel(channelName string, conn Connection) {
+// on the conns map. Returns true if the channel was created by adding this connection.
+func (n *Namespace) AddConnectionToChannel(channelName string, conn Connection) bool {
 	n.channelLock.Lock()
 	defer n.channelLock.Unlock()
 
+	created := false
 	if _, ok := n.channels[channelName]; !ok {
 		n.channels[channelName] = make(map[string]bool)
+		created = true
 	}
 
 	channelConnections := n.channels[channelName]
 	if _, ok := channelConnections[conn.Id()]; ok {
-		return
+		return false
 	}
 
 	channelConnections[conn.Id()] = true
 	n.channels[channelName] = channelConnections
+
+	return created
 }
 
 // RemoveConnectionFromChannel will remove a connection from a channel. If after removal the channel
-// does not have any more connection, it will remove the channel from the instance too.
-func (n *Namespace) RemoveConnectionFromChannel(connId string, channels ...string) {
+// does not have any more connection, it will remove the channel from the instance too. Returns the
+// channels removed this way.
+func (n *Namespace) RemoveConnectionFromChannel(connId string, channels ...string) []string {
 	n.channelLock.Lock()
 	defer n.channelLock.Unlock()
 
+	vacated := make([]string, 0)
+
 	remove := func(channelName string) {
 		channelConnections, ok := n.channels[channelName]
 		if !ok {
 			return
 		}
 
+		if _, ok := channelConnections[connId]; !ok {
+			return
+		}
+
 		delete(channelConnections, connId)
 
 		if len(channelConnections) == 0 {
 			delete(n.channels, channelName)
+			vacated = append(vacated, channelName)
 		} else {
 			n.channels[channelName] = channelConnections
 		}
@@ -128,6 +160,8 @@ func (n *Namespace) RemoveConnectionFromChannel(connId string, channels ...strin
 	for _, channelName := range channels {
 		remove(channelName)
 	}
+
+	return vacated
 }
 
 // IsInChannel returns boolean indicating whether a given connection is subscribed to a channel.
@@ -201,14 +235,17 @@ func (n *Namespace) GetChannelMembers(channlName string) map[string]PresenceMemb
 	return members
 }
 
-// AddUser adds a connection to a user.
-func (n *Namespace) AddUser(userId, connId string) {
+// AddUser adds a connection to a user, along with the users watched by the connection. Returns true
+// if it's the first connection of the user in this instance.
+func (n *Namespace) AddUser(userId, connId string, watchlist []string) bool {
 	n.userLock.Lock()
 	defer n.userLock.Unlock()
 
+	n.setWatchlistUnlocked(connId, watchlist)
+
 	if userConns, ok := n.users[userId]; ok {
 		if _, exists := userConns[connId]; exists {
-			return
+			return false
 		} else {
 			userConns[connId] = true
 			n.users[userId] = userConns
@@ -217,15 +254,87 @@ func (n *Namespace) AddUser(userId, connId string) {
 		userConns := make(map[string]bool)
 		userConns[connId] = true
 		n.users[userId] = userConns
+
+		return true
 	}
+
+	return false
 }
 
-// RemoveUser removes a connection associated with an user.
-func (n *Namespace) RemoveUser(userId, connId string) {
+// RemoveUser removes a connection associated with an user. Returns true if it was the last connection
+// of the user in this instance.
+func (n *Namespace) RemoveUser(userId, connId string) bool {
 	n.userLock.Lock()
 	defer n.userLock.Unlock()
 
+	n.setWatchlistUnlocked(connId, nil)
+
+	if _, ok := n.users[userId][connId]; !ok {
+		return false
+	}
+
 	n.removeUserUnlocked(userId, connId)
+
+	_, online := n.users[userId]
+	return !online
+}
+
+// GetOnlineUsers returns the users of the list having a connection in this instance.
+func (n *Namespace) GetOnlineUsers(userIds []string) []string {
+	n.userLock.Lock()
+	defer n.userLock.Unlock()
+
+	online := make([]string, 0)
+	for _, userId := range userIds {
+		if _, ok := n.users[userId]; ok {
+			online = append(online, userId)
+		}
+	}
+
+	return online
+}
+
+// GetWatchers returns the connections watching the user.
+func (n *Namespace) GetWatchers(userId string) []Connection {
+	n.userLock.Lock()
+	defer n.userLock.Unlock()
+
+	conns := make([]Connection, 0, len(n.watchers[userId]))
+	for connId := range n.watchers[userId] {
+		conn, err := n.GetConnection(connId)
+		if err != nil {
+			continue
+		}
+
+		conns = append(conns, conn)
+	}
+
+	return conns
+}
+
+// setWatchlistUnlocked replaces the users watched by the connection. The calling method should
+// accuire the lock on users.
+func (n *Namespace) setWatchlistUnlocked(connId string, watchlist []string) {
+	for _, userId := range n.watchlists[connId] {
+		delete(n.watchers[userId], connId)
+		if len(n.watchers[userId]) == 0 {
+			delete(n.watchers, userId)
+		}
+	}
+
+	delete(n.watchlists, connId)
+	if len(watchlist) == 0 {
+		return
+	}
+
+	n.watchlists[connId] = watchlist
+	for _, userId := range watchlist {
+		if _, ok := n.watchers[userId]; !ok {
+			n.watchers[userId] = make(map[string]bool)
+		}
+
+		n.watchers[userId][connId] = true
+	}
 }
 
 // GetUserSockets returns all the connections
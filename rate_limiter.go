@@ -0,0 +1,12 @@
+package gsockets
+
+import "time"
+
+// RateLimiter implements token buckets identified by a key. The limits are passed on every call
+// as they can differ between apps.
+type RateLimiter interface {
+	// Allow takes n tokens from the bucket identified by key, which holds up to burst tokens and
+	// refills at limit tokens per second. When the tokens are not available, it returns false and
+	// the time after which they will be.
+	Allow(key string, n int, limit float64, burst int) (bool, time.Duration)
+}
@@ -0,0 +1,61 @@
+package ratelimiters
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gsockets/gsockets"
+	"golang.org/x/time/rate"
+)
+
+// localRateLimiter keeps the token buckets in memory, so the limits only apply to this instance.
+type localRateLimiter struct {
+	limiters map[string]*rate.Limiter
+	lock     sync.Mutex
+}
+
+func newLocalRateLimiter() gsockets.RateLimiter {
+	return &localRateLimiter{limiters: make(map[string]*rate.Limiter)}
+}
+
+func (l *localRateLimiter) Allow(key string, n int, limit float64, burst int) (bool, time.Duration) {
+	now := time.Now()
+	limiter := l.getLimiter(key, limit, burst)
+
+	reservation := limiter.ReserveN(now, n)
+	if !reservation.OK() {
+		// More tokens requested than the bucket can ever hold.
+		return false, time.Second
+	}
+
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return false, delay
+	}
+
+	return true, 0
+}
+
+// getLimiter returns the limiter for the key, updating its limits if they changed since it was created.
+func (l *localRateLimiter) getLimiter(key string, limit float64, burst int) *rate.Limiter {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	limiter, ok := l.limiters[key]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(limit), burst)
+		l.limiters[key] = limiter
+
+		return limiter
+	}
+
+	if limiter.Limit() != rate.Limit(limit) {
+		limiter.SetLimit(rate.Limit(limit))
+	}
+
+	if limiter.Burst() != burst {
+		limiter.SetBurst(burst)
+	}
+
+	return limiter
+}
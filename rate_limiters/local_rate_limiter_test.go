@@ -0,0 +1,57 @@
+package ratelimiters
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gsockets/gsockets/config"
+	"github.com/gsockets/gsockets/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRateLimiter(t *testing.T) {
+	limiter, err := New(config.RateLimiter{}, log.New())
+	assert.Nil(t, err)
+	assert.IsType(t, &localRateLimiter{}, limiter)
+
+	_, err = New(config.RateLimiter{Driver: "unknown"}, log.New())
+	assert.Equal(t, ErrInvalidRateLimiterDriver, err)
+}
+
+func TestLocalRateLimiterAllow(t *testing.T) {
+	limiter := newLocalRateLimiter()
+
+	for i := 0; i < 3; i++ {
+		allowed, _ := limiter.Allow("key", 1, 1, 3)
+		assert.True(t, allowed, "requests within the burst must be allowed")
+	}
+
+	allowed, retryAfter := limiter.Allow("key", 1, 1, 3)
+	assert.False(t, allowed, "requests over the burst must be rejected")
+	assert.Greater(t, retryAfter.Nanoseconds(), int64(0), "rejected requests must have a retry delay")
+
+	allowed, _ = limiter.Allow("other", 1, 1, 3)
+	assert.True(t, allowed, "keys must have their own buckets")
+
+	allowed, _ = limiter.Allow("batch", 5, 1, 3)
+	assert.False(t, allowed, "more tokens than the burst must be rejected")
+}
+
+func TestLocalRateLimiterUpdatesLimits(t *testing.T) {
+	limiter := newLocalRateLimiter()
+
+	allowed, _ := limiter.Allow("key", 1, 1, 1)
+	assert.True(t, allowed)
+
+	allowed, _ = limiter.Allow("key", 1, 1, 1)
+	assert.False(t, allowed)
+
+	// At the new rate the bucket refills within a few milliseconds.
+	_, retryAfter := limiter.Allow("key", 1, 1000, 10)
+	assert.Less(t, retryAfter, 10*time.Millisecond, "new limits must apply to existing buckets")
+
+	time.Sleep(10 * time.Millisecond)
+
+	allowed, _ = limiter.Allow("key", 1, 1000, 10)
+	assert.True(t, allowed, "bucket must refill at the new rate")
+}
@@ -0,0 +1,25 @@
+package ratelimiters
+
+import (
+	"errors"
+
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/config"
+	"github.com/gsockets/gsockets/log"
+)
+
+var (
+	ErrInvalidRateLimiterDriver = errors.New("invalid rate limiter driver")
+)
+
+// New returns the rate limiter for the configured driver, defaulting to the local rate limiter.
+func New(config config.RateLimiter, logger log.Logger) (gsockets.RateLimiter, error) {
+	switch config.Driver {
+	case "", "local":
+		return newLocalRateLimiter(), nil
+	case "redis":
+		return newRedisRateLimiter(config.Redis, logger)
+	default:
+		return nil, ErrInvalidRateLimiterDriver
+	}
+}
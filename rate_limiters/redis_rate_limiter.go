@@ -0,0 +1,108 @@
+package ratelimiters
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/config"
+	"github.com/gsockets/gsockets/log"
+)
+
+const (
+	// defaultRedisPrefix is used for the rate limit keys when no prefix is configured.
+	defaultRedisPrefix = "gsockets"
+
+	// redisTimeout is the maximum time spent waiting for redis before letting the request through.
+	redisTimeout = 500 * time.Millisecond
+)
+
+// tokenBucketScript refills the bucket for the time elapsed since the last call and takes the
+// requested tokens from it, returning whether they were available and the milliseconds to wait
+// when they were not.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local now = tonumber(ARGV[4])
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+
+local allowed = 0
+local wait = 0
+
+if n > burst then
+	wait = 1000
+elseif tokens >= n then
+	tokens = tokens - n
+	allowed = 1
+else
+	wait = math.ceil((n - tokens) * 1000 / rate)
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+
+return {allowed, wait}
+`)
+
+// redisRateLimiter keeps the token buckets in redis, so the limits apply to all the nodes together.
+// The buckets are refilled using the clock of the calling node, which must be kept in sync.
+type redisRateLimiter struct {
+	client *redis.Client
+	prefix string
+
+	logger log.Logger
+}
+
+func newRedisRateLimiter(config config.RedisRateLimiter, logger log.Logger) (gsockets.RateLimiter, error) {
+	url := config.Url
+	if url == "" {
+		url = "redis://localhost:6379/0"
+	}
+
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := config.Prefix
+	if prefix == "" {
+		prefix = defaultRedisPrefix
+	}
+
+	return &redisRateLimiter{
+		client: redis.NewClient(opts),
+		prefix: prefix,
+		logger: logger.With("module", "redis_rate_limiter"),
+	}, nil
+}
+
+// Allow lets the request through when redis can not be reached, an unavailable rate limiter should
+// not take the whole api down.
+func (r *redisRateLimiter) Allow(key string, n int, limit float64, burst int) (bool, time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	keys := []string{r.prefix + "#rate_limits#" + key}
+	res, err := tokenBucketScript.Run(ctx, r.client, keys, limit, burst, n, time.Now().UnixMilli()).Int64Slice()
+	if err != nil {
+		r.logger.Error("msg", "error checking rate limit", "key", key, "error", err.Error())
+		return true, 0
+	}
+
+	if res[0] == 1 {
+		return true, 0
+	}
+
+	return false, time.Duration(res[1]) * time.Millisecond
+}
+
+func (r *redisRateLimiter) Close() error {
+	return r.client.Close()
+}
@@ -0,0 +1,57 @@
+package ratelimiters
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gsockets/gsockets/config"
+	"github.com/gsockets/gsockets/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRedisRateLimiter(t *testing.T, url string) *redisRateLimiter {
+	limiter, err := New(config.RateLimiter{Driver: "redis", Redis: config.RedisRateLimiter{Url: url}}, log.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rl := limiter.(*redisRateLimiter)
+	t.Cleanup(func() { _ = rl.Close() })
+
+	return rl
+}
+
+func TestRedisRateLimiterSharesBuckets(t *testing.T) {
+	mr := miniredis.RunT(t)
+	url := "redis://" + mr.Addr()
+
+	first := newTestRedisRateLimiter(t, url)
+	second := newTestRedisRateLimiter(t, url)
+
+	allowed, _ := first.Allow("key", 2, 1, 3)
+	assert.True(t, allowed)
+
+	allowed, _ = second.Allow("key", 1, 1, 3)
+	assert.True(t, allowed, "tokens left by the first node must be available to the second")
+
+	allowed, retryAfter := second.Allow("key", 1, 1, 3)
+	assert.False(t, allowed, "both nodes must take from the same bucket")
+	assert.Greater(t, retryAfter, time.Duration(0))
+	assert.LessOrEqual(t, retryAfter, time.Second)
+
+	allowed, _ = first.Allow("other", 1, 1, 3)
+	assert.True(t, allowed, "keys must have their own buckets")
+
+	allowed, _ = first.Allow("batch", 5, 1, 3)
+	assert.False(t, allowed, "more tokens than the burst must be rejected")
+}
+
+func TestRedisRateLimiterAllowsWhenUnavailable(t *testing.T) {
+	mr := miniredis.RunT(t)
+	limiter := newTestRedisRateLimiter(t, "redis://"+mr.Addr())
+	mr.Close()
+
+	allowed, _ := limiter.Allow("key", 1, 1, 1)
+	assert.True(t, allowed, "requests must go through when redis is down")
+}
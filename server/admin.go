@@ -0,0 +1,263 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gsockets/gsockets"
+	appmanagers "github.com/gsockets/gsockets/app_managers"
+	"github.com/oklog/ulid/v2"
+)
+
+// defaultRotationGracePeriod is how long the rotated credentials stay valid when no grace period is
+// requested.
+const defaultRotationGracePeriod = 24 * time.Hour
+
+// appsResponse lists the apps returned by the admin api.
+type appsResponse struct {
+	Apps []*gsockets.App `json:"apps"`
+}
+
+// rotateRequest is the optional body of the credentials rotation, the grace period is a duration
+// like "1h".
+type rotateRequest struct {
+	GracePeriod string `json:"grace_period"`
+}
+
+type AdminMiddleware struct {
+	token string
+}
+
+func NewAdminMiddleware(token string) *AdminMiddleware {
+	return &AdminMiddleware{token: token}
+}
+
+// Handler verifies the bearer token of the admin api requests.
+func (admin *AdminMiddleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(admin.token)) != 1 {
+			RenderJSON(w, http.StatusUnauthorized, "invalid admin token", nil)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// adminRoutes registers the admin api routes on the router.
+func (srv *Server) adminRoutes(r chi.Router) {
+	r.Use(NewAdminMiddleware(srv.config.Admin.Token).Handler)
+
+	r.Get("/apps", srv.adminListApps)
+	r.Post("/apps", srv.adminCreateApp)
+	r.Get("/apps/{appId}", srv.adminGetApp)
+	r.Put("/apps/{appId}", srv.adminUpdateApp)
+	r.Delete("/apps/{appId}", srv.adminDeleteApp)
+	r.Post("/apps/{appId}/rotate", srv.adminRotateApp)
+}
+
+// adminEnabled returns true if an admin token is configured.
+func (srv *Server) adminEnabled() bool {
+	return srv.config.Admin.Token != ""
+}
+
+// adminOnSeparatePort returns true if the admin api is served on a different port than the api.
+func (srv *Server) adminOnSeparatePort() bool {
+	return srv.config.Admin.Port != 0 && srv.config.Admin.Port != srv.config.Server.Port
+}
+
+// writableApps returns the app manager when it can change the apps, otherwise it renders the error.
+// The wrapped app managers return ErrReadOnlyAppManager themselves when their driver can't.
+func (srv *Server) writableApps(w http.ResponseWriter) (gsockets.WritableAppManager, bool) {
+	apps, ok := srv.apps.(gsockets.WritableAppManager)
+	if !ok {
+		srv.renderAdminError(w, appmanagers.ErrReadOnlyAppManager)
+	}
+
+	return apps, ok
+}
+
+func (srv *Server) adminListApps(w http.ResponseWriter, r *http.Request) {
+	writable, ok := srv.writableApps(w)
+	if !ok {
+		return
+	}
+
+	apps, err := writable.ListApps(r.Context())
+	if err != nil {
+		srv.renderAdminError(w, err)
+		return
+	}
+
+	RenderJSON(w, http.StatusOK, "", appsResponse{Apps: apps})
+}
+
+func (srv *Server) adminGetApp(w http.ResponseWriter, r *http.Request) {
+	app, err := srv.apps.FindById(r.Context(), chi.URLParam(r, "appId"))
+	if err != nil {
+		srv.renderAdminError(w, err)
+		return
+	}
+
+	RenderJSON(w, http.StatusOK, "", app)
+}
+
+// adminCreateApp creates the app in the body, the id, key and secret are generated when they are
+// not given.
+func (srv *Server) adminCreateApp(w http.ResponseWriter, r *http.Request) {
+	app, err := decodeAdminApp(r)
+	if err != nil {
+		RenderJSON(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	if app.ID == "" {
+		app.ID = ulid.Make().String()
+	}
+
+	if app.Key == "" {
+		app.Key = randomHex(16)
+	}
+
+	if app.Secret == "" {
+		app.Secret = randomHex(32)
+	}
+
+	app.PreviousKey, app.PreviousSecret, app.PreviousExpiresAt, app.PreviousSecrets = "", "", time.Time{}, nil
+
+	apps, ok := srv.writableApps(w)
+	if !ok {
+		return
+	}
+
+	if err := apps.CreateApp(r.Context(), &app); err != nil {
+		srv.renderAdminError(w, err)
+		return
+	}
+
+	RenderJSON(w, http.StatusCreated, "", app)
+}
+
+// adminUpdateApp replaces the settings of the app with the body. The key and secret are kept, they
+// are only changed by rotating them, while the additional secrets are replaced like the settings.
+// The other nodes caching the apps keep the previous settings until their cache expires.
+func (srv *Server) adminUpdateApp(w http.ResponseWriter, r *http.Request) {
+	body, err := decodeAdminApp(r)
+	if err != nil {
+		RenderJSON(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	apps, ok := srv.writableApps(w)
+	if !ok {
+		return
+	}
+
+	app, err := apps.ModifyApp(r.Context(), chi.URLParam(r, "appId"), func(app *gsockets.App) error {
+		existing := *app
+		*app = body
+
+		app.ID, app.Key, app.Secret = existing.ID, existing.Key, existing.Secret
+		app.PreviousKey, app.PreviousSecret, app.PreviousExpiresAt = existing.PreviousKey, existing.PreviousSecret, existing.PreviousExpiresAt
+		app.PreviousSecrets = existing.PreviousSecrets
+
+		return nil
+	})
+	if err != nil {
+		srv.renderAdminError(w, err)
+		return
+	}
+
+	RenderJSON(w, http.StatusOK, "", app)
+}
+
+func (srv *Server) adminDeleteApp(w http.ResponseWriter, r *http.Request) {
+	apps, ok := srv.writableApps(w)
+	if !ok {
+		return
+	}
+
+	if err := apps.DeleteApp(r.Context(), chi.URLParam(r, "appId")); err != nil {
+		srv.renderAdminError(w, err)
+		return
+	}
+
+	RenderJSON(w, http.StatusOK, "", okResponse{Ok: true})
+}
+
+// adminRotateApp generates a new key and secret for the app, the current ones stay valid during the
+// grace period so the clients and backends can move to the new ones. The other nodes caching the
+// apps only accept the new credentials once their cache expires.
+func (srv *Server) adminRotateApp(w http.ResponseWriter, r *http.Request) {
+	var body rotateRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		RenderJSON(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	grace := defaultRotationGracePeriod
+	if body.GracePeriod != "" {
+		var err error
+		if grace, err = time.ParseDuration(body.GracePeriod); err != nil || grace < 0 {
+			RenderJSON(w, http.StatusBadRequest, "grace_period must be a duration like 1h, not negative", nil)
+			return
+		}
+	}
+
+	apps, ok := srv.writableApps(w)
+	if !ok {
+		return
+	}
+
+	app, err := apps.ModifyApp(r.Context(), chi.URLParam(r, "appId"), func(app *gsockets.App) error {
+		app.Rotate(randomHex(16), randomHex(32), time.Now().Add(grace))
+		return nil
+	})
+	if err != nil {
+		srv.renderAdminError(w, err)
+		return
+	}
+
+	RenderJSON(w, http.StatusOK, "", app)
+}
+
+func (srv *Server) renderAdminError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, appmanagers.ErrInvalidAppId):
+		RenderJSON(w, http.StatusNotFound, err.Error(), nil)
+	case errors.Is(err, appmanagers.ErrAppExists):
+		RenderJSON(w, http.StatusConflict, err.Error(), nil)
+	case errors.Is(err, appmanagers.ErrReadOnlyAppManager):
+		RenderJSON(w, http.StatusNotImplemented, err.Error(), nil)
+	default:
+		srv.logger.Error("msg", "error changing the apps", "error", err.Error())
+		RenderJSON(w, http.StatusInternalServerError, "internal server error", nil)
+	}
+}
+
+// decodeAdminApp reads the app from the request body, using the same keys as the config file.
+func decodeAdminApp(r *http.Request) (gsockets.App, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return gsockets.App{}, err
+	}
+
+	return appmanagers.DecodeApp(body)
+}
+
+// randomHex returns n random bytes encoded as hex.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/gsockets/gsockets"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAdminToken = "admin-token"
+
+func newTestAdminServer(t *testing.T, apps ...gsockets.App) *httptest.Server {
+	cfg := getTestConfig(apps...)
+	cfg.Admin.Token = testAdminToken
+
+	_, ts := newTestServer(t, cfg)
+
+	return ts
+}
+
+// adminRequest builds a request to the admin api authenticated with the test token.
+func adminRequest(t *testing.T, method, url string, body string) *http.Request {
+	req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+
+	return req
+}
+
+func TestAdminApiRequiresToken(t *testing.T) {
+	ts := newTestAdminServer(t)
+	url := ts.URL
+
+	req := adminRequest(t, http.MethodGet, url+"/admin/apps", "")
+	req.Header.Set("Authorization", "Bearer wrong-token")
+	assert.Equal(t, http.StatusUnauthorized, doRequest(t, req, nil).StatusCode)
+
+	req.Header.Del("Authorization")
+	assert.Equal(t, http.StatusUnauthorized, doRequest(t, req, nil).StatusCode)
+
+	// The admin api is disabled without a token.
+	_, disabled := newTestServer(t, getTestConfig())
+	res := doRequest(t, adminRequest(t, http.MethodGet, disabled.URL+"/admin/apps", ""), nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestAdminApiManagesApps(t *testing.T) {
+	ts := newTestAdminServer(t)
+	url := ts.URL
+
+	var created gsockets.App
+	res := doRequest(t, adminRequest(t, http.MethodPost, url+"/admin/apps", `{"id":"5678","max_connections":10,"history":{"enabled":true,"max_age":"1h"}}`), &created)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.Equal(t, "5678", created.ID)
+	assert.NotEmpty(t, created.Key)
+	assert.NotEmpty(t, created.Secret)
+	assert.Equal(t, time.Hour, created.History.MaxAge)
+
+	res = doRequest(t, adminRequest(t, http.MethodPost, url+"/admin/apps", `{"id":"5678"}`), nil)
+	assert.Equal(t, http.StatusConflict, res.StatusCode)
+
+	// The new app can be used right away.
+	dialTestClient(t, ts, created.Key)
+
+	var updated gsockets.App
+	res = doRequest(t, adminRequest(t, http.MethodPut, url+"/admin/apps/5678", `{"key":"ignored","max_connections":20}`), &updated)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, created.Key, updated.Key, "the credentials are only changed by a rotation")
+	assert.Equal(t, 20, updated.MaxConnections)
+	assert.False(t, updated.History.Enabled)
+
+	var list appsResponse
+	doRequest(t, adminRequest(t, http.MethodGet, url+"/admin/apps", ""), &list)
+	assert.Len(t, list.Apps, 2)
+
+	var found gsockets.App
+	doRequest(t, adminRequest(t, http.MethodGet, url+"/admin/apps/5678", ""), &found)
+	assert.Equal(t, 20, found.MaxConnections)
+
+	res = doRequest(t, adminRequest(t, http.MethodDelete, url+"/admin/apps/5678", ""), nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	res = doRequest(t, adminRequest(t, http.MethodGet, url+"/admin/apps/5678", ""), nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	res = doRequest(t, adminRequest(t, http.MethodPut, url+"/admin/apps/5678", `{}`), nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestAdminApiRotatesCredentials(t *testing.T) {
+	old := getTestApp()
+	ts := newTestAdminServer(t, old)
+	url := ts.URL
+
+	var rotated gsockets.App
+	res := doRequest(t, adminRequest(t, http.MethodPost, url+"/admin/apps/1234/rotate", `{"grace_period":"1h"}`), &rotated)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.NotEqual(t, old.Key, rotated.Key)
+	assert.NotEqual(t, old.Secret, rotated.Secret)
+	assert.Equal(t, old.Key, rotated.PreviousKey)
+
+	// Both the old and the new credentials are valid during the grace period.
+	for _, app := range []gsockets.App{old, rotated} {
+		res := doRequest(t, signedRequest(t, app, http.MethodGet, url, "/apps/1234/channels", nil, nil), nil)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+
+		client := dialTestClient(t, ts, app.Key)
+		client.subscribeAuthorized(app, "private-room", "")
+		client.expect("pusher_internal:subscription_succeeded")
+
+		client.signin(app, `{"id":"alice"}`)
+	}
+
+	// Without a grace period the old credentials are rejected right away.
+	var again gsockets.App
+	doRequest(t, adminRequest(t, http.MethodPost, url+"/admin/apps/1234/rotate", `{"grace_period":"0s"}`), &again)
+
+	res = doRequest(t, signedRequest(t, rotated, http.MethodGet, url, "/apps/1234/channels", nil, nil), nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	client := dialTestClient(t, ts, again.Key)
+	client.subscribeAuthorized(rotated, "private-room", "")
+	assert.Equal(t, gsockets.ERROR_CONNECTION_IS_UNAUTHORIZED, errorCode(t, client.expect("pusher:subscription_error")))
+
+	res = doRequest(t, adminRequest(t, http.MethodPost, url+"/admin/apps/1234/rotate", `{"grace_period":"soon"}`), nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+// slowAppManager waits before storing the changed apps, so the concurrent changes overlap.
+type slowAppManager struct {
+	gsockets.WritableAppManager
+}
+
+func (s slowAppManager) UpdateApp(ctx context.Context, app *gsockets.App) error {
+	time.Sleep(10 * time.Millisecond)
+	return s.WritableAppManager.UpdateApp(ctx, app)
+}
+
+func (s slowAppManager) ModifyApp(ctx context.Context, id string, modify func(app *gsockets.App) error) (*gsockets.App, error) {
+	return s.WritableAppManager.ModifyApp(ctx, id, func(app *gsockets.App) error {
+		time.Sleep(10 * time.Millisecond)
+		return modify(app)
+	})
+}
+
+func TestAdminApiConcurrentRotations(t *testing.T) {
+	cfg := getTestConfig(getTestApp())
+	cfg.Admin.Token = testAdminToken
+
+	srv, ts := newTestServer(t, cfg)
+	srv.apps = slowAppManager{srv.apps.(gsockets.WritableAppManager)}
+	url := ts.URL
+
+	rotated := make([]gsockets.App, 10)
+
+	var wg sync.WaitGroup
+	for i := range rotated {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			res := doRequest(t, adminRequest(t, http.MethodPost, url+"/admin/apps/1234/rotate", `{"grace_period":"1h"}`), &rotated[i])
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+		}(i)
+	}
+
+	wg.Wait()
+
+	// Every rotation starts from the credentials of the previous one, none of them is lost.
+	previousKeys := make(map[string]bool)
+	for _, app := range rotated {
+		assert.False(t, previousKeys[app.PreviousKey], "the key %s was rotated twice", app.PreviousKey)
+		previousKeys[app.PreviousKey] = true
+	}
+}
+
+func TestDisabledAppIsRejected(t *testing.T) {
+	app := getTestApp()
+	app.Disabled = true
+
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	res := doRequest(t, signedRequest(t, app, http.MethodGet, ts.URL, "/apps/1234/channels", nil, nil), nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/app/"+app.Key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer ws.Close()
+	_ = ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	var event testEvent
+	assert.Nil(t, ws.ReadJSON(&event))
+
+	var data struct {
+		Code int `json:"code"`
+	}
+
+	assert.Nil(t, json.Unmarshal(event.Data, &data))
+	assert.Equal(t, gsockets.ERROR_APPLICATION_DISABLED, data.Code)
+}
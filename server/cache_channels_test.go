@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gsockets/gsockets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheChannelReplaysLastEvent(t *testing.T) {
+	wr := &webhookReceiver{}
+	receiver := httptest.NewServer(wr)
+	defer receiver.Close()
+
+	app := getTestApp()
+	app.Webhooks = []gsockets.Webhook{{Url: receiver.URL, EventTypes: []string{gsockets.WEBHOOK_CACHE_MISS}}}
+
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	first := dialTestClient(t, ts, app.Key)
+	first.subscribe("cache-news")
+	first.expect("pusher:cache_miss")
+
+	assert.Eventually(t, func() bool { return len(wr.received()) == 1 }, 2*time.Second, 10*time.Millisecond, "cache_miss webhook must be sent")
+	assert.Equal(t, []gsockets.WebhookEvent{{Name: gsockets.WEBHOOK_CACHE_MISS, Channel: "cache-news"}}, wr.received())
+
+	for _, data := range []string{"first", "second"} {
+		body := gsockets.PusherAPIMessage{Name: "headline", Channels: []string{"cache-news"}, Data: data}
+		res := doRequest(t, signedRequest(t, app, http.MethodPost, ts.URL, "/apps/1234/events", nil, body), nil)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+
+		first.expect("headline")
+	}
+
+	second := dialTestClient(t, ts, app.Key)
+	second.subscribe("cache-news")
+
+	event := second.expect("headline")
+	assert.Equal(t, "cache-news", event.Channel)
+	assert.JSONEq(t, `"second"`, string(event.Data), "the last event must be replayed")
+}
+
+func TestPrivateCacheChannelReplaysClientEvents(t *testing.T) {
+	app := getTestApp()
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	sender := dialTestClient(t, ts, app.Key)
+	other := dialTestClient(t, ts, app.Key)
+
+	for _, client := range []*testClient{sender, other} {
+		client.subscribeAuthorized(app, "private-cache-room", "")
+		client.expect("pusher_internal:subscription_succeeded")
+		client.expect("pusher:cache_miss")
+	}
+
+	sender.sendToChannel("client-status", "private-cache-room", map[string]string{"status": "online"})
+	other.expect("client-status")
+
+	late := dialTestClient(t, ts, app.Key)
+	late.subscribeAuthorized(app, "private-cache-room", "")
+	late.expect("pusher_internal:subscription_succeeded")
+
+	event := late.expect("client-status")
+	assert.JSONEq(t, `{"status":"online"}`, string(event.Data))
+}
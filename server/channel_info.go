@@ -0,0 +1,80 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gsockets/gsockets"
+)
+
+var (
+	errInvalidChannelInfo = errors.New("info must be a comma separated list of user_count and subscription_count")
+	errUserCountPresence  = errors.New("user_count is only available for presence channels")
+)
+
+// channelInfo lists the channel attributes requested with the info parameter of the http api.
+type channelInfo struct {
+	userCount         bool
+	subscriptionCount bool
+}
+
+func parseChannelInfo(info string) (channelInfo, error) {
+	var ret channelInfo
+	if info == "" {
+		return ret, nil
+	}
+
+	for _, attribute := range strings.Split(info, ",") {
+		switch strings.TrimSpace(attribute) {
+		case "user_count":
+			ret.userCount = true
+		case "subscription_count":
+			ret.subscriptionCount = true
+		default:
+			return ret, errInvalidChannelInfo
+		}
+	}
+
+	return ret, nil
+}
+
+// requestedChannelInfo returns the attributes requested by the info query parameter for the channels
+// starting with prefix. The subscription count is returned when no info is requested, as gsockets
+// always did.
+func requestedChannelInfo(r *http.Request, prefix string) (channelInfo, error) {
+	info, err := parseChannelInfo(r.URL.Query().Get("info"))
+	if err != nil {
+		return info, err
+	}
+
+	if info.userCount && !strings.HasPrefix(prefix, "presence-") {
+		return info, errUserCountPresence
+	}
+
+	if info.empty() {
+		info.subscriptionCount = true
+	}
+
+	return info, nil
+}
+
+func (info channelInfo) empty() bool {
+	return !info.userCount && !info.subscriptionCount
+}
+
+// channelAttributes returns the requested attributes of the channel having count connections
+// subscribed. The user count is only set for presence channels.
+func (srv *Server) channelAttributes(appId, channel string, count int, info channelInfo) gsockets.ChannelResponse {
+	ret := gsockets.ChannelResponse{Occupied: count > 0}
+
+	if info.subscriptionCount {
+		ret.SubscriptionCount = count
+	}
+
+	if info.userCount && strings.HasPrefix(channel, "presence-") {
+		ret.UserCount = len(srv.channels.GetChannelMembers(appId, channel))
+	}
+
+	return ret
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gsockets/gsockets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannelInfoAttributes(t *testing.T) {
+	app := getTestApp()
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	// alice joins the presence channel twice, she is counted once in the users.
+	for _, user := range []string{"alice", "alice", "bob"} {
+		client := dialTestClient(t, ts, app.Key)
+		client.subscribeAuthorized(app, "presence-room", `{"user_id":"`+user+`"}`)
+		client.expect("pusher_internal:subscription_succeeded")
+	}
+
+	dialTestClient(t, ts, app.Key).subscribe("news")
+
+	get := func(path string, query url.Values, v any) *http.Response {
+		return doRequest(t, signedRequest(t, app, http.MethodGet, ts.URL, path, query, nil), v)
+	}
+
+	var details map[string]any
+	get("/apps/1234/channels/presence-room", url.Values{"info": {"user_count,subscription_count"}}, &details)
+	assert.Equal(t, map[string]any{"occupied": true, "user_count": 2.0, "subscription_count": 3.0}, details)
+
+	details = nil
+	get("/apps/1234/channels/news", nil, &details)
+	assert.Equal(t, map[string]any{"occupied": true, "subscription_count": 1.0}, details, "subscription count must be returned by default")
+
+	res := get("/apps/1234/channels/news", url.Values{"info": {"user_count"}}, nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode, "user_count must be refused for other channels")
+
+	res = get("/apps/1234/channels/news", url.Values{"info": {"members"}}, nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode, "unknown attributes must be refused")
+
+	var list gsockets.ChannelListResponse
+	get("/apps/1234/channels", url.Values{"info": {"user_count"}, "filter_by_prefix": {"presence-"}}, &list)
+	assert.Equal(t, map[string]gsockets.ChannelResponse{"presence-room": {UserCount: 2, Occupied: true}}, list.Channels)
+
+	res = get("/apps/1234/channels", url.Values{"info": {"user_count"}}, nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode, "user_count requires filtering the presence channels")
+}
+
+func TestTriggerReturnsChannelInfo(t *testing.T) {
+	app := getTestApp()
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	client := dialTestClient(t, ts, app.Key)
+	client.subscribeAuthorized(app, "presence-room", `{"user_id":"alice"}`)
+	client.expect("pusher_internal:subscription_succeeded")
+
+	var resp triggerResponse
+	body := gsockets.PusherAPIMessage{Name: "my-event", Channels: []string{"presence-room", "news"}, Data: "{}", Info: "user_count,subscription_count"}
+	doRequest(t, signedRequest(t, app, http.MethodPost, ts.URL, "/apps/1234/events", nil, body), &resp)
+
+	expected := map[string]gsockets.ChannelResponse{
+		"presence-room": {UserCount: 1, SubscriptionCount: 1, Occupied: true},
+		"news":          {},
+	}
+
+	assert.Equal(t, expected, resp.Channels)
+
+	var batch batchResponse
+	events := gsockets.PusherBatchApiMessage{Batch: []gsockets.PusherAPIMessage{
+		{Name: "my-event", Channel: "presence-room", Data: "{}", Info: "user_count"},
+		{Name: "my-event", Channel: "news", Data: "{}"},
+	}}
+
+	doRequest(t, signedRequest(t, app, http.MethodPost, ts.URL, "/apps/1234/batch_events", nil, events), &batch)
+	assert.Equal(t, []gsockets.ChannelResponse{{UserCount: 1, Occupied: true}, {}}, batch.Batch)
+
+	body.Info = "members"
+	res := doRequest(t, signedRequest(t, app, http.MethodPost, ts.URL, "/apps/1234/events", nil, body), nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
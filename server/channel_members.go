@@ -0,0 +1,85 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gsockets/gsockets"
+)
+
+// maxMembersPageSize is the maximum number of users returned by the users endpoint in a single page.
+const maxMembersPageSize = 1000
+
+var (
+	errInvalidMembersInfo  = errors.New("info must be user_info")
+	errInvalidMembersLimit = errors.New("limit must be between 1 and 1000")
+)
+
+// membersQuery is the page of presence members requested from the users endpoint.
+type membersQuery struct {
+	// userInfo includes the user_info of the members in the response.
+	userInfo bool
+
+	// cursor is the id of the last user of the previous page.
+	cursor string
+
+	// limit is the page size, zero returns all the remaining members.
+	limit int
+}
+
+func parseMembersQuery(r *http.Request) (membersQuery, error) {
+	params := r.URL.Query()
+
+	var query membersQuery
+	switch params.Get("info") {
+	case "":
+	case "user_info":
+		query.userInfo = true
+	default:
+		return query, errInvalidMembersInfo
+	}
+
+	query.cursor = params.Get("cursor")
+
+	if value := params.Get("limit"); value != "" {
+		var err error
+		if query.limit, err = strconv.Atoi(value); err != nil || query.limit < 1 || query.limit > maxMembersPageSize {
+			return query, errInvalidMembersLimit
+		}
+	}
+
+	return query, nil
+}
+
+// membersPage returns the members sorted by user id for the requested page, so a large channel can
+// be paginated consistently while users join and leave.
+func membersPage(members map[string]gsockets.PresenceMember, query membersQuery) gsockets.ChannelMemberResponse {
+	ids := make([]string, 0, len(members))
+	for userId := range members {
+		if userId > query.cursor {
+			ids = append(ids, userId)
+		}
+	}
+
+	sort.Strings(ids)
+
+	var resp gsockets.ChannelMemberResponse
+	if query.limit > 0 && len(ids) > query.limit {
+		ids = ids[:query.limit]
+		resp.NextCursor = ids[query.limit-1]
+	}
+
+	resp.Users = make([]gsockets.ChannelMember, 0, len(ids))
+	for _, userId := range ids {
+		member := gsockets.ChannelMember{Id: userId}
+		if query.userInfo {
+			member.UserInfo = members[userId].UserInfo
+		}
+
+		resp.Users = append(resp.Users, member)
+	}
+
+	return resp
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gsockets/gsockets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannelMembersPagination(t *testing.T) {
+	app := getTestApp()
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	for _, user := range []string{"carol", "alice", "bob"} {
+		client := dialTestClient(t, ts, app.Key)
+		client.subscribeAuthorized(app, "presence-room", `{"user_id":"`+user+`","user_info":{"name":"`+user+`"}}`)
+		client.expect("pusher_internal:subscription_succeeded")
+	}
+
+	var resp gsockets.ChannelMemberResponse
+	doRequest(t, signedRequest(t, app, http.MethodGet, ts.URL, "/apps/1234/channels/presence-room/users", nil, nil), &resp)
+	assert.Equal(t, []gsockets.ChannelMember{{Id: "alice"}, {Id: "bob"}, {Id: "carol"}}, resp.Users)
+	assert.Empty(t, resp.NextCursor)
+
+	query := url.Values{"info": {"user_info"}, "limit": {"2"}}
+	resp = gsockets.ChannelMemberResponse{}
+	doRequest(t, signedRequest(t, app, http.MethodGet, ts.URL, "/apps/1234/channels/presence-room/users", query, nil), &resp)
+	assert.Equal(t, []gsockets.ChannelMember{
+		{Id: "alice", UserInfo: map[string]any{"name": "alice"}},
+		{Id: "bob", UserInfo: map[string]any{"name": "bob"}},
+	}, resp.Users)
+	assert.Equal(t, "bob", resp.NextCursor)
+
+	query = url.Values{"info": {"user_info"}, "limit": {"2"}, "cursor": {resp.NextCursor}}
+	resp = gsockets.ChannelMemberResponse{}
+	doRequest(t, signedRequest(t, app, http.MethodGet, ts.URL, "/apps/1234/channels/presence-room/users", query, nil), &resp)
+	assert.Equal(t, []gsockets.ChannelMember{{Id: "carol", UserInfo: map[string]any{"name": "carol"}}}, resp.Users)
+	assert.Empty(t, resp.NextCursor)
+}
+
+func TestChannelMembersInvalidQuery(t *testing.T) {
+	app := getTestApp()
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	for _, query := range []url.Values{{"info": {"user_count"}}, {"limit": {"0"}}, {"limit": {"1001"}}} {
+		res := doRequest(t, signedRequest(t, app, http.MethodGet, ts.URL, "/apps/1234/channels/presence-room/users", query, nil), nil)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, query.Encode())
+	}
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gsockets/gsockets"
+	channelmanagers "github.com/gsockets/gsockets/channel_managers"
+	"github.com/gsockets/gsockets/config"
+	"github.com/gsockets/gsockets/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestCluster starts n servers using the cluster channel manager, each one having the
+// others as peers.
+func newTestCluster(t *testing.T, n int) []*httptest.Server {
+	return newTestClusterWithConfig(t, n, getTestConfig())
+}
+
+// newTestClusterWithConfig starts a cluster of n servers using the config.
+func newTestClusterWithConfig(t *testing.T, n int, base config.Config) []*httptest.Server {
+	servers := make([]*httptest.Server, n)
+	for i := range servers {
+		servers[i] = httptest.NewUnstartedServer(nil)
+		t.Cleanup(servers[i].Close)
+	}
+
+	for i, ts := range servers {
+		peers := make([]string, 0, n-1)
+		for j, peer := range servers {
+			if i != j {
+				peers = append(peers, "http://"+peer.Listener.Addr().String())
+			}
+		}
+
+		cfg := base
+		cfg.ChannelManager.Driver = "cluster"
+		cfg.ChannelManager.Cluster.Peers = peers
+		cfg.ChannelManager.Cluster.Secret = "cluster-secret"
+
+		srv := New(cfg, log.New())
+		if err := srv.initiate(); err != nil {
+			t.Fatal(err)
+		}
+
+		ts.Config.Handler = srv.router
+		ts.Start()
+	}
+
+	return servers
+}
+
+func TestClusterTriggerReachesClientOnOtherNode(t *testing.T) {
+	app := getTestApp()
+	servers := newTestCluster(t, 3)
+
+	client := dialTestClient(t, servers[0], app.Key)
+	client.subscribe("my-channel")
+
+	body := gsockets.PusherAPIMessage{Name: "my-event", Channels: []string{"my-channel"}, Data: `{"hello":"world"}`}
+	res := doRequest(t, signedRequest(t, app, http.MethodPost, servers[1].URL, "/apps/1234/events", nil, body), nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	event := client.expect("my-event")
+	assert.Equal(t, "my-channel", event.Channel)
+	assert.JSONEq(t, `"{\"hello\":\"world\"}"`, string(event.Data))
+}
+
+func TestClusterChannelsAreGlobal(t *testing.T) {
+	app := getTestApp()
+	servers := newTestCluster(t, 3)
+
+	dialTestClient(t, servers[0], app.Key).subscribe("first")
+	dialTestClient(t, servers[1], app.Key).subscribe("first")
+	dialTestClient(t, servers[1], app.Key).subscribe("second")
+
+	var list gsockets.ChannelListResponse
+	doRequest(t, signedRequest(t, app, http.MethodGet, servers[2].URL, "/apps/1234/channels", nil, nil), &list)
+
+	assert.Equal(t, 2, list.Channels["first"].SubscriptionCount)
+	assert.Equal(t, 1, list.Channels["second"].SubscriptionCount)
+
+	var details gsockets.ChannelResponse
+	doRequest(t, signedRequest(t, app, http.MethodGet, servers[0].URL, "/apps/1234/channels/first", nil, nil), &details)
+
+	assert.Equal(t, 2, details.SubscriptionCount)
+	assert.True(t, details.Occupied)
+}
+
+func TestClusterEndpointsRequireSecret(t *testing.T) {
+	servers := newTestCluster(t, 1)
+
+	res, err := http.Post(servers[0].URL+"/cluster/request", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestClusterRequiresSecret(t *testing.T) {
+	cfg := getTestConfig()
+	cfg.ChannelManager.Driver = "cluster"
+
+	assert.ErrorIs(t, New(cfg, log.New()).initiate(), channelmanagers.ErrMissingClusterSecret)
+}
+
+func TestClusterSkipsFailedPeers(t *testing.T) {
+	app := getTestApp()
+
+	// The peer never answers until the test is over.
+	release := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(hanging.Close)
+	t.Cleanup(func() { close(release) })
+
+	cfg := getTestConfig()
+	cfg.ChannelManager.Driver = "cluster"
+	cfg.ChannelManager.Cluster.Peers = []string{hanging.URL}
+	cfg.ChannelManager.Cluster.Secret = "cluster-secret"
+	cfg.ChannelManager.RequestTimeout = 200 * time.Millisecond
+
+	_, ts := newTestServer(t, cfg)
+
+	durations := make([]time.Duration, 2)
+	for i := range durations {
+		start := time.Now()
+		res := doRequest(t, signedRequest(t, app, http.MethodGet, ts.URL, "/apps/1234/channels", nil, nil), nil)
+		durations[i] = time.Since(start)
+
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	}
+
+	assert.GreaterOrEqual(t, durations[0], 200*time.Millisecond)
+	assert.Less(t, durations[1], 100*time.Millisecond, "the failed peer is skipped")
+}
+
+func TestClusterSubscriptionCountAcrossNodes(t *testing.T) {
+	app := getTestApp()
+	app.EnableSubscriptionCount = true
+
+	cfg := getTestConfig(app)
+	cfg.ChannelManager.SubscriptionCountInterval = 100 * time.Millisecond
+
+	servers := newTestClusterWithConfig(t, 2, cfg)
+
+	expectCount := func(count string, clients ...*testClient) {
+		for _, client := range clients {
+			event := client.expect("pusher_internal:subscription_count")
+			assert.JSONEq(t, `"{\"subscription_count\":`+count+`}"`, string(event.Data))
+		}
+	}
+
+	first := dialTestClient(t, servers[0], app.Key)
+	second := dialTestClient(t, servers[0], app.Key)
+	first.subscribe("my-channel")
+	second.subscribe("my-channel")
+	expectCount("2", first, second)
+
+	third := dialTestClient(t, servers[1], app.Key)
+	third.subscribe("my-channel")
+	expectCount("3", first, second, third)
+
+	// The count is back to the last count sent by the first node, it must be sent all the same.
+	second.send("pusher:unsubscribe", gsockets.MessageData{Channel: "my-channel"})
+	expectCount("2", first, third)
+
+	// Every count is sent once, by a single node.
+	for _, client := range []*testClient{first, third} {
+		client.send("pusher:ping", gsockets.MessageData{})
+		client.expect("pusher:pong")
+	}
+}
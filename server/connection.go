@@ -2,8 +2,7 @@ package server
 
 import (
 	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -17,6 +16,11 @@ import (
 	"github.com/gsockets/gsockets"
 	"github.com/gsockets/gsockets/channels"
 	"github.com/gsockets/gsockets/log"
+	"github.com/gsockets/gsockets/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
 )
 
 const (
@@ -31,6 +35,10 @@ const (
 
 	// Maximum message size allowed from peer.
 	maxMessageSize = 1024 * 100
+
+	// messageOverhead is the room left for the rest of the message when the read limit is raised to
+	// fit the maximum event payload of the app.
+	messageOverhead = 1024 * 10
 )
 
 var (
@@ -53,14 +61,44 @@ type connection struct {
 	subscribedChannels map[string]bool
 	channelLock        sync.Mutex
 
+	webhooks gsockets.WebhookSender
+
+	// clientEvents limits the client events sent by this connection, nil when the app has no limit.
+	clientEvents *rate.Limiter
+
+	// limiter holds the rate limits shared by all the connections of the app.
+	limiter gsockets.RateLimiter
+
+	// history records the events of the channels, for the apps keeping a history.
+	history gsockets.HistoryStore
+
+	metrics gsockets.Metrics
+
 	logger log.Logger
 
-	sendCh chan []byte
+	sendCh chan outgoingMessage
+
+	// closeFrameCh carries the close frame the write pump sends before closing the connection.
+	closeFrameCh chan closeFrame
+
+	closeCh   chan struct{}
+	closeOnce sync.Once
+}
+
+// outgoingMessage is a message waiting to be written to the client, along with the span tracing the
+// write when the message is part of a traced broadcast.
+type outgoingMessage struct {
+	payload []byte
+	span    trace.Span
+}
 
-	closeCh chan struct{}
+// closeFrame is the close code and reason sent to the client when the server closes the connection.
+type closeFrame struct {
+	code    int
+	message string
 }
 
-func NewConnection(app *gsockets.App, conn *websocket.Conn, cm gsockets.ChannelManager, logger log.Logger) gsockets.Connection {
+func NewConnection(app *gsockets.App, conn *websocket.Conn, cm gsockets.ChannelManager, webhooks gsockets.WebhookSender, limiter gsockets.RateLimiter, history gsockets.HistoryStore, metrics gsockets.Metrics, logger log.Logger) gsockets.Connection {
 	connId := generateConnectionId()
 	newConn := &connection{
 		id:                 connId,
@@ -69,9 +107,18 @@ func NewConnection(app *gsockets.App, conn *websocket.Conn, cm gsockets.ChannelM
 		presence:           make(map[string]gsockets.PresenceMember),
 		subscribedChannels: make(map[string]bool),
 		channels:           cm,
+		webhooks:           webhooks,
+		limiter:            limiter,
+		history:            history,
+		metrics:            metrics,
 		logger:             logger.With("connection", connId, "module", "connection"),
 		closeCh:            make(chan struct{}),
-		sendCh:             make(chan []byte),
+		closeFrameCh:       make(chan closeFrame),
+		sendCh:             make(chan outgoingMessage),
+	}
+
+	if app.MaxClientEventsPerSecond > 0 {
+		newConn.clientEvents = rate.NewLimiter(rate.Limit(app.MaxClientEventsPerSecond), app.MaxClientEventsPerSecond)
 	}
 
 	go newConn.readPump()
@@ -137,32 +184,68 @@ func (c *connection) Send(data any) {
 		return
 	}
 
-	c.sendCh <- msg
+	out := outgoingMessage{payload: msg}
+	if traced, ok := data.(gsockets.TracedMessage); ok {
+		tracer := trace.SpanFromContext(traced.Ctx).TracerProvider().Tracer(tracing.InstrumentationName)
+		_, out.span = tracer.Start(traced.Ctx, "websocket.write", trace.WithAttributes(attribute.String("socket_id", c.id)))
+	}
+
+	// Messages sent after the connection is closed are dropped.
+	select {
+	case c.sendCh <- out:
+	case <-c.closeCh:
+		if out.span != nil {
+			out.span.SetStatus(codes.Error, "connection closed")
+			out.span.End()
+		}
+	}
 }
 
+// Close removes the connection from the channels and closes the websocket. It is safe to call more
+// than once, and from both the read and write pumps.
 func (c *connection) Close() {
-	c.unsubscribeFromAllChannels()
-	if c.GetUser() != nil {
-		c.channels.RemoveUser(c.app.ID, c.GetUser().Id, c.id)
-	}
+	c.close(websocket.CloseNormalClosure)
+}
 
-	c.closeCh <- struct{}{}
-	close(c.sendCh)
+// close closes the connection, recording the close code in the metrics.
+func (c *connection) close(code int) {
+	c.closeOnce.Do(func() {
+		c.metrics.ConnectionClosed(c.app.ID, code)
 
-	err := c.ws.Close()
-	if err != nil {
-		c.logger.Error("msg", "error closing websocket connection", "error", err.Error())
-	}
+		c.unsubscribeFromAllChannels()
+		if c.GetUser() != nil {
+			c.channels.RemoveUser(c.app.ID, c.GetUser().Id, c.id)
+		}
 
-	c.channels.RemoveConnection(c.app.ID, c)
+		close(c.closeCh)
+
+		err := c.ws.Close()
+		if err != nil {
+			c.logger.Error("msg", "error closing websocket connection", "error", err.Error())
+		}
+
+		c.channels.RemoveConnection(c.app.ID, c)
+	})
+}
+
+// CloseWithCode sends a close frame with the given code to the client once the messages already
+// queued are written, then closes the connection.
+func (c *connection) CloseWithCode(code int, message string) {
+	select {
+	case c.closeFrameCh <- closeFrame{code: code, message: message}:
+	case <-c.closeCh:
+	}
 }
 
 func (c *connection) readPump() {
+	// code is the close code received from the client, abnormal closure if none was received.
+	code := websocket.CloseAbnormalClosure
+
 	defer func() {
-		c.Close()
+		c.close(code)
 	}()
 
-	c.ws.SetReadLimit(maxMessageSize)
+	c.ws.SetReadLimit(c.readLimit())
 	_ = c.ws.SetReadDeadline(time.Now().Add(pongWait))
 
 	c.ws.SetPongHandler(func(appData string) error {
@@ -173,6 +256,11 @@ func (c *connection) readPump() {
 	for {
 		_, message, err := c.ws.ReadMessage()
 		if err != nil {
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				code = closeErr.Code
+			}
+
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				c.logger.Error("msg", "unexpected close on websocket connection", "error", err.Error())
 				return
@@ -182,6 +270,8 @@ func (c *connection) readPump() {
 			return
 		}
 
+		c.metrics.MessageReceived(c.app.ID, len(message))
+
 		var pusherMessage gsockets.PusherMessage
 		message = bytes.TrimSpace(bytes.Replace(message, newLine, space, -1))
 
@@ -196,6 +286,19 @@ func (c *connection) readPump() {
 	}
 }
 
+// readLimit returns the maximum message size read from the peer, large enough for the biggest
+// client event allowed for the app.
+func (c *connection) readLimit() int64 {
+	limit := int64(maxMessageSize)
+	if c.app.MaxEventPayload > 0 {
+		if payloadLimit := int64(c.app.MaxEventPayload)*1024 + messageOverhead; payloadLimit > limit {
+			limit = payloadLimit
+		}
+	}
+
+	return limit
+}
+
 func (c *connection) writePump() {
 	ticker := time.NewTicker(pingPeriod)
 
@@ -205,33 +308,9 @@ func (c *connection) writePump() {
 
 	for {
 		select {
-		case msg, ok := <-c.sendCh:
-			_ = c.ws.SetWriteDeadline(time.Now().Add(writeWait))
-
-			if !ok {
-				_ = c.ws.WriteMessage(websocket.CloseMessage, []byte{})
-				c.Close()
-
-				return
-			}
-
-			w, err := c.ws.NextWriter(websocket.TextMessage)
-			if err != nil {
-				c.logger.Error("msg", "error acquiring next writer", "error", err.Error())
-				continue
-			}
-
-			c.logger.Info("msg", "sending message to the client", "payload", string(msg))
-
-			_, err = w.Write(msg)
-			if err != nil {
-				c.logger.Error("msg", "error writing message to the connection", "error", err.Error())
-			}
-
-			if err = w.Close(); err != nil {
-				c.logger.Error("msg", "error closing the writer", "error", err.Error())
-
-				c.Close()
+		case msg := <-c.sendCh:
+			if err := c.write(msg); err != nil {
+				c.close(websocket.CloseAbnormalClosure)
 				return
 			}
 		case <-ticker.C:
@@ -239,15 +318,65 @@ func (c *connection) writePump() {
 			if err := c.ws.WriteMessage(websocket.PingMessage, ping); err != nil {
 				c.logger.Error("msg", "error writing ping message to connection", "error", err.Error())
 
-				c.Close()
+				c.close(websocket.CloseAbnormalClosure)
 				return
 			}
+		case frame := <-c.closeFrameCh:
+			_ = c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(frame.code, frame.message), time.Now().Add(writeWait))
+			c.close(frame.code)
+
+			return
 		case <-c.closeCh:
 			return
 		}
 	}
 }
 
+// write writes the message to the client, ending the span tracing it. Returns an error only when
+// the connection can not be written to anymore.
+func (c *connection) write(msg outgoingMessage) error {
+	if msg.span != nil {
+		defer msg.span.End()
+	}
+
+	_ = c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+
+	w, err := c.ws.NextWriter(websocket.TextMessage)
+	if err != nil {
+		c.logger.Error("msg", "error acquiring next writer", "error", err.Error())
+		recordSpanError(msg.span, err)
+
+		return nil
+	}
+
+	c.logger.Info("msg", "sending message to the client", "payload", string(msg.payload))
+
+	_, err = w.Write(msg.payload)
+	if err != nil {
+		c.logger.Error("msg", "error writing message to the connection", "error", err.Error())
+	}
+
+	if err = w.Close(); err != nil {
+		c.logger.Error("msg", "error closing the writer", "error", err.Error())
+		recordSpanError(msg.span, err)
+
+		return err
+	}
+
+	c.metrics.MessageSent(c.app.ID, len(msg.payload))
+	return nil
+}
+
+// recordSpanError marks the span as failed, the span can be nil.
+func recordSpanError(span trace.Span, err error) {
+	if span == nil {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
 func (c *connection) handleMessage(msg gsockets.PusherMessage) {
 	var data gsockets.MessageData
 	err := json.Unmarshal(msg.Data, &data)
@@ -275,17 +404,21 @@ func (c *connection) handlePong() {
 }
 
 func (c *connection) handleSubscription(payload gsockets.MessageData) {
-	ch := channels.New(payload.Channel, c.channels)
+	ch := channels.New(payload.Channel, c.channels, c.webhooks)
 	err := ch.Subscribe(c.app.ID, c, payload)
 
 	if err != nil {
 		var pusherErr gsockets.PusherError
 		if errors.As(err, &pusherErr) {
+			c.metrics.SubscriptionError(c.app.ID, pusherErr.Code)
+
 			errPayload := gsockets.NewPusherError("pusher:subscription_error", pusherErr.Message, payload.Channel, pusherErr.Code)
 			c.Send(errPayload)
 			return
 		}
 
+		c.metrics.SubscriptionError(c.app.ID, gsockets.ERROR_CONNECTION_IS_UNAUTHORIZED)
+
 		errPayload := gsockets.NewPusherError("pusher:subscription_error", err.Error(), payload.Channel, gsockets.ERROR_CONNECTION_IS_UNAUTHORIZED)
 		c.Send(errPayload)
 
@@ -299,6 +432,28 @@ func (c *connection) handleSubscription(payload gsockets.MessageData) {
 
 	c.channelLock.Unlock()
 
+	if payload.LastEventId != nil {
+		c.replayHistory(payload.Channel, *payload.LastEventId)
+	}
+}
+
+// replayHistory sends the events recorded after the last event received by the client. Live events
+// broadcast while the history is read may be sent twice, the clients drop them using the ids.
+func (c *connection) replayHistory(channel string, lastEventId uint64) {
+	if !c.app.History.Enabled {
+		return
+	}
+
+	query := gsockets.HistoryQuery{AfterId: lastEventId}
+	events, err := c.history.Events(context.Background(), c.app.ID, channel, query, c.app.History)
+	if err != nil {
+		c.logger.Error("msg", "error reading channel history", "channel", channel, "error", err.Error())
+		return
+	}
+
+	for _, event := range events {
+		c.Send(event.Message())
+	}
 }
 
 func (c *connection) handleSignin(payload gsockets.MessageData) {
@@ -331,10 +486,15 @@ func (c *connection) handleSignin(payload gsockets.MessageData) {
 		return
 	}
 
+	if c.app.WatchlistTooLarge(len(userInfo.Watchlist)) {
+		message := fmt.Sprintf("The watchlist can not have more than %d users", c.app.MaxWatchlistSize)
+		c.Send(gsockets.NewPusherError("pusher:error", message, payload.Channel, gsockets.ERROR_CONNECTION_IS_UNAUTHORIZED))
+		return
+	}
+
 	userInfo.UserInfo = payload.UserData
 
 	c.SetUser(userInfo.Id, userInfo.UserInfo)
-	c.channels.SetUser(c.app.ID, userInfo.Id, c.id)
 
 	resp := gsockets.PusherSentMessage{
 		Event: "pusher:signin_success",
@@ -342,11 +502,14 @@ func (c *connection) handleSignin(payload gsockets.MessageData) {
 	}
 
 	c.Send(resp)
+
+	// The watchlist events follow the signin success, like pusher sends them.
+	c.channels.SetUser(c.app.ID, userInfo.Id, c.id, userInfo.Watchlist)
 }
 
 func (c *connection) verifySinginSignature(payload gsockets.MessageData) error {
-	sigSclice := strings.SplitAfter(payload.Auth, ":")
-	sig, err := hex.DecodeString(strings.Join(sigSclice[1:], ""))
+	key, sigString, _ := strings.Cut(payload.Auth, ":")
+	sig, err := hex.DecodeString(sigString)
 
 	if err != nil {
 		return gsockets.PusherError{Code: gsockets.ERROR_CONNECTION_IS_UNAUTHORIZED, Message: "invalid signature string provided"}
@@ -359,10 +522,7 @@ func (c *connection) verifySinginSignature(payload gsockets.MessageData) error {
 	signatureString.WriteString("::user::")
 	signatureString.WriteString(payload.UserData)
 
-	hasher := hmac.New(sha256.New, []byte(c.app.Secret))
-	hasher.Write([]byte(signatureString.String()))
-
-	if valid := hmac.Equal(sig, hasher.Sum(nil)); !valid {
+	if valid := c.app.VerifySignature(key, []byte(signatureString.String()), sig); !valid {
 		return gsockets.PusherError{Code: gsockets.ERROR_CONNECTION_IS_UNAUTHORIZED, Message: "signature does not match"}
 	}
 
@@ -389,7 +549,7 @@ func (c *connection) handleUnsubscribe(channelName string) {
 // removes the channel from connection's current subscribed channel list. The method
 // calling this method is responsible for accquiring the lock on the channels map.
 func (c *connection) handleUnsubscribeUnlocked(channelName string) {
-	channel := channels.New(channelName, c.channels)
+	channel := channels.New(channelName, c.channels, c.webhooks)
 
 	err := channel.Unsubscribe(c.app.ID, channelName, c)
 	if err != nil {
@@ -402,7 +562,7 @@ func (c *connection) handleUnsubscribeUnlocked(channelName string) {
 
 func (c *connection) handleClientEvent(payload gsockets.PusherMessage) {
 	if !c.app.EnableClientMessages {
-		err := gsockets.NewPusherError("pusher:error", "The app does not have client messaging enabled", payload.Channel, gsockets.ERROR_CLIENT_EVENT_RATE_LIMIT)
+		err := gsockets.NewPusherError("pusher:error", "The app does not have client messaging enabled", payload.Channel, gsockets.ERROR_CLIENT_EVENTS_DISABLED)
 		c.Send(err)
 		return
 	}
@@ -412,18 +572,81 @@ func (c *connection) handleClientEvent(payload gsockets.PusherMessage) {
 		return
 	}
 
+	// The server can not encrypt the client events, so they are refused like pusher does.
+	if channels.IsEncrypted(payload.Channel) {
+		err := gsockets.NewPusherError("pusher:error", "Client events are not supported on encrypted channels", payload.Channel, gsockets.ERROR_CLIENT_EVENTS_ENCRYPTED)
+		c.Send(err)
+		return
+	}
+
 	// we silently ignore channel events if the connection is not subscribed to the given channel.
 	if !c.channels.IsInChannel(c.app.ID, payload.Channel, c) {
 		return
 	}
 
-	msg := gsockets.PusherSentMessage{
+	if c.app.EventPayloadTooLarge(len(payload.Data)) {
+		err := gsockets.NewPusherError("pusher:error", fmt.Sprintf("The event data should be less than %d KB", c.app.MaxEventPayload), payload.Channel, gsockets.ERROR_EVENT_PAYLOAD_TOO_LARGE)
+		c.Send(err)
+		return
+	}
+
+	if !c.allowClientEvent() {
+		message := "Client event rate limit exceeded"
+		c.Send(gsockets.NewPusherError("pusher:error", message, payload.Channel, gsockets.ERROR_CLIENT_EVENT_RATE_LIMIT))
+
+		if c.app.CloseOnClientEventRateLimit {
+			c.CloseWithCode(gsockets.ERROR_CLIENT_EVENT_RATE_LIMIT, message)
+		}
+
+		return
+	}
+
+	msg := recordHistory(context.Background(), c.history, c.app, gsockets.PusherSentMessage{
 		Event:   payload.Event,
 		Channel: payload.Channel,
 		Data:    payload.Data,
-	}
+	}, c.logger)
 
 	c.channels.BroadcastExcept(c.app.ID, payload.Channel, msg, c.id)
+
+	event := gsockets.WebhookEvent{
+		Name:     gsockets.WEBHOOK_CLIENT_EVENT,
+		Channel:  payload.Channel,
+		Event:    payload.Event,
+		Data:     webhookData(payload.Data),
+		SocketId: c.id,
+	}
+
+	if member, ok := c.GetPresence(payload.Channel); ok {
+		event.UserId = member.UserId
+	}
+
+	c.webhooks.Send(c.app, event)
+}
+
+// allowClientEvent checks the client event against the connection limit and the app wide limit.
+func (c *connection) allowClientEvent() bool {
+	if c.clientEvents != nil && !c.clientEvents.Allow() {
+		return false
+	}
+
+	if limit := c.app.MaxAppClientEventsPerSecond; limit > 0 {
+		allowed, _ := c.limiter.Allow("client_events:"+c.app.ID, 1, float64(limit), limit)
+		return allowed
+	}
+
+	return true
+}
+
+// webhookData returns the client event data as the string expected in the webhook payload. Client
+// libraries usually send the data as a json encoded string, other values are sent as raw json.
+func webhookData(data json.RawMessage) string {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		return str
+	}
+
+	return string(data)
 }
 
 func generateConnectionId() string {
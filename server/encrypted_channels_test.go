@@ -0,0 +1,67 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gsockets/gsockets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptedChannelSubscription(t *testing.T) {
+	app := getTestApp()
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	client := dialTestClient(t, ts, app.Key)
+
+	client.send("pusher:subscribe", gsockets.MessageData{Channel: "private-encrypted-room"})
+	assert.Equal(t, gsockets.ERROR_CONNECTION_IS_UNAUTHORIZED, errorCode(t, client.expect("pusher:subscription_error")), "unsigned subscriptions must be refused")
+
+	client.subscribeAuthorized(app, "private-encrypted-room", `{"user_id":"alice"}`)
+	assert.Equal(t, gsockets.ERROR_CONNECTION_IS_UNAUTHORIZED, errorCode(t, client.expect("pusher:subscription_error")), "channel data must be refused")
+
+	client.subscribeAuthorized(app, "private-encrypted-room", "")
+	client.expect("pusher_internal:subscription_succeeded")
+}
+
+func TestEncryptedChannelRefusesClientEvents(t *testing.T) {
+	app := getTestApp()
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	client := dialTestClient(t, ts, app.Key)
+	client.subscribeAuthorized(app, "private-encrypted-room", "")
+	client.expect("pusher_internal:subscription_succeeded")
+
+	client.sendToChannel("client-message", "private-encrypted-room", map[string]string{"ciphertext": "abc", "nonce": "def"})
+	event := client.expect("pusher:error")
+	assert.Equal(t, gsockets.ERROR_CLIENT_EVENTS_ENCRYPTED, errorCode(t, event))
+	assert.Contains(t, string(event.Data), "Client events are not supported on encrypted channels")
+}
+
+func TestTriggerRefusesMixingEncryptedChannels(t *testing.T) {
+	app := getTestApp()
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	client := dialTestClient(t, ts, app.Key)
+	client.subscribeAuthorized(app, "private-encrypted-room", "")
+	client.expect("pusher_internal:subscription_succeeded")
+
+	body := gsockets.PusherAPIMessage{Name: "my-event", Channels: []string{"private-encrypted-room", "public"}, Data: "data"}
+	res := doRequest(t, signedRequest(t, app, http.MethodPost, ts.URL, "/apps/1234/events", nil, body), nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	batch := gsockets.PusherBatchApiMessage{Batch: []gsockets.PusherAPIMessage{
+		{Name: "my-event", Channels: []string{"private-encrypted-room", "private-room"}, Data: "data"},
+	}}
+
+	res = doRequest(t, signedRequest(t, app, http.MethodPost, ts.URL, "/apps/1234/batch_events", nil, batch), nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	encrypted := `{"nonce":"abc","ciphertext":"def"}`
+	body = gsockets.PusherAPIMessage{Name: "my-event", Channels: []string{"private-encrypted-room", "private-encrypted-other"}, Data: encrypted}
+	res = doRequest(t, signedRequest(t, app, http.MethodPost, ts.URL, "/apps/1234/events", nil, body), nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	event := client.expect("my-event")
+	assert.JSONEq(t, `"{\"nonce\":\"abc\",\"ciphertext\":\"def\"}"`, string(event.Data), "encrypted payloads must be relayed as they are")
+}
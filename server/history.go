@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/log"
+)
+
+const (
+	// defaultHistoryPageSize is the number of events returned by the history endpoint when no limit is given.
+	defaultHistoryPageSize = 100
+
+	// maxHistoryPageSize is the maximum number of events returned by the history endpoint.
+	maxHistoryPageSize = 1000
+)
+
+var (
+	errInvalidHistoryCursor = errors.New("cursor must be a cursor returned by a previous request")
+	errInvalidHistoryTime   = errors.New("since and until must be unix timestamps in milliseconds")
+	errInvalidHistoryLimit  = errors.New("limit must be between 1 and 1000")
+)
+
+// recordHistory records the message in the history of its channel when the app keeps one, returning
+// the message with the id assigned to it. The message is sent without id when it can't be recorded.
+func recordHistory(ctx context.Context, history gsockets.HistoryStore, app *gsockets.App, msg gsockets.PusherSentMessage, logger log.Logger) gsockets.PusherSentMessage {
+	if !app.History.Enabled {
+		return msg
+	}
+
+	data, ok := msg.Data.(json.RawMessage)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(msg.Data); err != nil {
+			logger.Error("msg", "error encoding history event", "app_id", app.ID, "channel", msg.Channel, "error", err.Error())
+			return msg
+		}
+	}
+
+	event := gsockets.HistoryEvent{Event: msg.Event, Channel: msg.Channel, Data: data}
+
+	event, err := history.Append(ctx, app.ID, event, app.History)
+	if err != nil {
+		logger.Error("msg", "error recording history event", "app_id", app.ID, "channel", msg.Channel, "error", err.Error())
+		return msg
+	}
+
+	msg.Id = event.Id
+
+	return msg
+}
+
+// parseHistoryQuery reads the history query and the page size from the request parameters. The
+// times are unix timestamps in milliseconds, like the time of the recorded events.
+func parseHistoryQuery(r *http.Request) (gsockets.HistoryQuery, int, error) {
+	params := r.URL.Query()
+
+	var query gsockets.HistoryQuery
+	if cursor := params.Get("cursor"); cursor != "" {
+		id, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return query, 0, errInvalidHistoryCursor
+		}
+
+		query.AfterId = id
+	}
+
+	for name, t := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		value := params.Get(name)
+		if value == "" {
+			continue
+		}
+
+		ms, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return query, 0, errInvalidHistoryTime
+		}
+
+		*t = time.UnixMilli(ms)
+	}
+
+	limit := defaultHistoryPageSize
+	if value := params.Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxHistoryPageSize {
+			return query, 0, errInvalidHistoryLimit
+		}
+	}
+
+	return query, limit, nil
+}
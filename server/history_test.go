@@ -0,0 +1,154 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gsockets/gsockets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistoryReplaysMissedEvents(t *testing.T) {
+	app := getTestApp()
+	app.History = gsockets.ChannelHistory{Enabled: true}
+
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	first := dialTestClient(t, ts, app.Key)
+	first.subscribe("news")
+
+	ids := make([]uint64, 3)
+	for i, data := range []string{"first", "second", "third"} {
+		body := gsockets.PusherAPIMessage{Name: "headline", Channels: []string{"news"}, Data: data}
+		doRequest(t, signedRequest(t, app, http.MethodPost, ts.URL, "/apps/1234/events", nil, body), nil)
+
+		ids[i] = first.expect("headline").Id
+		assert.NotZero(t, ids[i], "recorded events must carry their id")
+	}
+
+	// The client reconnects after receiving only the first event.
+	second := dialTestClient(t, ts, app.Key)
+	second.send("pusher:subscribe", gsockets.MessageData{Channel: "news", LastEventId: &ids[0]})
+	second.expect("pusher_internal:subscription_succeeded")
+
+	for i, data := range []string{`"second"`, `"third"`} {
+		event := second.expect("headline")
+		assert.Equal(t, ids[i+1], event.Id)
+		assert.Equal(t, "news", event.Channel)
+		assert.JSONEq(t, data, string(event.Data))
+	}
+}
+
+func TestHistoryRecordsClientEvents(t *testing.T) {
+	app := getTestApp()
+	app.History = gsockets.ChannelHistory{Enabled: true}
+
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	sender := dialTestClient(t, ts, app.Key)
+	other := dialTestClient(t, ts, app.Key)
+
+	for _, client := range []*testClient{sender, other} {
+		client.subscribeAuthorized(app, "private-room", "")
+		client.expect("pusher_internal:subscription_succeeded")
+	}
+
+	sender.sendToChannel("client-typing", "private-room", map[string]bool{"typing": true})
+	assert.NotZero(t, other.expect("client-typing").Id)
+
+	var none uint64
+	late := dialTestClient(t, ts, app.Key)
+	late.send("pusher:subscribe", gsockets.MessageData{
+		Channel:     "private-room",
+		Auth:        late.channelAuth(app, "private-room", ""),
+		LastEventId: &none,
+	})
+
+	late.expect("pusher_internal:subscription_succeeded")
+	assert.JSONEq(t, `{"typing":true}`, string(late.expect("client-typing").Data))
+}
+
+func TestHistoryDisabledSendsEventsWithoutId(t *testing.T) {
+	app := getTestApp()
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	client := dialTestClient(t, ts, app.Key)
+	client.subscribe("news")
+
+	body := gsockets.PusherAPIMessage{Name: "headline", Channels: []string{"news"}, Data: "first"}
+	doRequest(t, signedRequest(t, app, http.MethodPost, ts.URL, "/apps/1234/events", nil, body), nil)
+	assert.Zero(t, client.expect("headline").Id)
+
+	var none uint64
+	other := dialTestClient(t, ts, app.Key)
+	other.send("pusher:subscribe", gsockets.MessageData{Channel: "news", LastEventId: &none})
+	other.expect("pusher_internal:subscription_succeeded")
+
+	other.send("pusher:ping", gsockets.MessageData{})
+	other.expect("pusher:pong")
+}
+
+func TestChannelEventsPagination(t *testing.T) {
+	app := getTestApp()
+	app.History = gsockets.ChannelHistory{Enabled: true}
+
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	client := dialTestClient(t, ts, app.Key)
+	client.subscribe("news")
+
+	for _, data := range []string{"first", "second", "third"} {
+		body := gsockets.PusherAPIMessage{Name: "headline", Channels: []string{"news"}, Data: data}
+		doRequest(t, signedRequest(t, app, http.MethodPost, ts.URL, "/apps/1234/events", nil, body), nil)
+		client.expect("headline")
+	}
+
+	var page gsockets.ChannelEventsResponse
+	res := doRequest(t, signedRequest(t, app, http.MethodGet, ts.URL, "/apps/1234/channels/news/events", url.Values{"limit": {"2"}}, nil), &page)
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Len(t, page.Events, 2)
+	assert.JSONEq(t, `"first"`, string(page.Events[0].Data))
+	assert.Equal(t, "headline", page.Events[0].Event)
+	assert.Equal(t, "news", page.Events[0].Channel)
+	assert.NotZero(t, page.Events[0].Id)
+	assert.NotZero(t, page.Events[0].TimeMs)
+	assert.NotEmpty(t, page.NextCursor)
+
+	query := url.Values{"limit": {"2"}, "cursor": {page.NextCursor}}
+	page = gsockets.ChannelEventsResponse{}
+	doRequest(t, signedRequest(t, app, http.MethodGet, ts.URL, "/apps/1234/channels/news/events", query, nil), &page)
+
+	assert.Len(t, page.Events, 1)
+	assert.JSONEq(t, `"third"`, string(page.Events[0].Data))
+	assert.Empty(t, page.NextCursor, "last page must not have a cursor")
+
+	query = url.Values{"until": {strconv.FormatInt(time.Now().Add(-time.Hour).UnixMilli(), 10)}}
+	page = gsockets.ChannelEventsResponse{}
+	doRequest(t, signedRequest(t, app, http.MethodGet, ts.URL, "/apps/1234/channels/news/events", query, nil), &page)
+	assert.Empty(t, page.Events)
+
+	for _, query := range []url.Values{{"limit": {"0"}}, {"cursor": {"abc"}}, {"since": {"yesterday"}}} {
+		res := doRequest(t, signedRequest(t, app, http.MethodGet, ts.URL, "/apps/1234/channels/news/events", query, nil), nil)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, query.Encode())
+	}
+}
+
+func TestChannelEventsRequiresHistory(t *testing.T) {
+	app := getTestApp()
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	res := doRequest(t, signedRequest(t, app, http.MethodGet, ts.URL, "/apps/1234/channels/news/events", nil, nil), nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/apps/1234/channels/news/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res = doRequest(t, req, nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode, "the endpoint must be signed")
+}
@@ -1,20 +1,43 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
 	"github.com/gsockets/gsockets"
 	appmanagers "github.com/gsockets/gsockets/app_managers"
+	"github.com/gsockets/gsockets/channels"
+	"github.com/gsockets/gsockets/webhooks"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+const errMixedEncryptedChannels = "cannot trigger an event to encrypted and unencrypted channels at once"
+
 type okResponse struct {
 	Ok bool `json:"ok"`
 }
 
+// triggerResponse carries the attributes of the channels requested with the info parameter.
+type triggerResponse struct {
+	okResponse
+	Channels map[string]gsockets.ChannelResponse `json:"channels,omitempty"`
+}
+
+// batchResponse carries the attributes of the channel of each event, in the order of the batch.
+type batchResponse struct {
+	okResponse
+	Batch []gsockets.ChannelResponse `json:"batch,omitempty"`
+}
+
 func (srv *Server) rootHandler(w http.ResponseWriter, r *http.Request) {
 	resp := struct {
 		Message  string `json:"message"`
@@ -30,7 +53,6 @@ func (srv *Server) rootHandler(w http.ResponseWriter, r *http.Request) {
 // trigger handles the api endpoint that accepts events from the application backends and distributes
 // them to the channels backend to be delivered to the subscirbed clients.
 func (srv *Server) trigger(w http.ResponseWriter, r *http.Request) {
-	appId := chi.URLParam(r, "appId")
 	var body gsockets.PusherAPIMessage
 
 	err := json.NewDecoder(r.Body).Decode(&body)
@@ -39,15 +61,44 @@ func (srv *Server) trigger(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	go srv.broadcast(appId, body)
+	app := appFromContext(r.Context())
+	if app.EventPayloadTooLarge(len(body.Data)) {
+		RenderJSON(w, http.StatusRequestEntityTooLarge, "event data is over the maximum allowed payload size", nil)
+		return
+	}
 
-	RenderJSON(w, http.StatusOK, "", okResponse{Ok: true})
+	if mixesEncryptedChannels(body.Channels) {
+		RenderJSON(w, http.StatusBadRequest, errMixedEncryptedChannels, nil)
+		return
+	}
+
+	info, err := parseChannelInfo(body.Info)
+	if err != nil {
+		RenderJSON(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	if !srv.allowBackendEvents(w, app, len(body.Channels)) {
+		return
+	}
+
+	resp := triggerResponse{okResponse: okResponse{Ok: true}}
+	if !info.empty() {
+		resp.Channels = make(map[string]gsockets.ChannelResponse)
+		for _, channel := range body.Channels {
+			count := srv.channels.GetChannelConnectionCount(app.ID, channel)
+			resp.Channels[channel] = srv.channelAttributes(app.ID, channel, count, info)
+		}
+	}
+
+	go srv.broadcast(detachContext(r.Context()), app, body)
+
+	RenderJSON(w, http.StatusOK, "", resp)
 }
 
 // triggerBatch works similar to the trigger endpoint, the only difference is instead of a single
 // event, this endpoint accepts a batch of events.
 func (srv *Server) triggerBatch(w http.ResponseWriter, r *http.Request) {
-	appId := chi.URLParam(r, "appId")
 	var body gsockets.PusherBatchApiMessage
 
 	err := json.NewDecoder(r.Body).Decode(&body)
@@ -56,23 +107,129 @@ func (srv *Server) triggerBatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	for _, msg := range body.Batch {
+	// The batch is rejected as a whole so a client never has to figure out which events were sent.
+	app := appFromContext(r.Context())
+	events := 0
+	infos := make([]channelInfo, len(body.Batch))
+	for i, msg := range body.Batch {
+		if app.EventPayloadTooLarge(len(msg.Data)) {
+			RenderJSON(w, http.StatusRequestEntityTooLarge, "event data is over the maximum allowed payload size", nil)
+			return
+		}
+
 		if msg.Channel != "" {
-			msg.Channels = append(msg.Channels, msg.Channel)
+			body.Batch[i].Channels = append(msg.Channels, msg.Channel)
 		}
 
-		go srv.broadcast(appId, msg)
+		if mixesEncryptedChannels(body.Batch[i].Channels) {
+			RenderJSON(w, http.StatusBadRequest, errMixedEncryptedChannels, nil)
+			return
+		}
+
+		if infos[i], err = parseChannelInfo(msg.Info); err != nil {
+			RenderJSON(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+
+		events += len(body.Batch[i].Channels)
 	}
 
+	if !srv.allowBackendEvents(w, app, events) {
+		return
+	}
+
+	// Like pusher, the attributes are returned for every event once any of them asks for them. Events
+	// sent to several channels get the attributes of their first channel.
+	resp := batchResponse{okResponse: okResponse{Ok: true}}
+	for i := range body.Batch {
+		if !infos[i].empty() {
+			resp.Batch = make([]gsockets.ChannelResponse, len(body.Batch))
+			break
+		}
+	}
+
+	for i, msg := range body.Batch {
+		if resp.Batch != nil && len(msg.Channels) > 0 {
+			count := srv.channels.GetChannelConnectionCount(app.ID, msg.Channels[0])
+			resp.Batch[i] = srv.channelAttributes(app.ID, msg.Channels[0], count, infos[i])
+		}
+	}
+
+	ctx := detachContext(r.Context())
+	for _, msg := range body.Batch {
+		go srv.broadcast(ctx, app, msg)
+	}
+
+	RenderJSON(w, http.StatusOK, "", resp)
+}
+
+// sendToUser sends an event to all the connections signed in as the user, on the server-to-user
+// channel of the user like pusher does.
+func (srv *Server) sendToUser(w http.ResponseWriter, r *http.Request) {
+	var body gsockets.PusherAPIMessage
+
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		RenderJSON(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	app := appFromContext(r.Context())
+	if app.EventPayloadTooLarge(len(body.Data)) {
+		RenderJSON(w, http.StatusRequestEntityTooLarge, "event data is over the maximum allowed payload size", nil)
+		return
+	}
+
+	if !srv.allowBackendEvents(w, app, 1) {
+		return
+	}
+
+	body.Channel = ""
+	body.Channels = []string{channels.ServerToUser(chi.URLParam(r, "userId"))}
+
+	go srv.broadcast(detachContext(r.Context()), app, body)
+
 	RenderJSON(w, http.StatusOK, "", okResponse{Ok: true})
 }
 
+// mixesEncryptedChannels returns true if an event is sent to both encrypted and unencrypted channels.
+// The payload is encrypted by the backend for encrypted channels, so it can't be valid for both.
+func mixesEncryptedChannels(names []string) bool {
+	encrypted := 0
+	for _, name := range names {
+		if channels.IsEncrypted(name) {
+			encrypted++
+		}
+	}
+
+	return encrypted > 0 && encrypted < len(names)
+}
+
+// allowBackendEvents checks the events sent through the api against the app limit, counting each
+// channel an event is sent to as one event. A request sending more events than the limit allows in
+// a second could never be accepted, it's rejected as too large instead of rate limited.
+func (srv *Server) allowBackendEvents(w http.ResponseWriter, app *gsockets.App, events int) bool {
+	if limit := app.MaxBackendEventsPerSecond; limit > 0 && events > limit {
+		RenderJSON(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("the request sends %d events, more than the limit of %d events per second", events, limit), nil)
+		return false
+	}
+
+	return allowRequest(w, srv.limiter, "backend_events:"+app.ID, events, app.MaxBackendEventsPerSecond)
+}
+
 // allChannels returns all the active channels in the server along with how many connections are subscirbed
 // to each of those channels.
 func (srv *Server) allChannels(w http.ResponseWriter, r *http.Request) {
-	channels := srv.channels.GetGlobalChannelsWithConnectionCount(chi.URLParam(r, "appId"))
+	appId := chi.URLParam(r, "appId")
 	filter := r.URL.Query().Get("filter_by_prefix")
 
+	info, err := requestedChannelInfo(r, filter)
+	if err != nil {
+		RenderJSON(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	channels := srv.channels.GetGlobalChannelsWithConnectionCount(appId)
 	listResponse := make(map[string]gsockets.ChannelResponse)
 
 	for channel, count := range channels {
@@ -80,7 +237,7 @@ func (srv *Server) allChannels(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		listResponse[channel] = gsockets.ChannelResponse{SubscriptionCount: count, Occupied: count > 0}
+		listResponse[channel] = srv.channelAttributes(appId, channel, count, info)
 	}
 
 	RenderJSON(w, http.StatusOK, "", gsockets.ChannelListResponse{Channels: listResponse})
@@ -91,13 +248,14 @@ func (srv *Server) channelDetails(w http.ResponseWriter, r *http.Request) {
 	appId := chi.URLParam(r, "appId")
 	channelName := chi.URLParam(r, "channelName")
 
-	count := srv.channels.GetChannelConnectionCount(appId, channelName)
-	resp := gsockets.ChannelResponse{
-		SubscriptionCount: count,
-		Occupied:          count > 0,
+	info, err := requestedChannelInfo(r, channelName)
+	if err != nil {
+		RenderJSON(w, http.StatusBadRequest, err.Error(), nil)
+		return
 	}
 
-	RenderJSON(w, http.StatusOK, "", resp)
+	count := srv.channels.GetChannelConnectionCount(appId, channelName)
+	RenderJSON(w, http.StatusOK, "", srv.channelAttributes(appId, channelName, count, info))
 }
 
 // channelMembers returns all the users subscribed to a persence channel.
@@ -108,41 +266,147 @@ func (srv *Server) channelMembers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	channelMembers := srv.channels.GetChannelMembers(chi.URLParam(r, "appId"), channelName)
-	members := make([]gsockets.ChannelMember, 0)
+	query, err := parseMembersQuery(r)
+	if err != nil {
+		RenderJSON(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
 
-	for userId := range channelMembers {
-		members = append(members, gsockets.ChannelMember{Id: userId})
+	members := srv.channels.GetChannelMembers(chi.URLParam(r, "appId"), channelName)
+	RenderJSON(w, http.StatusOK, "", membersPage(members, query))
+}
+
+// channelEvents returns a page of the events recorded in the history of a channel, oldest first.
+func (srv *Server) channelEvents(w http.ResponseWriter, r *http.Request) {
+	app := appFromContext(r.Context())
+	if !app.History.Enabled {
+		RenderJSON(w, http.StatusNotFound, "channel history is not enabled for this app", nil)
+		return
+	}
+
+	query, limit, err := parseHistoryQuery(r)
+	if err != nil {
+		RenderJSON(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	// One more event is fetched to know whether there is a next page.
+	query.Limit = limit + 1
+
+	events, err := srv.history.Events(r.Context(), app.ID, chi.URLParam(r, "channelName"), query, app.History)
+	if err != nil {
+		srv.logger.Error("msg", "error fetching channel history", "error", err.Error())
+		RenderJSON(w, http.StatusInternalServerError, "internal server error", nil)
+		return
+	}
+
+	resp := gsockets.ChannelEventsResponse{Events: events}
+	if len(events) > limit {
+		resp.Events = events[:limit]
+		resp.NextCursor = strconv.FormatUint(events[limit-1].Id, 10)
 	}
 
-	resp := gsockets.ChannelMemberResponse{Users: members}
 	RenderJSON(w, http.StatusOK, "", resp)
 }
 
 // terminateUserConnections will disconnect all the connection from a particular user.
 func (srv *Server) terminateUserConnections(w http.ResponseWriter, r *http.Request) {
-	srv.channels.TerminateUserConnections(chi.URLParam(r, "appId"), chi.URLParam(r, "userId"))
-	res := okResponse{Ok: true}
+	terminated := srv.channels.TerminateUserConnections(chi.URLParam(r, "appId"), chi.URLParam(r, "userId"))
+
+	res := struct {
+		okResponse
+		Terminated int `json:"terminated"`
+	}{okResponse: okResponse{Ok: true}, Terminated: terminated}
 
 	RenderJSON(w, http.StatusOK, "", res)
 }
 
+// webhookDeadLetters lists the webhook deliveries of the app which ran out of attempts.
+func (srv *Server) webhookDeadLetters(w http.ResponseWriter, r *http.Request) {
+	deliveries, err := srv.webhooks.DeadLetters(chi.URLParam(r, "appId"))
+	if err != nil {
+		srv.logger.Error("msg", "error fetching webhook dead letters", "error", err.Error())
+		RenderJSON(w, http.StatusInternalServerError, "internal server error", nil)
+		return
+	}
+
+	resp := struct {
+		DeadLetters []webhooks.Delivery `json:"dead_letters"`
+	}{DeadLetters: deliveries}
+
+	RenderJSON(w, http.StatusOK, "", resp)
+}
+
+// replayWebhookDeadLetter schedules a dead-lettered webhook delivery to be sent again.
+func (srv *Server) replayWebhookDeadLetter(w http.ResponseWriter, r *http.Request) {
+	delivery, err := srv.webhooks.Replay(chi.URLParam(r, "appId"), chi.URLParam(r, "deliveryId"))
+	if err != nil {
+		if errors.Is(err, webhooks.ErrDeliveryNotFound) {
+			RenderJSON(w, http.StatusNotFound, err.Error(), nil)
+			return
+		}
+
+		srv.logger.Error("msg", "error replaying webhook dead letter", "error", err.Error())
+		RenderJSON(w, http.StatusInternalServerError, "internal server error", nil)
+		return
+	}
+
+	RenderJSON(w, http.StatusOK, "", delivery)
+}
+
 // broadcast distributes the messages to the channels backend. The message payload should be validated before
 // calling broadcast, it doesn't do any validation or sanity checks, just pushes the message to channels.
-func (srv *Server) broadcast(appId string, msg gsockets.PusherAPIMessage) {
+func (srv *Server) broadcast(ctx context.Context, app *gsockets.App, msg gsockets.PusherAPIMessage) {
+	ctx, span := srv.tracer.Start(ctx, "broadcast", trace.WithAttributes(
+		attribute.String("app_id", app.ID),
+		attribute.String("event", msg.Name),
+		attribute.Int("channels", len(msg.Channels)),
+	))
+
+	defer span.End()
+
 	for _, channel := range msg.Channels {
-		payload := gsockets.PusherSentMessage{
-			Event:   msg.Name,
-			Channel: channel,
-			Data:    msg.Data,
-		}
+		srv.broadcastToChannel(ctx, app, channel, msg)
+	}
+}
 
-		if msg.SocketId == "" {
-			srv.channels.BroadcastToChannel(appId, channel, payload)
-		} else {
-			srv.channels.BroadcastExcept(appId, channel, payload, msg.SocketId)
-		}
+// broadcastToChannel sends the message to a single channel. When traced, the message carries the
+// span so the writes to the connections are recorded as its children.
+func (srv *Server) broadcastToChannel(ctx context.Context, app *gsockets.App, channel string, msg gsockets.PusherAPIMessage) {
+	ctx, span := srv.tracer.Start(ctx, "broadcast.channel", trace.WithAttributes(attribute.String("channel", channel)))
+	defer span.End()
+
+	sent := gsockets.PusherSentMessage{
+		Event:   msg.Name,
+		Channel: channel,
+		Data:    msg.Data,
 	}
+
+	// The events sent to a user are not kept, the user channel can't be subscribed to replay them.
+	userId, toUser := channels.ServerToUserId(channel)
+	if !toUser {
+		sent = recordHistory(ctx, srv.history, app, sent, srv.logger)
+	}
+
+	var payload any = sent
+
+	if span.IsRecording() {
+		payload = gsockets.TracedMessage{Ctx: ctx, Message: payload}
+	}
+
+	if toUser {
+		srv.channels.BroadcastToUser(app.ID, userId, payload)
+	} else if msg.SocketId == "" {
+		srv.channels.BroadcastToChannel(app.ID, channel, payload)
+	} else {
+		srv.channels.BroadcastExcept(app.ID, channel, payload, msg.SocketId)
+	}
+}
+
+// detachContext returns a context carrying the span of ctx which is not canceled with it, for the
+// work going on after the response is sent.
+func detachContext(ctx context.Context) context.Context {
+	return trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx))
 }
 
 // serveWs handles the incoming websocket connections. After doing some validations, serveWs upgrades the connection
@@ -174,9 +438,29 @@ func (srv *Server) serveWs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newConn := NewConnection(app, conn, srv.channels, srv.logger)
+	// The app state is checked after the upgrade, so the client gets the pusher error and the close
+	// code and does not try to reconnect.
+	if app.Disabled {
+		srv.logger.Warn("msg", "connection to a disabled app", "app_id", app.ID)
+		closeWithError(conn, "Application is disabled", gsockets.ERROR_APPLICATION_DISABLED)
+		srv.metrics.ConnectionClosed(app.ID, gsockets.ERROR_APPLICATION_DISABLED)
+
+		return
+	}
+
+	newConn := NewConnection(app, conn, srv.channels, srv.webhooks, srv.limiter, srv.history, srv.metrics, srv.logger)
 	srv.channels.AddConnection(app.ID, newConn)
 
+	// The connection is counted before checking the quota, so the connections accepted concurrently
+	// see each other and can not go over the quota together.
+	if app.ConnectionQuotaReached(srv.channels.GetGlobalConnectionCount(app.ID) - 1) {
+		srv.logger.Warn("msg", "app is over the connection quota", "app_id", app.ID)
+		newConn.Send(gsockets.NewPusherError("pusher:error", "Application is over connection quota", "", gsockets.ERROR_APPLICATION_OVER_CONNECTION_QUOTA))
+		newConn.CloseWithCode(gsockets.ERROR_APPLICATION_OVER_CONNECTION_QUOTA, "Application is over connection quota")
+
+		return
+	}
+
 	srv.logger.Info("msg", "received new connection", "connection", newConn.Id())
 
 	resp := struct {
@@ -195,3 +479,12 @@ func (srv *Server) serveWs(w http.ResponseWriter, r *http.Request) {
 
 	newConn.Send(resp)
 }
+
+// closeWithError sends a pusher:error to a websocket connection not yet handed to the channels backend,
+// and closes it with the same code.
+func closeWithError(conn *websocket.Conn, message string, code int) {
+	_ = conn.SetWriteDeadline(time.Now().Add(writeWait))
+	_ = conn.WriteJSON(gsockets.NewPusherError("pusher:error", message, "", code))
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, message), time.Now().Add(writeWait))
+	_ = conn.Close()
+}
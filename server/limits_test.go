@@ -0,0 +1,323 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/gsockets/gsockets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeWsRejectsConnectionsOverQuota(t *testing.T) {
+	app := getTestApp()
+	app.MaxConnections = 1
+
+	_, ts := newTestServer(t, getTestConfig(app))
+	dialTestClient(t, ts, app.Key)
+
+	wsUrl := "ws" + strings.TrimPrefix(ts.URL, "http") + "/app/" + app.Key
+	ws, _, err := websocket.DefaultDialer.Dial(wsUrl, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer ws.Close()
+	_ = ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	var event testEvent
+	assert.Nil(t, ws.ReadJSON(&event))
+	assert.Equal(t, "pusher:error", event.Event)
+
+	var data struct {
+		Code int `json:"code"`
+	}
+
+	assert.Nil(t, json.Unmarshal(event.Data, &data))
+	assert.Equal(t, gsockets.ERROR_APPLICATION_OVER_CONNECTION_QUOTA, data.Code)
+
+	_, _, err = ws.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, gsockets.ERROR_APPLICATION_OVER_CONNECTION_QUOTA), "connection must be closed with the quota error code")
+}
+
+func TestTriggerRejectsOversizePayload(t *testing.T) {
+	app := getTestApp()
+	app.MaxEventPayload = 1
+
+	_, ts := newTestServer(t, getTestConfig(app))
+	data := strings.Repeat("a", 1025)
+
+	body := gsockets.PusherAPIMessage{Name: "my-event", Channels: []string{"my-channel"}, Data: data}
+	res := doRequest(t, signedRequest(t, app, http.MethodPost, ts.URL, "/apps/1234/events", nil, body), nil)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+
+	batch := gsockets.PusherBatchApiMessage{Batch: []gsockets.PusherAPIMessage{
+		{Name: "my-event", Channel: "my-channel", Data: "small"},
+		{Name: "my-event", Channel: "my-channel", Data: data},
+	}}
+
+	res = doRequest(t, signedRequest(t, app, http.MethodPost, ts.URL, "/apps/1234/batch_events", nil, batch), nil)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+
+	body.Data = "small"
+	res = doRequest(t, signedRequest(t, app, http.MethodPost, ts.URL, "/apps/1234/events", nil, body), nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+func TestClientEventOverPayloadLimit(t *testing.T) {
+	app := getTestApp()
+	app.MaxEventPayload = 1
+
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	client := dialTestClient(t, ts, app.Key)
+	client.subscribeAuthorized(app, "private-room", "")
+	client.expect("pusher_internal:subscription_succeeded")
+
+	client.sendToChannel("client-message", "private-room", map[string]string{"text": strings.Repeat("a", 1025)})
+	event := client.expect("pusher:error")
+
+	var data struct {
+		Code int `json:"code"`
+	}
+
+	assert.Nil(t, json.Unmarshal(event.Data, &data))
+	assert.Equal(t, gsockets.ERROR_EVENT_PAYLOAD_TOO_LARGE, data.Code)
+}
+
+// errorCode returns the code of a pusher:error event.
+func errorCode(t *testing.T, event testEvent) int {
+	var data struct {
+		Code int `json:"code"`
+	}
+
+	assert.Nil(t, json.Unmarshal(event.Data, &data))
+	return data.Code
+}
+
+func TestClientEventsDisabled(t *testing.T) {
+	app := getTestApp()
+	app.EnableClientMessages = false
+
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	client := dialTestClient(t, ts, app.Key)
+	client.subscribeAuthorized(app, "private-room", "")
+	client.expect("pusher_internal:subscription_succeeded")
+
+	client.sendToChannel("client-message", "private-room", map[string]string{"text": "hello"})
+	assert.Equal(t, gsockets.ERROR_CLIENT_EVENTS_DISABLED, errorCode(t, client.expect("pusher:error")))
+}
+
+func TestClientEventRateLimitPerConnection(t *testing.T) {
+	app := getTestApp()
+	app.MaxClientEventsPerSecond = 1
+
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	sender := dialTestClient(t, ts, app.Key)
+	sender.subscribeAuthorized(app, "private-room", "")
+	sender.expect("pusher_internal:subscription_succeeded")
+
+	receiver := dialTestClient(t, ts, app.Key)
+	receiver.subscribeAuthorized(app, "private-room", "")
+	receiver.expect("pusher_internal:subscription_succeeded")
+
+	sender.sendToChannel("client-message", "private-room", map[string]string{"text": "first"})
+	sender.sendToChannel("client-message", "private-room", map[string]string{"text": "second"})
+
+	assert.Equal(t, gsockets.ERROR_CLIENT_EVENT_RATE_LIMIT, errorCode(t, sender.expect("pusher:error")))
+	assert.JSONEq(t, `{"text":"first"}`, string(receiver.expect("client-message").Data))
+
+	// The limit applies to each connection on its own.
+	receiver.sendToChannel("client-message", "private-room", map[string]string{"text": "reply"})
+	assert.JSONEq(t, `{"text":"reply"}`, string(sender.expect("client-message").Data))
+}
+
+func TestClientEventRateLimitPerApp(t *testing.T) {
+	app := getTestApp()
+	app.MaxAppClientEventsPerSecond = 1
+
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	first := dialTestClient(t, ts, app.Key)
+	first.subscribeAuthorized(app, "private-room", "")
+	first.expect("pusher_internal:subscription_succeeded")
+
+	second := dialTestClient(t, ts, app.Key)
+	second.subscribeAuthorized(app, "private-room", "")
+	second.expect("pusher_internal:subscription_succeeded")
+
+	first.sendToChannel("client-message", "private-room", map[string]string{"text": "first"})
+	second.expect("client-message")
+
+	second.sendToChannel("client-message", "private-room", map[string]string{"text": "second"})
+	assert.Equal(t, gsockets.ERROR_CLIENT_EVENT_RATE_LIMIT, errorCode(t, second.expect("pusher:error")))
+}
+
+func TestClientEventRateLimitClosesConnection(t *testing.T) {
+	app := getTestApp()
+	app.MaxClientEventsPerSecond = 1
+	app.CloseOnClientEventRateLimit = true
+
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	client := dialTestClient(t, ts, app.Key)
+	client.subscribeAuthorized(app, "private-room", "")
+	client.expect("pusher_internal:subscription_succeeded")
+
+	client.sendToChannel("client-message", "private-room", map[string]string{"text": "first"})
+	client.sendToChannel("client-message", "private-room", map[string]string{"text": "second"})
+	assert.Equal(t, gsockets.ERROR_CLIENT_EVENT_RATE_LIMIT, errorCode(t, client.expect("pusher:error")))
+
+	_, _, err := client.ws.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, gsockets.ERROR_CLIENT_EVENT_RATE_LIMIT), "connection must be closed with the rate limit error code")
+}
+
+func TestApiRequestRateLimit(t *testing.T) {
+	app := getTestApp()
+	app.MaxApiRequestsPerSecond = 2
+
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	for i := 0; i < 2; i++ {
+		res := doRequest(t, signedRequest(t, app, http.MethodGet, ts.URL, "/apps/1234/channels", nil, nil), nil)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	}
+
+	res := doRequest(t, signedRequest(t, app, http.MethodGet, ts.URL, "/apps/1234/channels", nil, nil), nil)
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	assert.Equal(t, "1", res.Header.Get("Retry-After"))
+}
+
+func TestBackendEventRateLimitCountsChannels(t *testing.T) {
+	app := getTestApp()
+	app.MaxBackendEventsPerSecond = 3
+
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	body := gsockets.PusherAPIMessage{Name: "my-event", Channels: []string{"first", "second"}, Data: "data"}
+	res := doRequest(t, signedRequest(t, app, http.MethodPost, ts.URL, "/apps/1234/events", nil, body), nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// Only one event is left, the batch needs two.
+	batch := gsockets.PusherBatchApiMessage{Batch: []gsockets.PusherAPIMessage{
+		{Name: "my-event", Channel: "first", Data: "data"},
+		{Name: "my-event", Channel: "second", Data: "data"},
+	}}
+
+	res = doRequest(t, signedRequest(t, app, http.MethodPost, ts.URL, "/apps/1234/batch_events", nil, batch), nil)
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	assert.NotEmpty(t, res.Header.Get("Retry-After"))
+
+	body.Channels = []string{"first"}
+	res = doRequest(t, signedRequest(t, app, http.MethodPost, ts.URL, "/apps/1234/events", nil, body), nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+func TestPresenceMemberLimit(t *testing.T) {
+	app := getTestApp()
+	app.MaxPresenceMembers = 1
+
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	alice := dialTestClient(t, ts, app.Key)
+	alice.subscribeAuthorized(app, "presence-room", `{"user_id":"alice"}`)
+	alice.expect("pusher_internal:subscription_succeeded")
+
+	// Another connection of a member is not a new member.
+	again := dialTestClient(t, ts, app.Key)
+	again.subscribeAuthorized(app, "presence-room", `{"user_id":"alice"}`)
+	again.expect("pusher_internal:subscription_succeeded")
+
+	bob := dialTestClient(t, ts, app.Key)
+	bob.subscribeAuthorized(app, "presence-room", `{"user_id":"bob"}`)
+	assert.Equal(t, gsockets.ERROR_PRESENCE_MEMBER_LIMIT, errorCode(t, bob.expect("pusher:subscription_error")))
+}
+
+func TestPresenceUserInfoLimit(t *testing.T) {
+	app := getTestApp()
+	app.MaxPresenceUserInfoSize = 1
+
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	client := dialTestClient(t, ts, app.Key)
+	client.subscribeAuthorized(app, "presence-room", `{"user_id":"alice","user_info":{"bio":"`+strings.Repeat("a", 1024)+`"}}`)
+	assert.Equal(t, gsockets.ERROR_PRESENCE_USER_INFO_TOO_LARGE, errorCode(t, client.expect("pusher:subscription_error")))
+
+	client.subscribeAuthorized(app, "presence-room", `{"user_id":"alice","user_info":{"name":"Alice"}}`)
+	client.expect("pusher_internal:subscription_succeeded")
+}
+
+func TestBackendEventRateLimitRejectsLargeRequests(t *testing.T) {
+	app := getTestApp()
+	app.MaxBackendEventsPerSecond = 1
+
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	// The request could never fit in the limit, retrying it later doesn't help.
+	body := gsockets.PusherAPIMessage{Name: "my-event", Channels: []string{"first", "second"}, Data: "data"}
+	res := doRequest(t, signedRequest(t, app, http.MethodPost, ts.URL, "/apps/1234/events", nil, body), nil)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+	assert.Empty(t, res.Header.Get("Retry-After"))
+
+	body.Channels = []string{"first"}
+	res = doRequest(t, signedRequest(t, app, http.MethodPost, ts.URL, "/apps/1234/events", nil, body), nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+// slowCountChannelManager takes some time to return the number of connections, like a channel manager
+// waiting on the other nodes would.
+type slowCountChannelManager struct {
+	gsockets.ChannelManager
+}
+
+func (s slowCountChannelManager) GetGlobalConnectionCount(appId string) int {
+	count := s.ChannelManager.GetGlobalConnectionCount(appId)
+	time.Sleep(100 * time.Millisecond)
+
+	return count
+}
+
+func TestServeWsQuotaWithConcurrentConnections(t *testing.T) {
+	app := getTestApp()
+	app.MaxConnections = 2
+
+	srv, ts := newTestServer(t, getTestConfig(app))
+	srv.channels = slowCountChannelManager{ChannelManager: srv.channels}
+
+	wsUrl := "ws" + strings.TrimPrefix(ts.URL, "http") + "/app/" + app.Key
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	established := 0
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ws, _, err := websocket.DefaultDialer.Dial(wsUrl, nil)
+			if err != nil {
+				return
+			}
+
+			defer ws.Close()
+			_ = ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+			var event testEvent
+			if ws.ReadJSON(&event) == nil && event.Event == "pusher:connection_established" {
+				lock.Lock()
+				established++
+				lock.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	assert.LessOrEqual(t, established, app.MaxConnections, "concurrent connections must not go over the quota")
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gsockets/gsockets"
+	"github.com/stretchr/testify/assert"
+)
+
+// scrapeMetrics returns the metrics served by the server in the prometheus text format.
+func scrapeMetrics(t *testing.T, baseUrl string) string {
+	res, err := http.Get(baseUrl + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	return string(body)
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	app := getTestApp()
+	cfg := getTestConfig(app)
+	cfg.Metrics.Driver = "prometheus"
+
+	_, ts := newTestServer(t, cfg)
+
+	client := dialTestClient(t, ts, app.Key)
+	client.subscribe("my-channel")
+	client.subscribeAuthorized(app, "presence-room", `{"user_id":"alice"}`)
+	client.expect("pusher_internal:subscription_succeeded")
+
+	client.send("pusher:subscribe", gsockets.MessageData{Channel: "private-room", Auth: "app-key:invalid"})
+	client.expect("pusher:subscription_error")
+
+	res := doRequest(t, signedRequest(t, app, http.MethodGet, ts.URL, "/apps/1234/channels", nil, nil), nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// The requests that are not authenticated don't get their own series per app id.
+	for _, appId := range []string{"random", "other"} {
+		unsigned, err := http.NewRequest(http.MethodGet, ts.URL+"/apps/"+appId+"/channels", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusBadRequest, doRequest(t, unsigned, nil).StatusCode)
+	}
+
+	metrics := scrapeMetrics(t, ts.URL)
+	assert.Contains(t, metrics, `gsockets_connected_sockets{app_id="1234"} 1`)
+	assert.Contains(t, metrics, `gsockets_channels{app_id="1234"} 2`)
+	assert.Contains(t, metrics, `gsockets_presence_members{app_id="1234"} 1`)
+	assert.Contains(t, metrics, `gsockets_subscription_errors_total{app_id="1234",code="4009"} 1`)
+	assert.Contains(t, metrics, `gsockets_http_api_requests_total{app_id="1234",route="/apps/{appId}/channels",status="200"} 1`)
+	assert.Contains(t, metrics, `gsockets_http_api_requests_total{app_id="unknown",route="/apps/{appId}/channels",status="400"} 2`)
+	assert.NotContains(t, metrics, `app_id="random"`)
+	assert.Contains(t, metrics, `gsockets_ws_messages_received_total{app_id="1234"} 3`)
+	assert.Contains(t, metrics, `gsockets_ws_messages_sent_total{app_id="1234"} 4`)
+
+	_ = client.ws.Close()
+
+	assert.Eventually(t, func() bool {
+		metrics := scrapeMetrics(t, ts.URL)
+
+		return strings.Contains(metrics, `gsockets_connected_sockets{app_id="1234"} 0`) &&
+			strings.Contains(metrics, `gsockets_channels{app_id="1234"} 0`) &&
+			strings.Contains(metrics, `gsockets_presence_members{app_id="1234"} 0`) &&
+			strings.Contains(metrics, `gsockets_websocket_close_total{app_id="1234",code="1006"} 1`)
+	}, time.Second, 10*time.Millisecond, "gauges must go back to zero once the connection is closed")
+}
+
+func TestMetricsDisabledByDefault(t *testing.T) {
+	_, ts := newTestServer(t, getTestConfig())
+
+	res, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
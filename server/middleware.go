@@ -1,89 +1,258 @@
 package server
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
+	"context"
 	"encoding/hex"
 	"errors"
+	"math"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/gsockets/gsockets"
 	appmanagers "github.com/gsockets/gsockets/app_managers"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// appContextKey is the request context key for the app authenticated by the AuthMiddleware.
+type appContextKey struct{}
+
+// appFromContext returns the app authenticated by the AuthMiddleware for the request.
+func appFromContext(ctx context.Context) *gsockets.App {
+	app, _ := ctx.Value(appContextKey{}).(*gsockets.App)
+	return app
+}
+
+// unknownAppId labels the metrics of the requests that were not authenticated, so requests for random
+// app ids don't create new series.
+const unknownAppId = "unknown"
+
+// authenticatedAppKey is the request context key for the slot the AuthMiddleware fills with the
+// authenticated app, it lets the middlewares running before it see the app.
+type authenticatedAppKey struct{}
+
+type authenticatedApp struct {
+	app *gsockets.App
+}
+
 type AuthMiddleware struct {
-	apps gsockets.AppManager
+	apps   gsockets.AppManager
+	tracer trace.Tracer
 }
 
-func NewAuthMiddleware(apps gsockets.AppManager) *AuthMiddleware {
-	return &AuthMiddleware{apps: apps}
+func NewAuthMiddleware(apps gsockets.AppManager, tracer trace.Tracer) *AuthMiddleware {
+	return &AuthMiddleware{apps: apps, tracer: tracer}
 }
 
 // Handler verifies the existence of the app and the signature for the request.
 // See https://pusher.com/docs/channels/library_auth_reference/rest-api#Authentication for implementation details.
 func (auth *AuthMiddleware) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		app, err := auth.apps.FindById(r.Context(), chi.URLParam(r, "appId"))
-		if err != nil {
-			if errors.Is(err, appmanagers.ErrInvalidAppId) {
-				RenderJSON(w, http.StatusBadRequest, err.Error(), nil)
-				return
-			}
-
-			RenderJSON(w, http.StatusInternalServerError, "internal server error", nil)
-			return 
-		}
+		ctx, span := auth.tracer.Start(r.Context(), "AuthMiddleware")
+		app, status, message := auth.authenticate(ctx, r)
 
-		queryParams := r.URL.Query()
-		keys := make([]string, 0)
-		authSignature := queryParams.Get("auth_signature")
+		if app == nil {
+			span.SetStatus(codes.Error, message)
+			span.End()
 
-		for key := range queryParams {
-			if key == "auth_signature" {
-				continue
-			}
+			RenderJSON(w, status, message, nil)
+			return
+		}
+
+		span.End()
 
-			keys = append(keys, key)
+		if slot, ok := r.Context().Value(authenticatedAppKey{}).(*authenticatedApp); ok {
+			slot.app = app
 		}
 
-		sort.Strings(keys)
+		ctx = context.WithValue(r.Context(), appContextKey{}, app)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
 
-		queryParamsSorted := make([]string, 0)
-		var signatureString strings.Builder
+// authenticate returns the app the request is signed for. If the request can not be authenticated, it
+// returns a nil app with the status and message of the error response.
+func (auth *AuthMiddleware) authenticate(ctx context.Context, r *http.Request) (*gsockets.App, int, string) {
+	app, err := auth.apps.FindById(ctx, chi.URLParam(r, "appId"))
+	if err != nil {
+		if errors.Is(err, appmanagers.ErrInvalidAppId) {
+			return nil, http.StatusBadRequest, err.Error()
+		}
 
-		signatureString.WriteString(r.Method)
-		signatureString.WriteString("\n")
-		signatureString.WriteString(r.URL.Path)
-		signatureString.WriteString("\n")
+		return nil, http.StatusInternalServerError, "internal server error"
+	}
 
-		for _, key := range keys {
-			var str strings.Builder
-			str.WriteString(key)
-			str.WriteString("=")
-			str.WriteString(queryParams.Get(key))
+	queryParams := r.URL.Query()
+	keys := make([]string, 0)
+	authSignature := queryParams.Get("auth_signature")
 
-			queryParamsSorted = append(queryParamsSorted, str.String())
+	for key := range queryParams {
+		if key == "auth_signature" {
+			continue
 		}
 
-		signatureString.WriteString(strings.Join(queryParamsSorted, "&"))
+		keys = append(keys, key)
+	}
 
-		incomingSignature, err := hex.DecodeString(authSignature)
-		if err != nil {
-			RenderJSON(w, http.StatusUnauthorized, "invalid signature string", nil)
-			return
-		}
+	sort.Strings(keys)
+
+	queryParamsSorted := make([]string, 0)
+	var signatureString strings.Builder
 
-		hasher := hmac.New(sha256.New, []byte(app.Secret))
-		hasher.Write([]byte(signatureString.String()))
+	signatureString.WriteString(r.Method)
+	signatureString.WriteString("\n")
+	signatureString.WriteString(r.URL.Path)
+	signatureString.WriteString("\n")
 
-		if valid := hmac.Equal(hasher.Sum(nil), incomingSignature); !valid {
-			RenderJSON(w, http.StatusUnauthorized, "invalid signature string", nil)
+	for _, key := range keys {
+		var str strings.Builder
+		str.WriteString(key)
+		str.WriteString("=")
+		str.WriteString(queryParams.Get(key))
+
+		queryParamsSorted = append(queryParamsSorted, str.String())
+	}
+
+	signatureString.WriteString(strings.Join(queryParamsSorted, "&"))
+
+	incomingSignature, err := hex.DecodeString(authSignature)
+	if err != nil {
+		return nil, http.StatusUnauthorized, "invalid signature string"
+	}
+
+	if valid := app.VerifySignature(queryParams.Get("auth_key"), []byte(signatureString.String()), incomingSignature); !valid {
+		return nil, http.StatusUnauthorized, "invalid signature string"
+	}
+
+	if app.Disabled {
+		return nil, http.StatusForbidden, "app is disabled"
+	}
+
+	return app, http.StatusOK, ""
+}
+
+type RateLimitMiddleware struct {
+	limiter gsockets.RateLimiter
+}
+
+func NewRateLimitMiddleware(limiter gsockets.RateLimiter) *RateLimitMiddleware {
+	return &RateLimitMiddleware{limiter: limiter}
+}
+
+// Handler limits the api requests per second of the app authenticated by the AuthMiddleware, so it
+// must be used after it.
+func (rl *RateLimitMiddleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app := appFromContext(r.Context())
+		if !allowRequest(w, rl.limiter, "api_requests:"+app.ID, 1, app.MaxApiRequestsPerSecond) {
 			return
 		}
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// allowRequest takes n tokens from the bucket of the key allowing limit tokens per second. If they
+// are not available, it renders a 429 response with the Retry-After header and returns false.
+func allowRequest(w http.ResponseWriter, limiter gsockets.RateLimiter, key string, n, limit int) bool {
+	if limit <= 0 {
+		return true
+	}
+
+	allowed, retryAfter := limiter.Allow(key, n, float64(limit), limit)
+	if allowed {
+		return true
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(retryAfter)))
+	RenderJSON(w, http.StatusTooManyRequests, "rate limit exceeded", nil)
+
+	return false
+}
+
+// retryAfterSeconds rounds the delay up to whole seconds, as expected by the Retry-After header.
+func retryAfterSeconds(delay time.Duration) int {
+	seconds := int(math.Ceil(delay.Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+
+	return seconds
+}
+
+type MetricsMiddleware struct {
+	metrics gsockets.Metrics
+}
+
+func NewMetricsMiddleware(metrics gsockets.Metrics) *MetricsMiddleware {
+	return &MetricsMiddleware{metrics: metrics}
+}
+
+// Handler records the api calls by app, route and response status, including the ones rejected by
+// the middlewares after it. The requests rejected before the app is authenticated are recorded for
+// an unknown app.
+func (m *MetricsMiddleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slot := &authenticatedApp{}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), authenticatedAppKey{}, slot)))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		appId := unknownAppId
+		if slot.app != nil {
+			appId = slot.app.ID
+		}
+
+		m.metrics.ApiRequest(appId, chi.RouteContext(r.Context()).RoutePattern(), status)
+	})
+}
+
+type TracingMiddleware struct {
+	tracer trace.Tracer
+}
+
+func NewTracingMiddleware(tracer trace.Tracer) *TracingMiddleware {
+	return &TracingMiddleware{tracer: tracer}
+}
+
+// Handler starts the span of the api call, continuing the trace of the caller when the request
+// carries a W3C traceparent header.
+func (t *TracingMiddleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := propagation.TraceContext{}.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := t.tracer.Start(ctx, "HTTP "+r.Method, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		route := chi.RouteContext(r.Context()).RoutePattern()
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		span.SetName("HTTP " + r.Method + " " + route)
+		span.SetAttributes(
+			attribute.String("http.method", r.Method),
+			attribute.String("http.route", route),
+			attribute.Int("http.status_code", status),
+			attribute.String("app_id", chi.URLParam(r, "appId")),
+		)
+
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
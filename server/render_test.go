@@ -42,7 +42,7 @@ func TestRenderJsonForSuccessWithData(t *testing.T) {
 	}{Data: "Hello world"}
 	statusCode := 200
 
-	expectedJson := Response{Data: data}
+	expectedJson := data
 
 	jsonParsed, err := json.Marshal(expectedJson)
 	if err != nil {
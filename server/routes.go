@@ -1,24 +1,49 @@
 package server
 
 import (
+	"net/http"
+
 	"github.com/go-chi/chi/v5"
 )
 
 func (srv *Server) routes() {
-	authMiddleware := NewAuthMiddleware(srv.apps)
+	tracingMiddleware := NewTracingMiddleware(srv.tracer)
+	authMiddleware := NewAuthMiddleware(srv.apps, srv.tracer)
+	rateLimitMiddleware := NewRateLimitMiddleware(srv.limiter)
+	metricsMiddleware := NewMetricsMiddleware(srv.metrics)
 
 	srv.router.Get("/", srv.rootHandler)
 	srv.router.Get("/app/{appKey}", srv.serveWs)
 
 	// Authenticated routes
 	srv.router.Group(func(r chi.Router) {
+		r.Use(tracingMiddleware.Handler)
+		r.Use(metricsMiddleware.Handler)
 		r.Use(authMiddleware.Handler)
+		r.Use(rateLimitMiddleware.Handler)
 
 		r.Post("/apps/{appId}/events", srv.trigger)
 		r.Post("/apps/{appId}/batch_events", srv.triggerBatch)
 		r.Get("/apps/{appId}/channels", srv.allChannels)
 		r.Get("/apps/{appId}/channels/{channelName}", srv.channelDetails)
 		r.Get("/apps/{appId}/channels/{channelName}/users", srv.channelMembers)
+		r.Get("/apps/{appId}/channels/{channelName}/events", srv.channelEvents)
+		r.Post("/apps/{appId}/users/{userId}/events", srv.sendToUser)
 		r.Post("/apps/{appId}/users/{userId}/terminate_connections", srv.terminateUserConnections)
+		r.Get("/apps/{appId}/webhooks/dead_letters", srv.webhookDeadLetters)
+		r.Post("/apps/{appId}/webhooks/dead_letters/{deliveryId}/replay", srv.replayWebhookDeadLetter)
 	})
+
+	if handler, ok := srv.metrics.(http.Handler); ok && !srv.metricsOnSeparatePort() {
+		srv.router.Handle("/metrics", handler)
+	}
+
+	if srv.adminEnabled() && !srv.adminOnSeparatePort() {
+		srv.router.Route("/admin", srv.adminRoutes)
+	}
+
+	// Channel managers talking to the other nodes over http receive their messages here.
+	if cluster, ok := srv.channels.(http.Handler); ok {
+		srv.router.Mount("/cluster", cluster)
+	}
 }
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gsockets/gsockets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppAcceptsActiveSecrets(t *testing.T) {
+	app := getTestApp()
+	app.Secrets = []gsockets.AppSecret{
+		{Secret: "next-secret"},
+		{Secret: "expiring-secret", NotAfter: time.Now().Add(time.Hour)},
+		{Secret: "expired-secret", NotAfter: time.Now().Add(-time.Second)},
+	}
+
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	// Every active secret is accepted by the api, the private channels and the signin.
+	for _, secret := range []string{"secret", "next-secret", "expiring-secret"} {
+		signer := app
+		signer.Secret = secret
+
+		res := doRequest(t, signedRequest(t, signer, http.MethodGet, ts.URL, "/apps/1234/channels", nil, nil), nil)
+		assert.Equal(t, http.StatusOK, res.StatusCode, secret)
+
+		client := dialTestClient(t, ts, app.Key)
+		client.subscribeAuthorized(signer, "private-room", "")
+		client.expect("pusher_internal:subscription_succeeded")
+
+		client.signin(signer, `{"id":"alice"}`)
+	}
+
+	expired := app
+	expired.Secret = "expired-secret"
+
+	res := doRequest(t, signedRequest(t, expired, http.MethodGet, ts.URL, "/apps/1234/channels", nil, nil), nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	client := dialTestClient(t, ts, app.Key)
+	client.subscribeAuthorized(expired, "private-room", "")
+	assert.Equal(t, gsockets.ERROR_CONNECTION_IS_UNAUTHORIZED, errorCode(t, client.expect("pusher:subscription_error")))
+}
+
+func TestRotationKeepsActiveSecrets(t *testing.T) {
+	old := getTestApp()
+	old.Secrets = []gsockets.AppSecret{
+		{Secret: "next-secret"},
+		{Secret: "expired-secret", NotAfter: time.Now().Add(-time.Second)},
+	}
+
+	app := old
+	app.Rotate("new-key", "new-secret", time.Now().Add(time.Hour))
+
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	// A backend still signing with an additional secret of the old key keeps working.
+	mid := old
+	mid.Secret = "next-secret"
+
+	res := doRequest(t, signedRequest(t, mid, http.MethodGet, ts.URL, "/apps/1234/channels", nil, nil), nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	client := dialTestClient(t, ts, app.Key)
+	client.subscribeAuthorized(mid, "private-room", "")
+	client.expect("pusher_internal:subscription_succeeded")
+
+	client.signin(mid, `{"id":"alice"}`)
+
+	// The additional secrets only sign for the key they were added to.
+	moved := app
+	moved.Secret = "next-secret"
+
+	res = doRequest(t, signedRequest(t, moved, http.MethodGet, ts.URL, "/apps/1234/channels", nil, nil), nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	expired := old
+	expired.Secret = "expired-secret"
+
+	res = doRequest(t, signedRequest(t, expired, http.MethodGet, ts.URL, "/apps/1234/channels", nil, nil), nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
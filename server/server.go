@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
@@ -12,8 +13,14 @@ import (
 	appmanagers "github.com/gsockets/gsockets/app_managers"
 	channelmanagers "github.com/gsockets/gsockets/channel_managers"
 	"github.com/gsockets/gsockets/config"
+	historystores "github.com/gsockets/gsockets/history_stores"
 	"github.com/gsockets/gsockets/log"
+	"github.com/gsockets/gsockets/metrics"
+	ratelimiters "github.com/gsockets/gsockets/rate_limiters"
+	"github.com/gsockets/gsockets/tracing"
+	"github.com/gsockets/gsockets/webhooks"
 	"github.com/oklog/ulid/v2"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var upgrader = websocket.Upgrader{
@@ -46,11 +53,24 @@ type Server struct {
 
 	apps     gsockets.AppManager
 	channels gsockets.ChannelManager
+	webhooks *webhooks.Sender
+	limiter  gsockets.RateLimiter
+	history  gsockets.HistoryStore
+	metrics  gsockets.Metrics
+
+	tracing trace.TracerProvider
+	tracer  trace.Tracer
 
 	logger     log.Logger
 	config     config.Config
 	httpServer *http.Server
 	router     chi.Router
+
+	// metricsServer serves the metrics when they are configured on a separate port.
+	metricsServer *http.Server
+
+	// adminServer serves the admin api when it's configured on a separate port.
+	adminServer *http.Server
 }
 
 func (srv *Server) Id() string {
@@ -63,6 +83,26 @@ func (srv *Server) Start() error {
 		return err
 	}
 
+	if srv.metricsServer != nil {
+		go func() {
+			srv.logger.Info("msg", "metrics server started listening for requests", "port", srv.config.Metrics.Port)
+
+			if err := srv.metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				srv.logger.Error("msg", "error serving the metrics", "error", err.Error())
+			}
+		}()
+	}
+
+	if srv.adminServer != nil {
+		go func() {
+			srv.logger.Info("msg", "admin server started listening for requests", "port", srv.config.Admin.Port)
+
+			if err := srv.adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				srv.logger.Error("msg", "error serving the admin api", "error", err.Error())
+			}
+		}()
+	}
+
 	srv.logger.Info("msg", "http server started listening for requests", "port", srv.config.Server.Port, "server_id", srv.id)
 
 	err = srv.httpServer.ListenAndServe()
@@ -76,7 +116,9 @@ func (srv *Server) Start() error {
 func (srv *Server) Stop() {
 	srv.closing = true
 
-	shutdownCtx, _ := context.WithTimeout(context.Background(), time.Second*10)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
 	srv.logger.Info("msg", "shutdown sequence initiated", "graceful_timeout", 10)
 
 	go func() {
@@ -91,20 +133,99 @@ func (srv *Server) Stop() {
 	if err != nil {
 		srv.logger.Fatal("msg", "error shutting down the http server", "error", err.Error())
 	}
+
+	if srv.metricsServer != nil {
+		if err := srv.metricsServer.Shutdown(shutdownCtx); err != nil {
+			srv.logger.Error("msg", "error shutting down the metrics server", "error", err.Error())
+		}
+	}
+
+	if srv.adminServer != nil {
+		if err := srv.adminServer.Shutdown(shutdownCtx); err != nil {
+			srv.logger.Error("msg", "error shutting down the admin server", "error", err.Error())
+		}
+	}
+
+	// Distributed channel managers hold connections to their brokers which need to be released.
+	if closer, ok := srv.channels.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			srv.logger.Error("msg", "error closing the channel manager", "error", err.Error())
+		}
+	}
+
+	if closer, ok := srv.limiter.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			srv.logger.Error("msg", "error closing the rate limiter", "error", err.Error())
+		}
+	}
+
+	if closer, ok := srv.history.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			srv.logger.Error("msg", "error closing the history store", "error", err.Error())
+		}
+	}
+
+	srv.webhooks.Close()
+
+	if closer, ok := srv.apps.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			srv.logger.Error("msg", "error closing the app manager", "error", err.Error())
+		}
+	}
+
+	// Exporting providers flush the spans not yet exported.
+	if provider, ok := srv.tracing.(interface{ Shutdown(context.Context) error }); ok {
+		if err := provider.Shutdown(shutdownCtx); err != nil {
+			srv.logger.Error("msg", "error shutting down the tracer provider", "error", err.Error())
+		}
+	}
 }
 
 func (srv *Server) initiate() error {
+	provider, err := tracing.New(srv.config.Tracing)
+	if err != nil {
+		return err
+	}
+
 	apps, err := appmanagers.New(srv.config.AppManager)
 	if err != nil {
 		return err
 	}
 
-	cm, err := channelmanagers.New(srv.config.ChannelManager)
+	apps = tracing.NewAppManager(apps, provider)
+
+	m, err := metrics.New(srv.config.Metrics)
+	if err != nil {
+		return err
+	}
+
+	sender, err := webhooks.New(srv.config.Webhooks, apps, m, srv.logger)
+	if err != nil {
+		return err
+	}
+
+	cm, err := channelmanagers.New(srv.config.ChannelManager, srv.id, sender, m, srv.logger)
+	if err != nil {
+		return err
+	}
+
+	limiter, err := ratelimiters.New(srv.config.RateLimiter, srv.logger)
+	if err != nil {
+		return err
+	}
+
+	history, err := historystores.New(srv.config.History, srv.logger)
 	if err != nil {
 		return err
 	}
 
 	srv.apps = apps
+	srv.webhooks = sender
+	srv.limiter = limiter
+	srv.history = history
+	srv.metrics = m
+	srv.tracing = provider
+	srv.tracer = provider.Tracer(tracing.InstrumentationName)
 	srv.channels = cm
 
 	srv.routes()
@@ -116,5 +237,31 @@ func (srv *Server) initiate() error {
 
 	srv.httpServer = httpServer
 
+	// Metrics on the server port are mounted by the routes, a separate port gets its own server.
+	if handler, ok := m.(http.Handler); ok && srv.metricsOnSeparatePort() {
+		router := chi.NewRouter()
+		router.Handle("/metrics", handler)
+
+		srv.metricsServer = &http.Server{
+			Addr:    fmt.Sprintf(":%d", srv.config.Metrics.Port),
+			Handler: router,
+		}
+	}
+
+	if srv.adminEnabled() && srv.adminOnSeparatePort() {
+		router := chi.NewRouter()
+		router.Route("/admin", srv.adminRoutes)
+
+		srv.adminServer = &http.Server{
+			Addr:    fmt.Sprintf(":%d", srv.config.Admin.Port),
+			Handler: router,
+		}
+	}
+
 	return nil
 }
+
+// metricsOnSeparatePort returns true if the metrics are served on a different port than the api.
+func (srv *Server) metricsOnSeparatePort() bool {
+	return srv.config.Metrics.Port != 0 && srv.config.Metrics.Port != srv.config.Server.Port
+}
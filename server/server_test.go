@@ -0,0 +1,240 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/config"
+	"github.com/gsockets/gsockets/log"
+)
+
+func getTestApp() gsockets.App {
+	return gsockets.App{
+		ID:                   "1234",
+		Key:                  "app-key",
+		Secret:               "secret",
+		EnableClientMessages: true,
+		MaxConnections:       -1,
+		MaxEventPayload:      -1,
+	}
+}
+
+func getTestConfig(apps ...gsockets.App) config.Config {
+	if len(apps) == 0 {
+		apps = []gsockets.App{getTestApp()}
+	}
+
+	return config.Config{
+		AppManager:     config.AppManager{Driver: "array", Array: apps},
+		ChannelManager: config.ChannelManager{Driver: "local"},
+	}
+}
+
+// newTestServer initiates a server for the given config and serves it with httptest.
+func newTestServer(t *testing.T, cfg config.Config) (*Server, *httptest.Server) {
+	srv := New(cfg, log.New())
+	if err := srv.initiate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(srv.router)
+	t.Cleanup(ts.Close)
+
+	return srv, ts
+}
+
+// signedRequest builds a request to the http api signed with the given app's secret.
+func signedRequest(t *testing.T, app gsockets.App, method, baseUrl, path string, query url.Values, body any) *http.Request {
+	if query == nil {
+		query = url.Values{}
+	}
+
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+
+		sum := md5.Sum(payload)
+		query.Set("body_md5", hex.EncodeToString(sum[:]))
+	}
+
+	query.Set("auth_key", app.Key)
+	query.Set("auth_timestamp", strconv.FormatInt(time.Now().Unix(), 10))
+	query.Set("auth_version", "1.0")
+
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	params := make([]string, len(keys))
+	for i, key := range keys {
+		params[i] = key + "=" + query.Get(key)
+	}
+
+	hasher := hmac.New(sha256.New, []byte(app.Secret))
+	hasher.Write([]byte(method + "\n" + path + "\n" + strings.Join(params, "&")))
+	query.Set("auth_signature", hex.EncodeToString(hasher.Sum(nil)))
+
+	req, err := http.NewRequest(method, baseUrl+path+"?"+query.Encode(), bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return req
+}
+
+// doRequest sends the request and decodes the json response body into v when it's not nil.
+func doRequest(t *testing.T, req *http.Request, v any) *http.Response {
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer res.Body.Close()
+
+	if v != nil {
+		if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return res
+}
+
+type testEvent struct {
+	Id      uint64          `json:"id"`
+	Event   string          `json:"event"`
+	Channel string          `json:"channel"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// testClient is a websocket client speaking the pusher protocol.
+type testClient struct {
+	t        *testing.T
+	ws       *websocket.Conn
+	socketId string
+}
+
+// dialTestClient connects to the server and waits for the connection to be established.
+func dialTestClient(t *testing.T, ts *httptest.Server, appKey string) *testClient {
+	wsUrl := "ws" + strings.TrimPrefix(ts.URL, "http") + "/app/" + appKey
+	ws, _, err := websocket.DefaultDialer.Dial(wsUrl, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = ws.Close() })
+
+	client := &testClient{t: t, ws: ws}
+	established := client.expect("pusher:connection_established")
+
+	var data struct {
+		SocketId string `json:"socket_id"`
+	}
+
+	if err := json.Unmarshal(established.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+
+	client.socketId = data.SocketId
+
+	return client
+}
+
+func (c *testClient) send(event string, data any) {
+	c.sendToChannel(event, "", data)
+}
+
+func (c *testClient) sendToChannel(event, channel string, data any) {
+	msg := map[string]any{"event": event, "data": data}
+	if channel != "" {
+		msg["channel"] = channel
+	}
+
+	if err := c.ws.WriteJSON(msg); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// read returns the next event received by the client.
+func (c *testClient) read() testEvent {
+	_ = c.ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	var event testEvent
+	if err := c.ws.ReadJSON(&event); err != nil {
+		c.t.Fatal(err)
+	}
+
+	return event
+}
+
+// expect reads the next event and fails the test if it's not the expected event.
+func (c *testClient) expect(event string) testEvent {
+	received := c.read()
+	if received.Event != event {
+		c.t.Fatalf("expected event %s, got %s: %s", event, received.Event, string(received.Data))
+	}
+
+	return received
+}
+
+// subscribe subscribes to a public channel and waits for the subscription to succeed.
+func (c *testClient) subscribe(channel string) {
+	c.send("pusher:subscribe", gsockets.MessageData{Channel: channel})
+	c.expect("pusher_internal:subscription_succeeded")
+}
+
+// channelAuth returns the auth signature for subscribing to a private or presence channel.
+func (c *testClient) channelAuth(app gsockets.App, channel, channelData string) string {
+	toSign := c.socketId + ":" + channel
+	if channelData != "" {
+		toSign += ":" + channelData
+	}
+
+	hasher := hmac.New(sha256.New, []byte(app.Secret))
+	hasher.Write([]byte(toSign))
+
+	return app.Key + ":" + hex.EncodeToString(hasher.Sum(nil))
+}
+
+// subscribeAuthorized sends a signed subscription request for a private or presence channel
+// without waiting for the reply.
+func (c *testClient) subscribeAuthorized(app gsockets.App, channel, channelData string) {
+	c.send("pusher:subscribe", gsockets.MessageData{
+		Channel:     channel,
+		Auth:        c.channelAuth(app, channel, channelData),
+		ChannelData: channelData,
+	})
+}
+
+// signin authenticates the connection as the user and waits for the signin to succeed.
+func (c *testClient) signin(app gsockets.App, userData string) {
+	hasher := hmac.New(sha256.New, []byte(app.Secret))
+	hasher.Write([]byte(c.socketId + "::user::" + userData))
+
+	c.send("pusher:signin", gsockets.MessageData{
+		Auth:     app.Key + ":" + hex.EncodeToString(hasher.Sum(nil)),
+		UserData: userData,
+	})
+
+	c.expect("pusher:signin_success")
+}
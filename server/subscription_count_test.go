@@ -0,0 +1,42 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gsockets/gsockets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriptionCountEvents(t *testing.T) {
+	wr := &webhookReceiver{}
+	receiver := httptest.NewServer(wr)
+	defer receiver.Close()
+
+	app := getTestApp()
+	app.EnableSubscriptionCount = true
+	app.Webhooks = []gsockets.Webhook{{Url: receiver.URL, EventTypes: []string{gsockets.WEBHOOK_SUBSCRIPTION_COUNT}}}
+
+	cfg := getTestConfig(app)
+	cfg.ChannelManager.SubscriptionCountInterval = 20 * time.Millisecond
+
+	_, ts := newTestServer(t, cfg)
+
+	first := dialTestClient(t, ts, app.Key)
+	second := dialTestClient(t, ts, app.Key)
+	first.subscribe("my-channel")
+	second.subscribe("my-channel")
+
+	for _, client := range []*testClient{first, second} {
+		event := client.expect("pusher_internal:subscription_count")
+		assert.Equal(t, "my-channel", event.Channel)
+		assert.JSONEq(t, `"{\"subscription_count\":2}"`, string(event.Data))
+	}
+
+	count := 2
+	expected := []gsockets.WebhookEvent{{Name: gsockets.WEBHOOK_SUBSCRIPTION_COUNT, Channel: "my-channel", SubscriptionCount: &count}}
+
+	assert.Eventually(t, func() bool { return len(wr.received()) == 1 }, 2*time.Second, 10*time.Millisecond, "subscription_count webhook must be sent")
+	assert.Equal(t, expected, wr.received())
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// spansByName returns the first span recorded with each name.
+func spansByName(spans tracetest.SpanStubs) map[string]tracetest.SpanStub {
+	ret := make(map[string]tracetest.SpanStub)
+	for _, span := range spans {
+		if _, ok := ret[span.Name]; !ok {
+			ret[span.Name] = span
+		}
+	}
+
+	return ret
+}
+
+func TestTracingFollowsTriggeredEvent(t *testing.T) {
+	app := getTestApp()
+	cfg := getTestConfig(app)
+	cfg.Tracing.Driver = "memory"
+
+	srv, ts := newTestServer(t, cfg)
+	exporter := srv.tracing.(*tracing.MemoryProvider).Exporter
+
+	client := dialTestClient(t, ts, app.Key)
+	client.subscribe("my-channel")
+
+	body := gsockets.PusherAPIMessage{Name: "my-event", Channels: []string{"my-channel"}, Data: "data"}
+	req := signedRequest(t, app, http.MethodPost, ts.URL, "/apps/1234/events", nil, body)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	res := doRequest(t, req, nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	client.expect("my-event")
+
+	assert.Eventually(t, func() bool {
+		_, ok := spansByName(exporter.GetSpans())["websocket.write"]
+		return ok
+	}, time.Second, 10*time.Millisecond, "the write to the connection must be traced")
+
+	spans := spansByName(exporter.GetSpans())
+	for _, name := range []string{"HTTP POST /apps/{appId}/events", "AuthMiddleware", "AppManager.FindById", "broadcast", "broadcast.channel", "websocket.write"} {
+		span, ok := spans[name]
+		if !assert.True(t, ok, "span %s must be recorded", name) {
+			continue
+		}
+
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID().String(), "span %s must continue the caller's trace", name)
+	}
+
+	request := spans["HTTP POST /apps/{appId}/events"]
+	assert.Equal(t, "00f067aa0ba902b7", request.Parent.SpanID().String())
+	assert.Equal(t, spans["AuthMiddleware"].SpanContext.SpanID(), spans["AppManager.FindById"].Parent.SpanID())
+	assert.Equal(t, request.SpanContext.SpanID(), spans["broadcast"].Parent.SpanID())
+	assert.Equal(t, spans["broadcast"].SpanContext.SpanID(), spans["broadcast.channel"].Parent.SpanID())
+	assert.Equal(t, spans["broadcast.channel"].SpanContext.SpanID(), spans["websocket.write"].Parent.SpanID())
+}
+
+func TestTracingDisabledByDefault(t *testing.T) {
+	srv, _ := newTestServer(t, getTestConfig())
+
+	_, span := srv.tracer.Start(context.Background(), "test")
+	assert.False(t, span.IsRecording(), "spans must not be recorded without a tracing driver")
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/gsockets/gsockets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendToUserReachesAllUserConnections(t *testing.T) {
+	app := getTestApp()
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	first := dialTestClient(t, ts, app.Key)
+	second := dialTestClient(t, ts, app.Key)
+	other := dialTestClient(t, ts, app.Key)
+
+	first.signin(app, `{"id":"alice"}`)
+	second.signin(app, `{"id":"alice"}`)
+	other.signin(app, `{"id":"bob"}`)
+
+	body := gsockets.PusherAPIMessage{Name: "notification", Data: "hello"}
+	res := doRequest(t, signedRequest(t, app, http.MethodPost, ts.URL, "/apps/1234/users/alice/events", nil, body), nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	for _, client := range []*testClient{first, second} {
+		event := client.expect("notification")
+		assert.Equal(t, "#server-to-user-alice", event.Channel)
+		assert.JSONEq(t, `"hello"`, string(event.Data))
+	}
+
+	// Pusher libraries send to a user by triggering on the server-to-user channel.
+	body = gsockets.PusherAPIMessage{Name: "notification", Channels: []string{"#server-to-user-bob"}, Data: "hi"}
+	doRequest(t, signedRequest(t, app, http.MethodPost, ts.URL, "/apps/1234/events", nil, body), nil)
+
+	event := other.expect("notification")
+	assert.Equal(t, "#server-to-user-bob", event.Channel)
+	assert.JSONEq(t, `"hi"`, string(event.Data))
+
+	first.send("pusher:ping", gsockets.MessageData{})
+	first.expect("pusher:pong")
+}
+
+func TestServerToUserChannelSubscribedBySignedInUser(t *testing.T) {
+	app := getTestApp()
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	client := dialTestClient(t, ts, app.Key)
+	client.signin(app, `{"id":"alice"}`)
+
+	client.send("pusher:subscribe", gsockets.MessageData{Channel: "#server-to-user-alice"})
+	assert.Equal(t, "#server-to-user-alice", client.expect("pusher_internal:subscription_succeeded").Channel)
+
+	body := gsockets.PusherAPIMessage{Name: "notification", Channels: []string{"#server-to-user-alice"}, Data: "hello"}
+	doRequest(t, signedRequest(t, app, http.MethodPost, ts.URL, "/apps/1234/events", nil, body), nil)
+
+	assert.JSONEq(t, `"hello"`, string(client.expect("notification").Data))
+
+	client.send("pusher:ping", gsockets.MessageData{})
+	client.expect("pusher:pong")
+}
+
+func TestServerToUserChannelRefusesOtherConnections(t *testing.T) {
+	app := getTestApp()
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	anonymous := dialTestClient(t, ts, app.Key)
+	anonymous.send("pusher:subscribe", gsockets.MessageData{Channel: "#server-to-user-alice"})
+	assert.Equal(t, gsockets.ERROR_CONNECTION_IS_UNAUTHORIZED, errorCode(t, anonymous.expect("pusher:subscription_error")))
+
+	bob := dialTestClient(t, ts, app.Key)
+	bob.signin(app, `{"id":"bob"}`)
+	bob.send("pusher:subscribe", gsockets.MessageData{Channel: "#server-to-user-alice"})
+	assert.Equal(t, gsockets.ERROR_CONNECTION_IS_UNAUTHORIZED, errorCode(t, bob.expect("pusher:subscription_error")))
+}
+
+func TestWatchlistEvents(t *testing.T) {
+	app := getTestApp()
+	app.MaxWatchlistSize = 2
+
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	bob := dialTestClient(t, ts, app.Key)
+	bob.signin(app, `{"id":"bob"}`)
+
+	alice := dialTestClient(t, ts, app.Key)
+	alice.signin(app, `{"id":"alice","watchlist":["bob","carol"]}`)
+	assert.JSONEq(t, `{"events":[{"name":"online","user_ids":["bob"]}]}`, string(alice.expect("pusher:watchlist_events").Data))
+
+	carol := dialTestClient(t, ts, app.Key)
+	carol.signin(app, `{"id":"carol"}`)
+	assert.JSONEq(t, `{"events":[{"name":"online","user_ids":["carol"]}]}`, string(alice.expect("pusher:watchlist_events").Data))
+
+	_ = bob.ws.Close()
+	assert.JSONEq(t, `{"events":[{"name":"offline","user_ids":["bob"]}]}`, string(alice.expect("pusher:watchlist_events").Data))
+
+	dave := dialTestClient(t, ts, app.Key)
+	userData := `{"id":"dave","watchlist":["alice","bob","carol"]}`
+	hasher := hmac.New(sha256.New, []byte(app.Secret))
+	hasher.Write([]byte(dave.socketId + "::user::" + userData))
+
+	dave.send("pusher:signin", gsockets.MessageData{Auth: app.Key + ":" + hex.EncodeToString(hasher.Sum(nil)), UserData: userData})
+	assert.Equal(t, gsockets.ERROR_CONNECTION_IS_UNAUTHORIZED, errorCode(t, dave.expect("pusher:error")), "watchlist over the limit must be refused")
+}
+
+func TestTerminateUserConnections(t *testing.T) {
+	app := getTestApp()
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	first := dialTestClient(t, ts, app.Key)
+	second := dialTestClient(t, ts, app.Key)
+	other := dialTestClient(t, ts, app.Key)
+
+	first.signin(app, `{"id":"alice"}`)
+	second.signin(app, `{"id":"alice"}`)
+	other.signin(app, `{"id":"bob"}`)
+
+	var body struct {
+		Ok         bool `json:"ok"`
+		Terminated int  `json:"terminated"`
+	}
+
+	res := doRequest(t, signedRequest(t, app, http.MethodPost, ts.URL, "/apps/1234/users/alice/terminate_connections", nil, nil), &body)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.True(t, body.Ok)
+	assert.Equal(t, 2, body.Terminated)
+
+	for _, client := range []*testClient{first, second} {
+		_ = client.ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, _, err := client.ws.ReadMessage()
+		assert.True(t, websocket.IsCloseError(err, gsockets.ERROR_CONNECTION_IS_UNAUTHORIZED), "connection must be closed with 4009, got %v", err)
+	}
+
+	other.send("pusher:ping", gsockets.MessageData{})
+	other.expect("pusher:pong")
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/webhooks"
+	"github.com/stretchr/testify/assert"
+)
+
+// webhookReceiver collects the webhook events sent by the server.
+type webhookReceiver struct {
+	events []gsockets.WebhookEvent
+	lock   sync.Mutex
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var payload webhooks.Payload
+	_ = json.NewDecoder(r.Body).Decode(&payload)
+
+	wr.lock.Lock()
+	defer wr.lock.Unlock()
+
+	wr.events = append(wr.events, payload.Events...)
+}
+
+func (wr *webhookReceiver) received() []gsockets.WebhookEvent {
+	wr.lock.Lock()
+	defer wr.lock.Unlock()
+
+	return append([]gsockets.WebhookEvent{}, wr.events...)
+}
+
+func TestWebhooksForChannelLifecycleAndClientEvents(t *testing.T) {
+	wr := &webhookReceiver{}
+	receiver := httptest.NewServer(wr)
+	defer receiver.Close()
+
+	app := getTestApp()
+	app.Webhooks = []gsockets.Webhook{{
+		Url: receiver.URL,
+		EventTypes: []string{
+			gsockets.WEBHOOK_CHANNEL_OCCUPIED,
+			gsockets.WEBHOOK_CHANNEL_VACATED,
+			gsockets.WEBHOOK_MEMBER_ADDED,
+			gsockets.WEBHOOK_MEMBER_REMOVED,
+			gsockets.WEBHOOK_CLIENT_EVENT,
+		},
+	}}
+
+	_, ts := newTestServer(t, getTestConfig(app))
+
+	sender := dialTestClient(t, ts, app.Key)
+	other := dialTestClient(t, ts, app.Key)
+
+	channelData := `{"user_id":"alice"}`
+	sender.subscribeAuthorized(app, "presence-room", channelData)
+	sender.expect("pusher_internal:subscription_succeeded")
+
+	other.subscribeAuthorized(app, "presence-room", `{"user_id":"bob"}`)
+	other.expect("pusher_internal:subscription_succeeded")
+	sender.expect("pusher_internal:member_added")
+
+	sender.sendToChannel("client-typing", "presence-room", map[string]bool{"typing": true})
+	other.expect("client-typing")
+
+	sender.send("pusher:unsubscribe", gsockets.MessageData{Channel: "presence-room"})
+	other.expect("pusher_internal:member_removed")
+	other.send("pusher:unsubscribe", gsockets.MessageData{Channel: "presence-room"})
+
+	expected := []gsockets.WebhookEvent{
+		{Name: gsockets.WEBHOOK_CHANNEL_OCCUPIED, Channel: "presence-room"},
+		{Name: gsockets.WEBHOOK_MEMBER_ADDED, Channel: "presence-room", UserId: "alice"},
+		{Name: gsockets.WEBHOOK_MEMBER_ADDED, Channel: "presence-room", UserId: "bob"},
+		{Name: gsockets.WEBHOOK_CLIENT_EVENT, Channel: "presence-room", Event: "client-typing", Data: `{"typing":true}`, SocketId: sender.socketId, UserId: "alice"},
+		{Name: gsockets.WEBHOOK_MEMBER_REMOVED, Channel: "presence-room", UserId: "alice"},
+		{Name: gsockets.WEBHOOK_CHANNEL_VACATED, Channel: "presence-room"},
+		{Name: gsockets.WEBHOOK_MEMBER_REMOVED, Channel: "presence-room", UserId: "bob"},
+	}
+
+	assert.Eventually(t, func() bool { return len(wr.received()) == len(expected) }, 2*time.Second, 10*time.Millisecond, "all the webhook events must be delivered")
+	assert.Equal(t, expected, wr.received())
+}
+
+func TestWebhookDeadLetterEndpoints(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	app := getTestApp()
+	app.Webhooks = []gsockets.Webhook{{Url: receiver.URL, EventTypes: []string{gsockets.WEBHOOK_CHANNEL_OCCUPIED}}}
+
+	cfg := getTestConfig(app)
+	cfg.Webhooks.MaxAttempts = 1
+
+	_, ts := newTestServer(t, cfg)
+	dialTestClient(t, ts, app.Key).subscribe("my-channel")
+
+	var list struct {
+		DeadLetters []webhooks.Delivery `json:"dead_letters"`
+	}
+
+	assert.Eventually(t, func() bool {
+		doRequest(t, signedRequest(t, app, http.MethodGet, ts.URL, "/apps/1234/webhooks/dead_letters", nil, nil), &list)
+		return len(list.DeadLetters) == 1
+	}, 2*time.Second, 20*time.Millisecond, "failed delivery must be listed")
+
+	assert.Equal(t, receiver.URL, list.DeadLetters[0].Url)
+	assert.Equal(t, gsockets.WEBHOOK_CHANNEL_OCCUPIED, list.DeadLetters[0].Payload.Events[0].Name)
+
+	path := "/apps/1234/webhooks/dead_letters/" + list.DeadLetters[0].Id + "/replay"
+	res := doRequest(t, signedRequest(t, app, http.MethodPost, ts.URL, path, nil, nil), nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	res = doRequest(t, signedRequest(t, app, http.MethodPost, ts.URL, "/apps/1234/webhooks/dead_letters/unknown/replay", nil, nil), nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
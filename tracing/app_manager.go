@@ -0,0 +1,129 @@
+package tracing
+
+import (
+	"context"
+	"io"
+
+	"github.com/gsockets/gsockets"
+	appmanagers "github.com/gsockets/gsockets/app_managers"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// appManager records a span for every app lookup made through the wrapped app manager.
+type appManager struct {
+	apps   gsockets.AppManager
+	tracer trace.Tracer
+}
+
+// NewAppManager wraps the app manager to trace the app lookups.
+func NewAppManager(apps gsockets.AppManager, provider trace.TracerProvider) gsockets.AppManager {
+	return &appManager{apps: apps, tracer: provider.Tracer(InstrumentationName)}
+}
+
+func (a *appManager) FindById(ctx context.Context, id string) (*gsockets.App, error) {
+	ctx, span := a.tracer.Start(ctx, "AppManager.FindById", trace.WithAttributes(attribute.String("app_id", id)))
+	defer span.End()
+
+	app, err := a.apps.FindById(ctx, id)
+	recordError(span, err)
+
+	return app, err
+}
+
+func (a *appManager) FindByKey(ctx context.Context, key string) (*gsockets.App, error) {
+	ctx, span := a.tracer.Start(ctx, "AppManager.FindByKey", trace.WithAttributes(attribute.String("app_key", key)))
+	defer span.End()
+
+	app, err := a.apps.FindByKey(ctx, key)
+	recordError(span, err)
+
+	return app, err
+}
+
+func (a *appManager) GetAppSecret(ctx context.Context, id string) (string, error) {
+	ctx, span := a.tracer.Start(ctx, "AppManager.GetAppSecret", trace.WithAttributes(attribute.String("app_id", id)))
+	defer span.End()
+
+	secret, err := a.apps.GetAppSecret(ctx, id)
+	recordError(span, err)
+
+	return secret, err
+}
+
+// ListApps returns the apps of the wrapped app manager when it can change them.
+func (a *appManager) ListApps(ctx context.Context) ([]*gsockets.App, error) {
+	apps, ok := a.apps.(gsockets.WritableAppManager)
+	if !ok {
+		return nil, appmanagers.ErrReadOnlyAppManager
+	}
+
+	return apps.ListApps(ctx)
+}
+
+func (a *appManager) CreateApp(ctx context.Context, app *gsockets.App) error {
+	apps, ok := a.apps.(gsockets.WritableAppManager)
+	if !ok {
+		return appmanagers.ErrReadOnlyAppManager
+	}
+
+	return apps.CreateApp(ctx, app)
+}
+
+func (a *appManager) UpdateApp(ctx context.Context, app *gsockets.App) error {
+	apps, ok := a.apps.(gsockets.WritableAppManager)
+	if !ok {
+		return appmanagers.ErrReadOnlyAppManager
+	}
+
+	return apps.UpdateApp(ctx, app)
+}
+
+func (a *appManager) ModifyApp(ctx context.Context, id string, modify func(app *gsockets.App) error) (*gsockets.App, error) {
+	apps, ok := a.apps.(gsockets.WritableAppManager)
+	if !ok {
+		return nil, appmanagers.ErrReadOnlyAppManager
+	}
+
+	return apps.ModifyApp(ctx, id, modify)
+}
+
+func (a *appManager) DeleteApp(ctx context.Context, id string) error {
+	apps, ok := a.apps.(gsockets.WritableAppManager)
+	if !ok {
+		return appmanagers.ErrReadOnlyAppManager
+	}
+
+	return apps.DeleteApp(ctx, id)
+}
+
+// InvalidateApp removes the app from the wrapped app manager when it caches the apps.
+func (a *appManager) InvalidateApp(id string) {
+	if cache, ok := a.apps.(gsockets.AppCache); ok {
+		cache.InvalidateApp(id)
+	}
+}
+
+// InvalidateKey removes the app key from the wrapped app manager when it caches the apps.
+func (a *appManager) InvalidateKey(key string) {
+	if cache, ok := a.apps.(gsockets.AppCache); ok {
+		cache.InvalidateKey(key)
+	}
+}
+
+// Close closes the wrapped app manager when it holds a connection to its storage.
+func (a *appManager) Close() error {
+	if closer, ok := a.apps.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+func recordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
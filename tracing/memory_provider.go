@@ -0,0 +1,20 @@
+package tracing
+
+import (
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// MemoryProvider samples every trace and keeps the finished spans in memory, so tests can inspect them.
+type MemoryProvider struct {
+	*sdktrace.TracerProvider
+
+	Exporter *tracetest.InMemoryExporter
+}
+
+func NewMemoryProvider() *MemoryProvider {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter), sdktrace.WithSampler(sdktrace.AlwaysSample()))
+
+	return &MemoryProvider{TracerProvider: provider, Exporter: exporter}
+}
@@ -0,0 +1,70 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gsockets/gsockets/config"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName identifies the tracers created by gsockets.
+const InstrumentationName = "github.com/gsockets/gsockets"
+
+const defaultServiceName = "gsockets"
+
+var (
+	ErrInvalidTracingDriver = errors.New("invalid tracing driver")
+)
+
+// New returns the tracer provider for the configured driver, tracing is disabled when no driver is
+// configured. Providers exporting spans implement Shutdown(ctx) error to flush the pending spans.
+func New(config config.Tracing) (trace.TracerProvider, error) {
+	switch config.Driver {
+	case "", "none":
+		return trace.NewNoopTracerProvider(), nil
+	case "otlp":
+		return newOtlpProvider(config)
+	case "memory":
+		return NewMemoryProvider(), nil
+	default:
+		return nil, ErrInvalidTracingDriver
+	}
+}
+
+// newOtlpProvider exports the spans in batches to an OpenTelemetry collector over http.
+func newOtlpProvider(config config.Tracing) (trace.TracerProvider, error) {
+	opts := make([]otlptracehttp.Option, 0)
+	if config.Endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpoint(config.Endpoint))
+	}
+
+	if config.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceName := config.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+
+	ratio := config.SampleRatio
+	if ratio <= 0 {
+		ratio = 1
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	), nil
+}
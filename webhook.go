@@ -0,0 +1,68 @@
+package gsockets
+
+import "strings"
+
+const (
+	WEBHOOK_CHANNEL_OCCUPIED = "channel_occupied"
+	WEBHOOK_CHANNEL_VACATED  = "channel_vacated"
+	WEBHOOK_MEMBER_ADDED     = "member_added"
+	WEBHOOK_MEMBER_REMOVED   = "member_removed"
+	WEBHOOK_CLIENT_EVENT     = "client_event"
+	WEBHOOK_CACHE_MISS       = "cache_miss"
+
+	WEBHOOK_SUBSCRIPTION_COUNT = "subscription_count"
+)
+
+// Webhook configures an endpoint of the app backend that gets notified about the events
+// happening on the server.
+type Webhook struct {
+	// Url is the endpoint the webhook events are POSTed to.
+	Url string `json:"url"`
+
+	// EventTypes lists the webhook events sent to this endpoint, e.g. channel_occupied.
+	EventTypes []string `mapstructure:"event_types" json:"event_types,omitempty"`
+
+	// Filter restricts the events to the channels matching it.
+	Filter WebhookFilter `json:"filter"`
+}
+
+// WebhookFilter filters the webhook events by channel name. Empty values match every channel.
+type WebhookFilter struct {
+	ChannelNameStartsWith string `mapstructure:"channel_name_starts_with" json:"channel_name_starts_with,omitempty"`
+	ChannelNameEndsWith   string `mapstructure:"channel_name_ends_with" json:"channel_name_ends_with,omitempty"`
+}
+
+// Matches returns true if the event should be sent to this webhook.
+func (w Webhook) Matches(event WebhookEvent) bool {
+	if !strings.HasPrefix(event.Channel, w.Filter.ChannelNameStartsWith) || !strings.HasSuffix(event.Channel, w.Filter.ChannelNameEndsWith) {
+		return false
+	}
+
+	for _, eventType := range w.EventTypes {
+		if eventType == event.Name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WebhookEvent is a single event inside a webhook request.
+// See https://pusher.com/docs/channels/server_api/webhooks for the details of each event.
+type WebhookEvent struct {
+	Name     string `json:"name"`
+	Channel  string `json:"channel"`
+	UserId   string `json:"user_id,omitempty"`
+	Event    string `json:"event,omitempty"`
+	Data     string `json:"data,omitempty"`
+	SocketId string `json:"socket_id,omitempty"`
+
+	// SubscriptionCount is only sent with the subscription_count event.
+	SubscriptionCount *int `json:"subscription_count,omitempty"`
+}
+
+// WebhookSender delivers the webhook events to the app backends. Implementations must not block
+// the caller while the events are being delivered.
+type WebhookSender interface {
+	Send(app *App, event WebhookEvent)
+}
@@ -0,0 +1,169 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// defaultBoltPath is the database file used when no path is configured for the bolt queue.
+const defaultBoltPath = "gsockets-webhooks.db"
+
+var (
+	pendingBucket     = []byte("pending")
+	deadLettersBucket = []byte("dead_letters")
+)
+
+// boltQueue stores the deliveries in a local bolt database so they survive restarts. Pending
+// deliveries are keyed by id, dead-lettered ones are stored in a nested bucket per app.
+type boltQueue struct {
+	db *bolt.DB
+}
+
+func newBoltQueue(path string) (Queue, error) {
+	if path == "" {
+		path = defaultBoltPath
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(pendingBucket); err != nil {
+			return err
+		}
+
+		_, err := tx.CreateBucketIfNotExists(deadLettersBucket)
+		return err
+	})
+
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &boltQueue{db: db}, nil
+}
+
+func (b *boltQueue) Enqueue(d Delivery) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return putDelivery(tx.Bucket(pendingBucket), d)
+	})
+}
+
+func (b *boltQueue) Due(now time.Time, limit int) ([]Delivery, error) {
+	due := make([]Delivery, 0)
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(pendingBucket).Cursor()
+
+		// Keys are ulids, so the cursor walks the deliveries from the oldest one.
+		for k, v := c.First(); k != nil && len(due) < limit; k, v = c.Next() {
+			var d Delivery
+			if err := json.Unmarshal(v, &d); err != nil {
+				return err
+			}
+
+			if !d.NextAttempt.After(now) {
+				due = append(due, d)
+			}
+		}
+
+		return nil
+	})
+
+	return due, err
+}
+
+func (b *boltQueue) Remove(id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(pendingBucket).Delete([]byte(id))
+	})
+}
+
+func (b *boltQueue) DeadLetter(d Delivery) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(pendingBucket).Delete([]byte(d.Id)); err != nil {
+			return err
+		}
+
+		bucket, err := tx.Bucket(deadLettersBucket).CreateBucketIfNotExists([]byte(d.AppId))
+		if err != nil {
+			return err
+		}
+
+		return putDelivery(bucket, d)
+	})
+}
+
+func (b *boltQueue) DeadLetters(appId string) ([]Delivery, error) {
+	ret := make([]Delivery, 0)
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(deadLettersBucket).Bucket([]byte(appId))
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			var d Delivery
+			if err := json.Unmarshal(v, &d); err != nil {
+				return err
+			}
+
+			ret = append(ret, d)
+			return nil
+		})
+	})
+
+	return ret, err
+}
+
+func (b *boltQueue) Replay(appId, id string) (Delivery, error) {
+	var d Delivery
+
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(deadLettersBucket).Bucket([]byte(appId))
+		if bucket == nil {
+			return ErrDeliveryNotFound
+		}
+
+		v := bucket.Get([]byte(id))
+		if v == nil {
+			return ErrDeliveryNotFound
+		}
+
+		if err := json.Unmarshal(v, &d); err != nil {
+			return err
+		}
+
+		if err := bucket.Delete([]byte(id)); err != nil {
+			return err
+		}
+
+		d = resetDelivery(d)
+		return putDelivery(tx.Bucket(pendingBucket), d)
+	})
+
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	return d, nil
+}
+
+func (b *boltQueue) Close() error {
+	return b.db.Close()
+}
+
+func putDelivery(bucket *bolt.Bucket, d Delivery) error {
+	v, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	return bucket.Put([]byte(d.Id), v)
+}
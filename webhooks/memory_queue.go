@@ -0,0 +1,121 @@
+package webhooks
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryQueue keeps the deliveries in memory, they are lost when the server stops.
+type memoryQueue struct {
+	pending     map[string]Delivery
+	deadLetters map[string]map[string]Delivery
+
+	lock sync.Mutex
+}
+
+func newMemoryQueue() Queue {
+	return &memoryQueue{
+		pending:     make(map[string]Delivery),
+		deadLetters: make(map[string]map[string]Delivery),
+	}
+}
+
+func (m *memoryQueue) Enqueue(d Delivery) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.pending[d.Id] = d
+	return nil
+}
+
+func (m *memoryQueue) Due(now time.Time, limit int) ([]Delivery, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	due := make([]Delivery, 0)
+	for _, d := range m.pending {
+		if !d.NextAttempt.After(now) {
+			due = append(due, d)
+		}
+	}
+
+	sortDeliveries(due)
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	return due, nil
+}
+
+func (m *memoryQueue) Remove(id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.pending, id)
+	return nil
+}
+
+func (m *memoryQueue) DeadLetter(d Delivery) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.pending, d.Id)
+
+	if _, ok := m.deadLetters[d.AppId]; !ok {
+		m.deadLetters[d.AppId] = make(map[string]Delivery)
+	}
+
+	m.deadLetters[d.AppId][d.Id] = d
+	return nil
+}
+
+func (m *memoryQueue) DeadLetters(appId string) ([]Delivery, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	ret := make([]Delivery, 0, len(m.deadLetters[appId]))
+	for _, d := range m.deadLetters[appId] {
+		ret = append(ret, d)
+	}
+
+	sortDeliveries(ret)
+	return ret, nil
+}
+
+func (m *memoryQueue) Replay(appId, id string) (Delivery, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	d, ok := m.deadLetters[appId][id]
+	if !ok {
+		return Delivery{}, ErrDeliveryNotFound
+	}
+
+	delete(m.deadLetters[appId], id)
+
+	d = resetDelivery(d)
+	m.pending[d.Id] = d
+
+	return d, nil
+}
+
+func (m *memoryQueue) Close() error {
+	return nil
+}
+
+// sortDeliveries sorts the deliveries by id, as the ids are ulids this orders them by creation time.
+func sortDeliveries(deliveries []Delivery) {
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].Id < deliveries[j].Id
+	})
+}
+
+// resetDelivery prepares a dead-lettered delivery to be attempted again right away.
+func resetDelivery(d Delivery) Delivery {
+	d.Attempts = 0
+	d.LastError = ""
+	d.NextAttempt = time.Now()
+
+	return d
+}
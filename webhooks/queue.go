@@ -0,0 +1,63 @@
+package webhooks
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gsockets/gsockets/config"
+)
+
+var (
+	ErrInvalidQueueDriver = errors.New("invalid webhook queue driver")
+	ErrDeliveryNotFound   = errors.New("webhook delivery not found")
+)
+
+// Delivery is a webhook request to one url of an app, along with its delivery state.
+type Delivery struct {
+	Id          string    `json:"id"`
+	AppId       string    `json:"app_id"`
+	Url         string    `json:"url"`
+	Payload     Payload   `json:"payload"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	NextAttempt time.Time `json:"next_attempt"`
+}
+
+// Queue stores the pending webhook deliveries until they succeed, and the dead-lettered ones
+// which ran out of attempts.
+type Queue interface {
+	// Enqueue stores the delivery, replacing the existing delivery with the same id.
+	Enqueue(d Delivery) error
+
+	// Due returns up to limit deliveries whose next attempt is not after now, oldest first.
+	Due(now time.Time, limit int) ([]Delivery, error)
+
+	// Remove deletes the delivery from the queue.
+	Remove(id string) error
+
+	// DeadLetter removes the delivery from the queue and stores it in the dead-letter store.
+	DeadLetter(d Delivery) error
+
+	// DeadLetters returns the dead-lettered deliveries of an app, oldest first.
+	DeadLetters(appId string) ([]Delivery, error)
+
+	// Replay moves a dead-lettered delivery back to the queue, resetting its attempts. Returns
+	// ErrDeliveryNotFound if no such delivery exists for the app.
+	Replay(appId, id string) (Delivery, error)
+
+	// Close releases the resources held by the queue.
+	Close() error
+}
+
+// NewQueue returns the queue for the configured driver, defaulting to the in memory queue.
+func NewQueue(cfg config.WebhookQueue) (Queue, error) {
+	switch cfg.Driver {
+	case "", "memory":
+		return newMemoryQueue(), nil
+	case "bolt":
+		return newBoltQueue(cfg.Path)
+	default:
+		return nil, ErrInvalidQueueDriver
+	}
+}
@@ -0,0 +1,108 @@
+package webhooks
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gsockets/gsockets/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestQueues(t *testing.T) map[string]Queue {
+	bolt, err := NewQueue(config.WebhookQueue{Driver: "bolt", Path: filepath.Join(t.TempDir(), "webhooks.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = bolt.Close() })
+
+	return map[string]Queue{"memory": newMemoryQueue(), "bolt": bolt}
+}
+
+func TestNewQueueReturnsErrForInvalidDriver(t *testing.T) {
+	queue, err := NewQueue(config.WebhookQueue{Driver: "invalid"})
+
+	assert.Nil(t, queue)
+	assert.ErrorIs(t, err, ErrInvalidQueueDriver)
+}
+
+func TestQueueDueReturnsOldestDeliveriesFirst(t *testing.T) {
+	now := time.Now()
+
+	for name, queue := range newTestQueues(t) {
+		t.Run(name, func(t *testing.T) {
+			assert.Nil(t, queue.Enqueue(Delivery{Id: "03", AppId: "1", NextAttempt: now}))
+			assert.Nil(t, queue.Enqueue(Delivery{Id: "01", AppId: "1", NextAttempt: now.Add(-time.Second)}))
+			assert.Nil(t, queue.Enqueue(Delivery{Id: "02", AppId: "1", NextAttempt: now.Add(time.Minute)}))
+
+			due, err := queue.Due(now, 10)
+			assert.Nil(t, err)
+			assert.Len(t, due, 2, "deliveries scheduled later must not be due")
+			assert.Equal(t, "01", due[0].Id)
+			assert.Equal(t, "03", due[1].Id)
+
+			due, _ = queue.Due(now, 1)
+			assert.Len(t, due, 1, "due must respect the limit")
+
+			assert.Nil(t, queue.Remove("01"))
+			due, _ = queue.Due(now, 10)
+			assert.Len(t, due, 1)
+		})
+	}
+}
+
+func TestQueueDeadLetterAndReplay(t *testing.T) {
+	for name, queue := range newTestQueues(t) {
+		t.Run(name, func(t *testing.T) {
+			d := Delivery{Id: "01", AppId: "1", Url: "http://localhost", Attempts: 5, LastError: "failed", NextAttempt: time.Now()}
+			assert.Nil(t, queue.Enqueue(d))
+			assert.Nil(t, queue.DeadLetter(d))
+
+			due, _ := queue.Due(time.Now(), 10)
+			assert.Empty(t, due, "dead-lettered delivery must leave the queue")
+
+			deadLetters, err := queue.DeadLetters("1")
+			assert.Nil(t, err)
+			assert.Len(t, deadLetters, 1)
+			assert.Equal(t, "failed", deadLetters[0].LastError)
+
+			deadLetters, _ = queue.DeadLetters("2")
+			assert.Empty(t, deadLetters, "dead letters must be separated per app")
+
+			_, err = queue.Replay("2", "01")
+			assert.ErrorIs(t, err, ErrDeliveryNotFound)
+
+			replayed, err := queue.Replay("1", "01")
+			assert.Nil(t, err)
+			assert.Equal(t, 0, replayed.Attempts)
+			assert.Empty(t, replayed.LastError)
+
+			due, _ = queue.Due(time.Now(), 10)
+			assert.Len(t, due, 1, "replayed delivery must be back in the queue")
+
+			deadLetters, _ = queue.DeadLetters("1")
+			assert.Empty(t, deadLetters)
+		})
+	}
+}
+
+func TestBoltQueueSurvivesRestart(t *testing.T) {
+	cfg := config.WebhookQueue{Driver: "bolt", Path: filepath.Join(t.TempDir(), "webhooks.db")}
+
+	queue, err := NewQueue(cfg)
+	assert.Nil(t, err)
+	assert.Nil(t, queue.Enqueue(Delivery{Id: "01", AppId: "1", NextAttempt: time.Now()}))
+	assert.Nil(t, queue.DeadLetter(Delivery{Id: "02", AppId: "1"}))
+	assert.Nil(t, queue.Close())
+
+	queue, err = NewQueue(cfg)
+	assert.Nil(t, err)
+	defer queue.Close()
+
+	due, _ := queue.Due(time.Now(), 10)
+	assert.Len(t, due, 1, "pending deliveries must survive a restart")
+
+	deadLetters, _ := queue.DeadLetters("1")
+	assert.Len(t, deadLetters, 1, "dead letters must survive a restart")
+}
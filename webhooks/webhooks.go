@@ -0,0 +1,415 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gsockets/gsockets"
+	"github.com/gsockets/gsockets/config"
+	"github.com/gsockets/gsockets/log"
+	"github.com/oklog/ulid/v2"
+)
+
+const (
+	defaultBatchInterval = 100 * time.Millisecond
+	defaultBatchSize     = 50
+	defaultMaxAttempts   = 5
+	defaultRetryDelay    = time.Second
+	defaultMaxRetryDelay = 5 * time.Minute
+	defaultTimeout       = 5 * time.Second
+
+	// queueSize is the number of events buffered before new events get dropped.
+	queueSize = 10000
+
+	// pollInterval is the time between two checks of the queue for the deliveries due.
+	pollInterval = 100 * time.Millisecond
+
+	// maxConcurrentDeliveries limits the number of webhook requests in flight.
+	maxConcurrentDeliveries = 32
+)
+
+// Payload is the body of a webhook request.
+type Payload struct {
+	TimeMs int64                   `json:"time_ms"`
+	Events []gsockets.WebhookEvent `json:"events"`
+}
+
+type appEvent struct {
+	app   *gsockets.App
+	event gsockets.WebhookEvent
+}
+
+// batch holds the events waiting to be sent to a single webhook url of an app.
+type batch struct {
+	appId  string
+	url    string
+	events []gsockets.WebhookEvent
+}
+
+// Sender batches the webhook events per app and webhook url and stores the batches as deliveries
+// in the queue. The deliveries are sent in the background, failed ones are retried with an exponential
+// backoff until they run out of attempts and get moved to the dead-letter store.
+type Sender struct {
+	config  config.Webhooks
+	client  *http.Client
+	apps    gsockets.AppManager
+	queue   Queue
+	metrics gsockets.Metrics
+
+	events chan appEvent
+	wake   chan struct{}
+	done   chan struct{}
+
+	// inflight stores the ids of the deliveries currently being sent, so they are not
+	// picked up again from the queue.
+	inflight     map[string]bool
+	inflightLock sync.Mutex
+	deliveries   sync.WaitGroup
+	slots        chan struct{}
+
+	stopped   sync.WaitGroup
+	closeOnce sync.Once
+
+	logger log.Logger
+}
+
+func New(cfg config.Webhooks, apps gsockets.AppManager, metrics gsockets.Metrics, logger log.Logger) (*Sender, error) {
+	if cfg.BatchInterval <= 0 {
+		cfg.BatchInterval = defaultBatchInterval
+	}
+
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = defaultRetryDelay
+	}
+
+	if cfg.MaxRetryDelay <= 0 {
+		cfg.MaxRetryDelay = defaultMaxRetryDelay
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+
+	queue, err := NewQueue(cfg.Queue)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Sender{
+		config:   cfg,
+		client:   &http.Client{Timeout: cfg.Timeout},
+		apps:     apps,
+		queue:    queue,
+		metrics:  metrics,
+		events:   make(chan appEvent, queueSize),
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		inflight: make(map[string]bool),
+		slots:    make(chan struct{}, maxConcurrentDeliveries),
+		logger:   logger.With("module", "webhooks"),
+	}
+
+	s.stopped.Add(2)
+	go s.batchLoop()
+	go s.deliveryLoop()
+
+	return s, nil
+}
+
+// Send queues the event for all the webhooks of the app interested in it. It never blocks, if the
+// buffer is full the event is dropped.
+func (s *Sender) Send(app *gsockets.App, event gsockets.WebhookEvent) {
+	if app == nil || len(app.Webhooks) == 0 {
+		return
+	}
+
+	select {
+	case s.events <- appEvent{app: app, event: event}:
+	default:
+		s.logger.Warn("msg", "webhook buffer is full, dropping event", "app_id", app.ID, "event", event.Name)
+	}
+}
+
+// DeadLetters returns the deliveries of an app which ran out of attempts.
+func (s *Sender) DeadLetters(appId string) ([]Delivery, error) {
+	return s.queue.DeadLetters(appId)
+}
+
+// Replay schedules a dead-lettered delivery to be sent again.
+func (s *Sender) Replay(appId, id string) (Delivery, error) {
+	d, err := s.queue.Replay(appId, id)
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	s.notify()
+	return d, nil
+}
+
+// Close stores the buffered events in the queue, makes a last attempt to send the deliveries due
+// and waits for the in flight requests before closing the queue.
+func (s *Sender) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+
+		s.stopped.Wait()
+		s.processDue()
+		s.deliveries.Wait()
+
+		if err := s.queue.Close(); err != nil {
+			s.logger.Error("msg", "error closing webhook queue", "error", err.Error())
+		}
+	})
+}
+
+func (s *Sender) batchLoop() {
+	defer s.stopped.Done()
+
+	ticker := time.NewTicker(s.config.BatchInterval)
+	defer ticker.Stop()
+
+	batches := make(map[string]*batch)
+
+	for {
+		select {
+		case ev := <-s.events:
+			s.add(batches, ev)
+		case <-ticker.C:
+			s.flushAll(batches)
+		case <-s.done:
+			for {
+				select {
+				case ev := <-s.events:
+					s.add(batches, ev)
+				default:
+					s.flushAll(batches)
+					return
+				}
+			}
+		}
+	}
+}
+
+// add appends the event to the batch of every matching webhook, flushing the batches that are full.
+func (s *Sender) add(batches map[string]*batch, ev appEvent) {
+	for _, webhook := range ev.app.Webhooks {
+		if !webhook.Matches(ev.event) {
+			continue
+		}
+
+		key := ev.app.ID + "#" + webhook.Url
+		b, ok := batches[key]
+		if !ok {
+			b = &batch{appId: ev.app.ID, url: webhook.Url}
+			batches[key] = b
+		}
+
+		b.events = append(b.events, ev.event)
+		if len(b.events) >= s.config.BatchSize {
+			s.flush(b)
+			delete(batches, key)
+		}
+	}
+}
+
+func (s *Sender) flushAll(batches map[string]*batch) {
+	for key, b := range batches {
+		s.flush(b)
+		delete(batches, key)
+	}
+}
+
+// flush stores the batch in the queue as a new delivery.
+func (s *Sender) flush(b *batch) {
+	now := time.Now()
+	d := Delivery{
+		Id:          ulid.Make().String(),
+		AppId:       b.appId,
+		Url:         b.url,
+		Payload:     Payload{TimeMs: now.UnixMilli(), Events: b.events},
+		CreatedAt:   now,
+		NextAttempt: now,
+	}
+
+	if err := s.queue.Enqueue(d); err != nil {
+		s.logger.Error("msg", "error storing webhook delivery", "app_id", b.appId, "url", b.url, "error", err.Error())
+		return
+	}
+
+	s.notify()
+}
+
+// notify wakes up the delivery loop without waiting for the next poll.
+func (s *Sender) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Sender) deliveryLoop() {
+	defer s.stopped.Done()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.processDue()
+		case <-s.wake:
+			s.processDue()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// processDue starts sending the deliveries due which are not already in flight.
+func (s *Sender) processDue() {
+	due, err := s.queue.Due(time.Now(), maxConcurrentDeliveries)
+	if err != nil {
+		s.logger.Error("msg", "error reading webhook queue", "error", err.Error())
+		return
+	}
+
+	for _, d := range due {
+		s.inflightLock.Lock()
+		if s.inflight[d.Id] {
+			s.inflightLock.Unlock()
+			continue
+		}
+
+		s.inflight[d.Id] = true
+		s.inflightLock.Unlock()
+
+		s.slots <- struct{}{}
+		s.deliveries.Add(1)
+
+		go func(d Delivery) {
+			defer func() {
+				s.inflightLock.Lock()
+				delete(s.inflight, d.Id)
+				s.inflightLock.Unlock()
+
+				<-s.slots
+				s.deliveries.Done()
+			}()
+
+			s.deliver(d)
+		}(d)
+	}
+}
+
+// deliver makes one attempt to send the delivery and updates the queue with the result.
+func (s *Sender) deliver(d Delivery) {
+	err := s.post(d)
+	if err == nil {
+		s.metrics.WebhookDelivery(d.AppId, gsockets.WEBHOOK_DELIVERY_SUCCESS)
+
+		if err := s.queue.Remove(d.Id); err != nil {
+			s.logger.Error("msg", "error removing webhook delivery", "id", d.Id, "error", err.Error())
+		}
+
+		return
+	}
+
+	d.Attempts++
+	d.LastError = err.Error()
+
+	if d.Attempts >= s.config.MaxAttempts {
+		s.metrics.WebhookDelivery(d.AppId, gsockets.WEBHOOK_DELIVERY_DEAD_LETTER)
+		s.logger.Error("msg", "giving up delivering webhook", "app_id", d.AppId, "url", d.Url, "id", d.Id, "error", err.Error())
+
+		if err := s.queue.DeadLetter(d); err != nil {
+			s.logger.Error("msg", "error dead-lettering webhook delivery", "id", d.Id, "error", err.Error())
+		}
+
+		return
+	}
+
+	s.metrics.WebhookDelivery(d.AppId, gsockets.WEBHOOK_DELIVERY_FAILURE)
+	s.logger.Warn("msg", "error delivering webhook", "app_id", d.AppId, "url", d.Url, "attempt", d.Attempts, "error", err.Error())
+
+	d.NextAttempt = time.Now().Add(s.backoff(d.Attempts))
+	if err := s.queue.Enqueue(d); err != nil {
+		s.logger.Error("msg", "error rescheduling webhook delivery", "id", d.Id, "error", err.Error())
+	}
+}
+
+// backoff returns the wait before the next attempt, doubling the retry delay after each attempt.
+func (s *Sender) backoff(attempts int) time.Duration {
+	delay := s.config.RetryDelay
+	for i := 1; i < attempts && delay < s.config.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > s.config.MaxRetryDelay {
+		delay = s.config.MaxRetryDelay
+	}
+
+	return delay
+}
+
+// post sends the delivery signed with the app's current key and secret.
+func (s *Sender) post(d Delivery) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Timeout)
+	defer cancel()
+
+	app, err := s.apps.FindById(ctx, d.AppId)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(d.Payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Pusher-Key", app.Key)
+	req.Header.Set("X-Pusher-Signature", Sign(app.Secret, body))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// Sign returns the hex encoded HMAC SHA256 of the body using the app secret, as sent in the
+// X-Pusher-Signature header.
+func Sign(secret string, body []byte) string {
+	hasher := hmac.New(sha256.New, []byte(secret))
+	hasher.Write(body)
+
+	return hex.EncodeToString(hasher.Sum(nil))
+}
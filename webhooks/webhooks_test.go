@@ -0,0 +1,193 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gsockets/gsockets"
+	appmanagers "github.com/gsockets/gsockets/app_managers"
+	"github.com/gsockets/gsockets/config"
+	"github.com/gsockets/gsockets/log"
+	"github.com/gsockets/gsockets/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+// receiver records the webhook requests it receives.
+type receiver struct {
+	requests []*http.Request
+	payloads []Payload
+	bodies   [][]byte
+	lock     sync.Mutex
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	var payload Payload
+	_ = json.Unmarshal(body, &payload)
+
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	rc.requests = append(rc.requests, r)
+	rc.payloads = append(rc.payloads, payload)
+	rc.bodies = append(rc.bodies, body)
+}
+
+func (rc *receiver) count() int {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	return len(rc.payloads)
+}
+
+// newTestSender returns a sender knowing about the given app.
+func newTestSender(t *testing.T, cfg config.Webhooks, app *gsockets.App) *Sender {
+	apps, err := appmanagers.New(config.AppManager{Driver: "array", Array: []gsockets.App{*app}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender, err := New(cfg, apps, metrics.NewNoop(), log.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(sender.Close)
+
+	return sender
+}
+
+func getTestApp(url string, eventTypes ...string) *gsockets.App {
+	return &gsockets.App{
+		ID:       "1234",
+		Key:      "app-key",
+		Secret:   "secret",
+		Webhooks: []gsockets.Webhook{{Url: url, EventTypes: eventTypes}},
+	}
+}
+
+func TestSenderBatchesAndSignsEvents(t *testing.T) {
+	rc := &receiver{}
+	ts := httptest.NewServer(rc)
+	defer ts.Close()
+
+	app := getTestApp(ts.URL, gsockets.WEBHOOK_CHANNEL_OCCUPIED, gsockets.WEBHOOK_CHANNEL_VACATED)
+	sender := newTestSender(t, config.Webhooks{BatchInterval: 50 * time.Millisecond}, app)
+
+	sender.Send(app, gsockets.WebhookEvent{Name: gsockets.WEBHOOK_CHANNEL_OCCUPIED, Channel: "my-channel"})
+	sender.Send(app, gsockets.WebhookEvent{Name: gsockets.WEBHOOK_CHANNEL_VACATED, Channel: "my-channel"})
+	sender.Close()
+
+	assert.Equal(t, 1, rc.count(), "events must be sent in a single batch")
+	assert.Len(t, rc.payloads[0].Events, 2)
+	assert.Equal(t, gsockets.WEBHOOK_CHANNEL_OCCUPIED, rc.payloads[0].Events[0].Name)
+	assert.NotZero(t, rc.payloads[0].TimeMs)
+
+	req := rc.requests[0]
+	assert.Equal(t, "app-key", req.Header.Get("X-Pusher-Key"))
+	assert.Equal(t, Sign("secret", rc.bodies[0]), req.Header.Get("X-Pusher-Signature"))
+}
+
+func TestSenderSplitsBatchesBySize(t *testing.T) {
+	rc := &receiver{}
+	ts := httptest.NewServer(rc)
+	defer ts.Close()
+
+	app := getTestApp(ts.URL, gsockets.WEBHOOK_CHANNEL_OCCUPIED)
+	sender := newTestSender(t, config.Webhooks{BatchInterval: time.Minute, BatchSize: 2}, app)
+
+	for i := 0; i < 3; i++ {
+		sender.Send(app, gsockets.WebhookEvent{Name: gsockets.WEBHOOK_CHANNEL_OCCUPIED, Channel: "my-channel"})
+	}
+
+	assert.Eventually(t, func() bool { return rc.count() == 1 }, time.Second, 10*time.Millisecond, "full batch must be sent right away")
+
+	sender.Close()
+	assert.Equal(t, 2, rc.count(), "remaining events must be sent on close")
+}
+
+func TestSenderFiltersEvents(t *testing.T) {
+	rc := &receiver{}
+	ts := httptest.NewServer(rc)
+	defer ts.Close()
+
+	app := getTestApp(ts.URL, gsockets.WEBHOOK_MEMBER_ADDED)
+	app.Webhooks[0].Filter.ChannelNameStartsWith = "presence-"
+	sender := newTestSender(t, config.Webhooks{}, app)
+
+	sender.Send(app, gsockets.WebhookEvent{Name: gsockets.WEBHOOK_CHANNEL_OCCUPIED, Channel: "presence-room"})
+	sender.Send(app, gsockets.WebhookEvent{Name: gsockets.WEBHOOK_MEMBER_ADDED, Channel: "other-room", UserId: "1"})
+	sender.Send(app, gsockets.WebhookEvent{Name: gsockets.WEBHOOK_MEMBER_ADDED, Channel: "presence-room", UserId: "2"})
+	sender.Close()
+
+	assert.Equal(t, 1, rc.count())
+	assert.Equal(t, []gsockets.WebhookEvent{{Name: gsockets.WEBHOOK_MEMBER_ADDED, Channel: "presence-room", UserId: "2"}}, rc.payloads[0].Events)
+}
+
+func TestSenderRetriesFailedRequests(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	app := getTestApp(ts.URL, gsockets.WEBHOOK_CHANNEL_OCCUPIED)
+	sender := newTestSender(t, config.Webhooks{MaxAttempts: 3, RetryDelay: time.Millisecond}, app)
+	sender.Send(app, gsockets.WebhookEvent{Name: gsockets.WEBHOOK_CHANNEL_OCCUPIED, Channel: "my-channel"})
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&attempts) == 3 }, 2*time.Second, 10*time.Millisecond, "the request must be retried until it succeeds")
+
+	deadLetters, err := sender.DeadLetters(app.ID)
+	assert.Nil(t, err)
+	assert.Empty(t, deadLetters, "successful delivery must not be dead-lettered")
+}
+
+func TestSenderDeadLettersAndReplays(t *testing.T) {
+	var failing int32 = 1
+	rc := &receiver{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		rc.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	app := getTestApp(ts.URL, gsockets.WEBHOOK_CHANNEL_OCCUPIED)
+	sender := newTestSender(t, config.Webhooks{MaxAttempts: 2, RetryDelay: time.Millisecond}, app)
+	sender.Send(app, gsockets.WebhookEvent{Name: gsockets.WEBHOOK_CHANNEL_OCCUPIED, Channel: "my-channel"})
+
+	var deadLetters []Delivery
+	assert.Eventually(t, func() bool {
+		deadLetters, _ = sender.DeadLetters(app.ID)
+		return len(deadLetters) == 1
+	}, 2*time.Second, 10*time.Millisecond, "delivery must be dead-lettered after the last attempt")
+
+	assert.Equal(t, 2, deadLetters[0].Attempts)
+	assert.Equal(t, "unexpected status code 503", deadLetters[0].LastError)
+
+	_, err := sender.Replay(app.ID, "unknown")
+	assert.ErrorIs(t, err, ErrDeliveryNotFound)
+
+	atomic.StoreInt32(&failing, 0)
+
+	_, err = sender.Replay(app.ID, deadLetters[0].Id)
+	assert.Nil(t, err)
+
+	assert.Eventually(t, func() bool { return rc.count() == 1 }, 2*time.Second, 10*time.Millisecond, "replayed delivery must be sent")
+	assert.Equal(t, "my-channel", rc.payloads[0].Events[0].Channel)
+
+	deadLetters, _ = sender.DeadLetters(app.ID)
+	assert.Empty(t, deadLetters, "replayed delivery must leave the dead-letter store")
+}